@@ -0,0 +1,378 @@
+package network
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// attentionState contains the values of an attention layer for a single sample.
+// Sequences are stored as (Steps x dim) matrices, one step per row
+type attentionState struct {
+	x       *mat64.Dense
+	q, k, v *mat64.Dense
+	o       *mat64.Dense
+	p       []*mat64.Dense
+	y       *mat64.Dense
+	padding []bool
+	a       *mat64.Vector
+}
+
+// attentionScratch contains the containers used in the backward pass at a single core
+type attentionScratch struct {
+	dO, dQ, dK, dV *mat64.Dense
+	dP             *mat64.Dense
+	dX             *mat64.Dense
+	tmp            *mat64.Dense
+	deltaIn        *mat64.Vector
+}
+
+// MultiHeadAttention is a multi-head scaled dot-product self-attention layer on sequences of
+// Steps vectors. Every step attends to the steps allowed by the masks: with Causal, steps only
+// attend to themselves and earlier steps, and with MaskPadding, steps that are all zeros (such
+// as the padding added by FlattenSequence) are not attended to. The heads split the vectors
+// into Heads parts, and their outputs are concatenated and projected back to the input size
+type MultiHeadAttention struct {
+	Heads       int
+	Steps       int
+	Causal      bool
+	MaskPadding bool
+	dim         int
+	wq, wk, wv  *mat64.Dense
+	wo          *mat64.Dense
+	bq, bk, bv  *mat64.Vector
+	bo          *mat64.Vector
+	params      []*Param
+	nabla       [][]*mat64.Dense
+	states      []*attentionState
+	scratch     []*attentionScratch
+	weightSource
+}
+
+// NewMultiHeadAttention returns a self-attention layer with the given number of heads
+func NewMultiHeadAttention(heads, steps int, causal bool) *MultiHeadAttention {
+	return &MultiHeadAttention{Heads: heads, Steps: steps, Causal: causal}
+}
+
+func (m *MultiHeadAttention) Name() string { return "multiHeadAttention" }
+
+// Init initiates the query, key, value and output projections with random numbers
+func (m *MultiHeadAttention) Init(inputSize int) (int, error) {
+	if m.Heads <= 0 || m.Steps <= 0 || inputSize%m.Steps != 0 || (inputSize/m.Steps)%m.Heads != 0 {
+		return 0, fmt.Errorf("input size %d can not be split into %d steps and %d heads", inputSize, m.Steps, m.Heads)
+	}
+
+	m.dim = inputSize / m.Steps
+	weights := sliceWithGonumDense(4, repeat(m.dim, 4), m.dim, randomFunc(m.rng))
+	biases := sliceWithGonumVector(4, repeat(m.dim, 4), zeroFunc())
+	m.wq, m.wk, m.wv, m.wo = weights[0], weights[1], weights[2], weights[3]
+	m.bq, m.bk, m.bv, m.bo = biases[0], biases[1], biases[2], biases[3]
+
+	m.params = nil
+	for _, w := range weights {
+		m.params = append(m.params, &Param{Value: w, Regularize: true})
+	}
+	for _, b := range biases {
+		m.params = append(m.params, &Param{Value: vectorAsDense(b)})
+	}
+
+	return inputSize, nil
+}
+
+// newState allocates the values of a single sample
+func (m *MultiHeadAttention) newState() *attentionState {
+	s := &attentionState{
+		q:       mat64.NewDense(m.Steps, m.dim, nil),
+		k:       mat64.NewDense(m.Steps, m.dim, nil),
+		v:       mat64.NewDense(m.Steps, m.dim, nil),
+		o:       mat64.NewDense(m.Steps, m.dim, nil),
+		padding: make([]bool, m.Steps),
+		a:       mat64.NewVector(m.Steps*m.dim, nil),
+	}
+	s.y = mat64.NewDense(m.Steps, m.dim, s.a.RawVector().Data)
+	for h := 0; h < m.Heads; h++ {
+		s.p = append(s.p, mat64.NewDense(m.Steps, m.Steps, nil))
+	}
+	return s
+}
+
+// Alloc allocates the containers and gradients for every core
+func (m *MultiHeadAttention) Alloc(nCores int) {
+	m.states = make([]*attentionState, nCores)
+	m.scratch = make([]*attentionScratch, nCores)
+	m.nabla = make([][]*mat64.Dense, nCores)
+	for proc := range m.states {
+		m.states[proc] = m.newState()
+		deltaIn := mat64.NewVector(m.Steps*m.dim, nil)
+		m.scratch[proc] = &attentionScratch{
+			dO:      mat64.NewDense(m.Steps, m.dim, nil),
+			dQ:      mat64.NewDense(m.Steps, m.dim, nil),
+			dK:      mat64.NewDense(m.Steps, m.dim, nil),
+			dV:      mat64.NewDense(m.Steps, m.dim, nil),
+			dP:      mat64.NewDense(m.Steps, m.Steps, nil),
+			dX:      mat64.NewDense(m.Steps, m.dim, deltaIn.RawVector().Data),
+			tmp:     mat64.NewDense(m.dim, m.dim, nil),
+			deltaIn: deltaIn,
+		}
+		for _, param := range m.params {
+			rows, cols := param.Value.Dims()
+			m.nabla[proc] = append(m.nabla[proc], mat64.NewDense(rows, cols, nil))
+		}
+	}
+}
+
+// addBias adds the bias vector b to every row of x
+func addBias(x *mat64.Dense, b *mat64.Vector) {
+	rows, _ := x.Dims()
+	for i := 0; i < rows; i++ {
+		row := x.RawRowView(i)
+		for j := range row {
+			row[j] += b.At(j, 0)
+		}
+	}
+}
+
+// addColumnSums adds the sums of the columns of x to the column matrix b
+func addColumnSums(b *mat64.Dense, x *mat64.Dense) {
+	rows, _ := x.Dims()
+	for i := 0; i < rows; i++ {
+		for j, v := range x.RawRowView(i) {
+			b.Set(j, 0, b.At(j, 0)+v)
+		}
+	}
+}
+
+// masked returns true if step i can not attend to step j
+func (m *MultiHeadAttention) masked(s *attentionState, i, j int) bool {
+	return (m.Causal && j > i) || (m.MaskPadding && s.padding[j])
+}
+
+// forward computes the output of the layer for the sequence x
+func (m *MultiHeadAttention) forward(s *attentionState, x *mat64.Vector) {
+	s.x = mat64.NewDense(m.Steps, m.dim, x.RawVector().Data)
+	for t := 0; t < m.Steps; t++ {
+		s.padding[t] = true
+		for _, v := range s.x.RawRowView(t) {
+			if v != 0 {
+				s.padding[t] = false
+				break
+			}
+		}
+	}
+
+	s.q.Mul(s.x, m.wq)
+	addBias(s.q, m.bq)
+	s.k.Mul(s.x, m.wk)
+	addBias(s.k, m.bk)
+	s.v.Mul(s.x, m.wv)
+	addBias(s.v, m.bv)
+
+	dk := m.dim / m.Heads
+	scale := 1 / math.Sqrt(float64(dk))
+	for h := 0; h < m.Heads; h++ {
+		q := s.q.View(0, h*dk, m.Steps, dk)
+		k := s.k.View(0, h*dk, m.Steps, dk)
+		v := s.v.View(0, h*dk, m.Steps, dk)
+		p := s.p[h]
+
+		p.Mul(q, k.T())
+		for i := 0; i < m.Steps; i++ {
+			row := p.RawRowView(i)
+			largest := math.Inf(-1)
+			for j := range row {
+				if !m.masked(s, i, j) && row[j]*scale > largest {
+					largest = row[j] * scale
+				}
+			}
+
+			var sum float64
+			for j := range row {
+				if m.masked(s, i, j) {
+					row[j] = 0
+					continue
+				}
+				row[j] = math.Exp(row[j]*scale - largest)
+				sum += row[j]
+			}
+			for j := range row {
+				if sum > 0 {
+					row[j] /= sum
+				}
+			}
+		}
+
+		s.o.View(0, h*dk, m.Steps, dk).(*mat64.Dense).Mul(p, v)
+	}
+
+	s.y.Mul(s.o, m.wo)
+	addBias(s.y, m.bo)
+}
+
+// Forward computes the attention of every step of the sequence x
+func (m *MultiHeadAttention) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var s *attentionState
+	if proc == inference {
+		s = m.newState()
+	} else {
+		s = m.states[proc]
+	}
+
+	m.forward(s, x)
+	return s.a
+}
+
+// Backward adds the gradients of the projections, and returns the error at every step of the
+// input, through the queries, keys and values
+func (m *MultiHeadAttention) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	s, sc, nabla := m.states[proc], m.scratch[proc], m.nabla[proc]
+	dY := mat64.NewDense(m.Steps, m.dim, delta.RawVector().Data)
+
+	sc.tmp.Mul(s.o.T(), dY)
+	nabla[3].Add(nabla[3], sc.tmp)
+	addColumnSums(nabla[7], dY)
+	sc.dO.Mul(dY, m.wo.T())
+
+	dk := m.dim / m.Heads
+	scale := 1 / math.Sqrt(float64(dk))
+	for h := 0; h < m.Heads; h++ {
+		q := s.q.View(0, h*dk, m.Steps, dk)
+		k := s.k.View(0, h*dk, m.Steps, dk)
+		v := s.v.View(0, h*dk, m.Steps, dk)
+		dO := sc.dO.View(0, h*dk, m.Steps, dk)
+		p := s.p[h]
+
+		sc.dV.View(0, h*dk, m.Steps, dk).(*mat64.Dense).Mul(p.T(), dO)
+		sc.dP.Mul(dO, v.T())
+
+		// Softmax backward, giving the error at the scaled scores
+		for i := 0; i < m.Steps; i++ {
+			pRow, dRow := p.RawRowView(i), sc.dP.RawRowView(i)
+			var dot float64
+			for j := range pRow {
+				dot += pRow[j] * dRow[j]
+			}
+			for j := range pRow {
+				dRow[j] = pRow[j] * (dRow[j] - dot) * scale
+			}
+		}
+
+		sc.dQ.View(0, h*dk, m.Steps, dk).(*mat64.Dense).Mul(sc.dP, k)
+		sc.dK.View(0, h*dk, m.Steps, dk).(*mat64.Dense).Mul(sc.dP.T(), q)
+	}
+
+	for idx, d := range []*mat64.Dense{sc.dQ, sc.dK, sc.dV} {
+		sc.tmp.Mul(s.x.T(), d)
+		nabla[idx].Add(nabla[idx], sc.tmp)
+		addColumnSums(nabla[4+idx], d)
+	}
+
+	sc.dX.Mul(sc.dQ, m.wq.T())
+	var dx mat64.Dense
+	dx.Mul(sc.dK, m.wk.T())
+	sc.dX.Add(sc.dX, &dx)
+	dx.Mul(sc.dV, m.wv.T())
+	sc.dX.Add(sc.dX, &dx)
+
+	return sc.deltaIn
+}
+
+// Params returns the query, key, value and output weights, followed by their biases
+func (m *MultiHeadAttention) Params() []*Param {
+	return m.params
+}
+
+// Grads returns the gradients at proc
+func (m *MultiHeadAttention) Grads(proc int) []*mat64.Dense {
+	return m.nabla[proc]
+}
+
+// SequenceSteps returns the number of steps of the input sequences
+func (m *MultiHeadAttention) SequenceSteps() int {
+	return m.Steps
+}
+
+// PositionalEncoding adds the sinusoidal encoding of the position of every step to
+// sequences of Steps vectors, so that attention layers can tell the steps apart
+type PositionalEncoding struct {
+	Steps    int
+	encoding *mat64.Vector
+	a        []*mat64.Vector
+}
+
+// NewPositionalEncoding returns a positional encoding of sequences of the given length
+func NewPositionalEncoding(steps int) *PositionalEncoding {
+	return &PositionalEncoding{Steps: steps}
+}
+
+func (pe *PositionalEncoding) Name() string { return "positionalEncoding" }
+
+// Init computes the encoding, sin(t / 10000^(2i/dim)) at entry 2i and
+// cos(t / 10000^(2i/dim)) at entry 2i+1 of step t
+func (pe *PositionalEncoding) Init(inputSize int) (int, error) {
+	if pe.Steps <= 0 || inputSize%pe.Steps != 0 {
+		return 0, fmt.Errorf("input size %d can not be split into %d steps", inputSize, pe.Steps)
+	}
+
+	dim := inputSize / pe.Steps
+	pe.encoding = mat64.NewVector(inputSize, nil)
+	for t := 0; t < pe.Steps; t++ {
+		for j := 0; j < dim; j++ {
+			angle := float64(t) / math.Pow(10000, float64(j-j%2)/float64(dim))
+			if j%2 == 0 {
+				pe.encoding.SetVec(t*dim+j, math.Sin(angle))
+			} else {
+				pe.encoding.SetVec(t*dim+j, math.Cos(angle))
+			}
+		}
+	}
+
+	return inputSize, nil
+}
+
+func (pe *PositionalEncoding) Alloc(nCores int) {
+	pe.a = sliceWithGonumVector(nCores, repeat(pe.encoding.Len(), nCores), zeroFunc())
+}
+
+// Forward adds the encoding to x
+func (pe *PositionalEncoding) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var a *mat64.Vector
+	if proc == inference {
+		a = mat64.NewVector(pe.encoding.Len(), nil)
+	} else {
+		a = pe.a[proc]
+	}
+
+	a.AddVec(x, pe.encoding)
+	return a
+}
+
+// Backward passes the error on as is
+func (pe *PositionalEncoding) Backward(delta *mat64.Vector, proc int) *mat64.Vector { return delta }
+
+func (pe *PositionalEncoding) Params() []*Param { return nil }
+
+func (pe *PositionalEncoding) Grads(proc int) []*mat64.Dense { return nil }
+
+// SequenceSteps returns the number of steps of the input sequences
+func (pe *PositionalEncoding) SequenceSteps() int {
+	return pe.Steps
+}
+
+// NewTransformerEncoder returns a Transformer encoder block for sequences of steps vectors of
+// size dim, as a graph: self-attention with the given number of heads, followed by a feed
+// forward network with a hidden ReLU layer of the given size applied to every step, each
+// with a residual connection and followed by layer normalization of every step
+func NewTransformerEncoder(steps, dim, heads, hidden int, causal bool) *Graph {
+	g := NewGraph()
+	x := g.Input(steps * dim)
+
+	attention := g.Layer(NewMultiHeadAttention(heads, steps, causal), x)
+	norm := g.Layer(&LayerNorm{Steps: steps}, g.Add(x, attention))
+
+	ff := g.Layer(NewTimeDistributed(NewDense(hidden, ReLU, ReLUPrime), steps), norm)
+	ff = g.Layer(NewTimeDistributed(NewDense(dim, Identity, IdentityPrime), steps), ff)
+
+	g.Output(g.Layer(&LayerNorm{Steps: steps}, g.Add(norm, ff)), 1)
+	return g
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttentionGradients(t *testing.T) {
+	checkLayerGradients(t, NewMultiHeadAttention(2, 3, false), 12)
+	checkLayerGradients(t, NewMultiHeadAttention(1, 4, true), 8)
+	checkLayerGradients(t, NewPositionalEncoding(3), 6)
+	checkLayerGradients(t, NewTimeDistributed(NewDense(2, Sigmoid, SigmoidPrime), 3), 9)
+	checkLayerGradients(t, NewTransformerEncoder(3, 4, 2, 5, false), 12)
+
+	_, err := NewMultiHeadAttention(3, 2, false).Init(8)
+	assert.Error(t, err)
+}
+
+func TestAttentionMasks(t *testing.T) {
+	// With a causal mask, changing a step does not change the output at earlier steps
+	m := NewMultiHeadAttention(2, 3, true)
+	_, err := m.Init(6)
+	assert.NoError(t, err)
+	x := randomVectors(1, 6)[0]
+	a := mat64.NewVector(6, nil)
+	a.CloneVec(m.Forward(x, inference))
+	x.SetVec(5, x.At(5, 0)+1)
+	b := m.Forward(x, inference)
+	assert.InDeltaSlice(t, a.RawVector().Data[:4], b.RawVector().Data[:4], 1e-12)
+	assert.NotEqual(t, a.At(5, 0), b.At(5, 0))
+
+	// With a padding mask, steps of zeros are not attended to
+	m = &MultiHeadAttention{Heads: 1, Steps: 3, MaskPadding: true}
+	_, err = m.Init(6)
+	assert.NoError(t, err)
+	m.Alloc(1)
+	m.Forward(mat64.NewVector(6, []float64{0, 0, 1, 2, 3, 4}), 0)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 0.0, m.states[0].p[0].At(i, 0))
+		assert.InDelta(t, 1, m.states[0].p[0].At(i, 1)+m.states[0].p[0].At(i, 2), 1e-12)
+	}
+}
+
+func TestTransformerNetwork(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(12, nil, nil)
+	assert.NoError(t, n.Add(NewPositionalEncoding(4)))
+	assert.NoError(t, n.Add(NewTransformerEncoder(4, 3, 3, 6, false)))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	assert.Equal(t, []int{12, 12, 12, 2}, n.Sizes)
+
+	// Is the sum of the first features of the sequence positive
+	var input [][][]float64
+	var output [][]float64
+	for idx := 0; idx < 40; idx++ {
+		seq := make([][]float64, 4)
+		var sum float64
+		for t := range seq {
+			seq[t] = []float64{rand.NormFloat64(), rand.NormFloat64(), rand.NormFloat64()}
+			sum += seq[t][0]
+		}
+		input = append(input, seq)
+		if sum > 0 {
+			output = append(output, []float64{1, 0})
+		} else {
+			output = append(output, []float64{0, 1})
+		}
+	}
+
+	assert.NoError(t, n.LoadSequenceTrainingData(input, output))
+	n.TrainNetwork(2, 4, 0.1, 0, true, false, 2)
+
+	a, err := n.PredictSequence(input[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(a))
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	b, err := loaded.PredictSequence(input[0])
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, a, b, 1e-12)
+}
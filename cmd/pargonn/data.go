@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DataSpec gives the data files of a spec. Every row of a csv file contains the inputs
+// followed by the outputs, or by the index of the class if Label is true. Every line of a
+// jsonl file contains an object {"input": [...], "output": [...]}. The format is given by
+// the file extension if left out
+type DataSpec struct {
+	Train      string `yaml:"train"`
+	Validation string `yaml:"validation"`
+	Format     string `yaml:"format"`
+	Header     bool   `yaml:"header"`
+	Label      bool   `yaml:"label"`
+}
+
+// sample is a line of a jsonl file
+type sample struct {
+	Input  []float64 `json:"input"`
+	Output []float64 `json:"output"`
+}
+
+// format returns the format of the file at path
+func (ds DataSpec) format(path string) string {
+	if ds.Format != "" {
+		return ds.Format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".json":
+		return "jsonl"
+	}
+	return "csv"
+}
+
+// readData reads the input and output data of the file at path, for a network
+// with the given input and output sizes
+func (ds DataSpec) readData(path string, inputs, outputs int) (input, output [][]float64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	switch ds.format(path) {
+	case "csv":
+		input, output, err = ds.readCSV(f, inputs, outputs)
+	case "jsonl":
+		input, output, err = readJSONLines(f, inputs, outputs)
+	default:
+		return nil, nil, fmt.Errorf("unknown data format %q", ds.Format)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(input) == 0 {
+		return nil, nil, fmt.Errorf("%s: no data", path)
+	}
+	return input, output, nil
+}
+
+// readCSV reads the rows of the csv data in r
+func (ds DataSpec) readCSV(r io.Reader, inputs, outputs int) (input, output [][]float64, err error) {
+	columns := inputs + outputs
+	if ds.Label {
+		columns = inputs + 1
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = columns
+	reader.TrimLeadingSpace = true
+	if ds.Header {
+		if _, err := reader.Read(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		row, err := parseFloats(record)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		y := row[inputs:]
+		if ds.Label {
+			class := int(y[0])
+			if float64(class) != y[0] || class < 0 || class >= outputs {
+				line, _ := reader.FieldPos(0)
+				return nil, nil, fmt.Errorf("line %d: invalid class %v for %d outputs", line, y[0], outputs)
+			}
+			y = make([]float64, outputs)
+			y[class] = 1
+		}
+		input = append(input, row[:inputs])
+		output = append(output, y)
+	}
+
+	return input, output, nil
+}
+
+// readJSONLines reads the samples of the jsonl data in r
+func readJSONLines(r io.Reader, inputs, outputs int) (input, output [][]float64, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var s sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(s.Input) != inputs || len(s.Output) != outputs {
+			return nil, nil, fmt.Errorf("line %d: got %d inputs and %d outputs, want %d and %d",
+				line, len(s.Input), len(s.Output), inputs, outputs)
+		}
+		input = append(input, s.Input)
+		output = append(output, s.Output)
+	}
+
+	return input, output, scanner.Err()
+}
+
+// parseFloats parses every field of a csv record
+func parseFloats(record []string) ([]float64, error) {
+	row := make([]float64, len(record))
+	for i, field := range record {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		row[i] = v
+	}
+	return row, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/gmkvaal/parGoNN/metrics"
+)
+
+// runEval prints the metrics report of a saved network on a labelled data file,
+// predicting the inputs in parallel
+func runEval(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	model := fs.String("model", "", "path of the model file")
+	metric := fs.String("metric", "classification", "metrics report, classification, regression or multiLabel")
+	format := fs.String("format", "", "format of the data, csv or jsonl (by file extension)")
+	header := fs.Bool("header", false, "skip the first line of csv data")
+	label := fs.Bool("label", false, "the last column of csv data is the index of the class")
+	topK := fs.String("topk", "", "comma separated k-s of the top-k accuracies of classification reports")
+	cores := fs.Int("cores", runtime.NumCPU(), "number of cores predicting in parallel")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *model == "" || fs.NArg() != 1 {
+		return fmt.Errorf("usage: pargonn eval -model path [-metric classification|regression|multiLabel] [-label] file")
+	}
+
+	var ks []int
+	if *topK != "" {
+		for _, field := range strings.Split(*topK, ",") {
+			k, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || k < 1 {
+				return fmt.Errorf("invalid top-k %q", field)
+			}
+			ks = append(ks, k)
+		}
+	}
+
+	n, err := network.LoadFile(*model)
+	if err != nil {
+		return err
+	}
+
+	ds := DataSpec{Format: *format, Header: *header, Label: *label}
+	input, output, err := ds.readData(fs.Arg(0), n.Sizes[0], n.Sizes[len(n.Sizes)-1])
+	if err != nil {
+		return err
+	}
+
+	// The evaluation methods predict on GOMAXPROCS cores
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(*cores))
+
+	var report metrics.Result
+	switch *metric {
+	case "classification":
+		report = n.Evaluate(input, output, ks...)
+	case "regression":
+		report = n.EvaluateRegression(input, output)
+	case "multiLabel":
+		report = n.EvaluateMultiLabel(input, output)
+	default:
+		return fmt.Errorf("unknown metric %q", *metric)
+	}
+
+	return writeReport(stdout, report)
+}
@@ -0,0 +1,63 @@
+// Command pargonn trains and uses parGoNN networks without writing Go programs.
+//
+// Usage:
+//
+//	pargonn train [-model path] [-run dir] [-tensorboard dir] [-metrics host:port] [-v] spec.yaml
+//	pargonn predict -model path [-format csv|jsonl] [-header] [-output csv|jsonl] [file]
+//	pargonn eval -model path [-metric classification|regression|multiLabel] [-label] file
+//	pargonn serve [-addr host:port] [-grpc host:port] [-reload interval] [-metrics] [name=]path...
+//	pargonn runs compare dir...
+//
+// The network, training parameters and data files of train are given by a YAML or JSON spec,
+// see Spec for the format. predict reads inputs from the file, or from stdin if left out,
+// and writes the predictions to stdout. eval prints the metrics report of a labelled data
+// file, in the formats of the data files of specs. serve serves the predictions of saved
+// networks over HTTP, see network.Server for the endpoints, and over gRPC with -grpc.
+// runs compare prints the metadata and final metrics of run directories saved by train -run.
+// With -metrics, train and serve serve Prometheus metrics at /metrics, see network.Monitor
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// commands maps the subcommands to the functions running them with the remaining arguments
+var commands = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+	"train":   runTrain,
+	"predict": runPredict,
+	"eval":    runEval,
+	"serve":   runServe,
+	"runs":    runRuns,
+}
+
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: pargonn <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:", names)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := command(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "pargonn:", err)
+		os.Exit(1)
+	}
+}
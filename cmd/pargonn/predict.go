@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	network "github.com/gmkvaal/parGoNN"
+)
+
+// prediction is a line of jsonl predictions
+type prediction struct {
+	Output []float64 `json:"output"`
+}
+
+// runPredict writes the predictions of a saved network for the inputs of a file or stdin,
+// predicting batches of inputs in parallel
+func runPredict(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("predict", flag.ContinueOnError)
+	model := fs.String("model", "", "path of the model file")
+	format := fs.String("format", "", "format of the inputs, csv or jsonl (by file extension, csv for stdin)")
+	header := fs.Bool("header", false, "skip the first line of csv inputs")
+	output := fs.String("output", "csv", "format of the predictions, csv or jsonl")
+	cores := fs.Int("cores", runtime.NumCPU(), "number of cores predicting in parallel")
+	batch := fs.Int("batch", 1024, "number of inputs predicted at a time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *model == "" || fs.NArg() > 1 {
+		return fmt.Errorf("usage: pargonn predict -model path [-format csv|jsonl] [-header] [-output csv|jsonl] [file]")
+	}
+	if *output != "csv" && *output != "jsonl" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	n, err := network.LoadFile(*model)
+	if err != nil {
+		return err
+	}
+
+	in := stdin
+	ds := DataSpec{Format: *format, Header: *header}
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in, ds.Format = f, ds.format(fs.Arg(0))
+	}
+	if ds.Format == "" {
+		ds.Format = "csv"
+	}
+
+	w := bufio.NewWriter(stdout)
+	read := 0
+	err = ds.readInputs(in, n.Sizes[0], *batch, func(inputs [][]float64) error {
+		for _, x := range inputs {
+			if err := n.CheckInput(x); err != nil {
+				return fmt.Errorf("input %d: %v", read, err)
+			}
+			read++
+		}
+		for _, y := range n.PredictBatch(inputs, *cores) {
+			if err := writePrediction(w, y, *output); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writePrediction writes the prediction y as a csv row or a json line
+func writePrediction(w io.Writer, y []float64, format string) error {
+	if format == "jsonl" {
+		data, err := json.Marshal(prediction{Output: y})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	fields := make([]string, len(y))
+	for i, v := range y {
+		fields[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(fields, ","))
+	return err
+}
+
+// readInputs reads inputs of the given size from r, and calls f with batches of at most
+// size inputs. Rows of csv inputs contain the inputs only, and lines of jsonl inputs contain
+// an object {"input": [...]}, or the array of inputs
+func (ds DataSpec) readInputs(r io.Reader, inputs, size int, f func(inputs [][]float64) error) error {
+	if size < 1 {
+		size = 1
+	}
+
+	var batch [][]float64
+	add := func(x []float64) error {
+		batch = append(batch, x)
+		if len(batch) < size {
+			return nil
+		}
+		err := f(batch)
+		batch = nil
+		return err
+	}
+
+	switch ds.Format {
+	case "csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = inputs
+		reader.TrimLeadingSpace = true
+		if ds.Header {
+			if _, err := reader.Read(); err != nil {
+				return err
+			}
+		}
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			x, err := parseFloats(record)
+			if err != nil {
+				line, _ := reader.FieldPos(0)
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			if err := add(x); err != nil {
+				return err
+			}
+		}
+	case "jsonl":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var s sample
+			var err error
+			if strings.HasPrefix(text, "[") {
+				err = json.Unmarshal([]byte(text), &s.Input)
+			} else {
+				err = json.Unmarshal([]byte(text), &s)
+			}
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			if len(s.Input) != inputs {
+				return fmt.Errorf("line %d: got %d inputs, want %d", line, len(s.Input), inputs)
+			}
+			if err := add(s.Input); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown data format %q", ds.Format)
+	}
+
+	if len(batch) > 0 {
+		return f(batch)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/stretchr/testify/assert"
+)
+
+// saveTestModel saves a 2-3-2 network to dir, and returns it with the path of the model file
+func saveTestModel(t *testing.T, dir string) (*network.Network, string) {
+	n := &network.Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(3, network.Tanh, network.TanhPrime)
+	n.AddLayer(2, network.Sigmoid, network.SigmoidPrime)
+
+	path := filepath.Join(dir, "model.json")
+	assert.NoError(t, n.SaveFile(path))
+	return n, path
+}
+
+func TestPredict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	n, model := saveTestModel(t, dir)
+
+	inputs := [][]float64{{0.1, 0.2}, {-1, 3}, {0.5, 0.5}}
+
+	// csv from stdin, in batches smaller than the input
+	var stdout bytes.Buffer
+	stdin := strings.NewReader("x0,x1\n0.1,0.2\n-1,3\n0.5,0.5\n")
+	assert.NoError(t, runPredict([]string{"-model", model, "-header", "-batch", "2", "-cores", "2"}, stdin, &stdout))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	for idx, line := range lines {
+		var y []float64
+		for _, field := range strings.Split(line, ",") {
+			v, err := strconv.ParseFloat(field, 64)
+			assert.NoError(t, err)
+			y = append(y, v)
+		}
+		assert.Equal(t, n.Predict(inputs[idx]), y)
+	}
+
+	// jsonl file with objects and arrays, written as json lines
+	path := writeFile(t, dir, "inputs.jsonl", "{\"input\": [0.1, 0.2]}\n[-1, 3]\n\n{\"input\": [0.5, 0.5]}\n")
+	stdout.Reset()
+	assert.NoError(t, runPredict([]string{"-model", model, "-output", "jsonl", path}, nil, &stdout))
+	dec := json.NewDecoder(&stdout)
+	for idx := range inputs {
+		var p prediction
+		assert.NoError(t, dec.Decode(&p))
+		assert.Equal(t, n.Predict(inputs[idx]), p.Output)
+	}
+
+	assert.Error(t, runPredict([]string{"-model", model}, strings.NewReader("1,2,3\n"), &stdout))
+	assert.Error(t, runPredict([]string{"-model", model, "-format", "jsonl"}, strings.NewReader("[1]\n"), &stdout))
+	assert.Error(t, runPredict([]string{path}, nil, &stdout))
+
+	// invalid embedding ids are errors
+	e := &network.Network{}
+	e.AddLayer(2, nil, nil)
+	assert.NoError(t, e.Add(network.NewEmbedding(4, 2)))
+	e.AddLayer(1, network.Sigmoid, network.SigmoidPrime)
+	embedding := filepath.Join(dir, "embedding.json")
+	assert.NoError(t, e.SaveFile(embedding))
+	err = runPredict([]string{"-model", embedding}, strings.NewReader("1,2\n3,4\n"), &stdout)
+	assert.EqualError(t, err, "input 1: embedding: invalid id 4 at entry 1, expected an integer in [0, 4)")
+}
+
+func TestEval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, model := saveTestModel(t, dir)
+
+	data := writeFile(t, dir, "test.csv", "0.1,0.2,0\n-1,3,1\n0.5,0.5,1\n2,-1,0\n")
+	var stdout bytes.Buffer
+	assert.NoError(t, runEval([]string{"-model", model, "-label", "-topk", "1,2", data}, nil, &stdout))
+	report := stdout.String()
+	for _, metric := range []string{"accuracy", "top-2 accuracy", "ROC AUC", "macro", "confusion"} {
+		assert.Contains(t, report, metric)
+	}
+
+	data = writeFile(t, dir, "test.jsonl", "{\"input\": [0.1, 0.2], \"output\": [0.3, 0.7]}\n")
+	stdout.Reset()
+	assert.NoError(t, runEval([]string{"-model", model, "-metric", "regression", data}, nil, &stdout))
+	assert.Contains(t, stdout.String(), "mean MSE")
+
+	stdout.Reset()
+	assert.NoError(t, runEval([]string{"-model", model, "-metric", "multiLabel", data}, nil, &stdout))
+	assert.Contains(t, stdout.String(), "hamming loss")
+
+	assert.Error(t, runEval([]string{"-model", model, "-metric", "auc", data}, nil, &stdout))
+	assert.Error(t, runEval([]string{"-model", model, "-topk", "0", data}, nil, &stdout))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/gmkvaal/parGoNN/metrics"
+)
+
+// writeReport writes every metric of the report as text
+func writeReport(w io.Writer, report metrics.Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	switch r := report.(type) {
+	case metrics.ClassificationReport:
+		fmt.Fprintf(tw, "samples\t%d\nclasses\t%d\naccuracy\t%.4f\nlog loss\t%.4f\n", r.Samples, r.Classes, r.Accuracy, r.LogLoss)
+		if r.Binary {
+			fmt.Fprintf(tw, "ROC AUC\t%.4f\nPR AUC\t%.4f\n", r.ROCAUC, r.PRAUC)
+		}
+		var ks []int
+		for k := range r.TopK {
+			ks = append(ks, k)
+		}
+		sort.Ints(ks)
+		for _, k := range ks {
+			fmt.Fprintf(tw, "top-%d accuracy\t%.4f\n", k, r.TopK[k])
+		}
+
+		fmt.Fprintf(tw, "\nclass\tprecision\trecall\tF1\n")
+		for c := 0; c < r.Classes; c++ {
+			fmt.Fprintf(tw, "%d\t%.4f\t%.4f\t%.4f\n", c, r.Precision[c], r.Recall[c], r.F1[c])
+		}
+		fmt.Fprintf(tw, "macro\t%.4f\t%.4f\t%.4f\n", r.Macro.Precision, r.Macro.Recall, r.Macro.F1)
+		fmt.Fprintf(tw, "micro\t%.4f\t%.4f\t%.4f\n", r.Micro.Precision, r.Micro.Recall, r.Micro.F1)
+
+		fmt.Fprintf(tw, "\nconfusion (true \\ predicted)")
+		for c := 0; c < r.Classes; c++ {
+			fmt.Fprintf(tw, "\t%d", c)
+		}
+		fmt.Fprintln(tw)
+		for c, row := range r.Confusion {
+			fmt.Fprintf(tw, "%d", c)
+			for _, count := range row {
+				fmt.Fprintf(tw, "\t%d", count)
+			}
+			fmt.Fprintln(tw)
+		}
+
+	case metrics.RegressionReport:
+		fmt.Fprintf(tw, "samples\t%d\noutputs\t%d\nmean MSE\t%.4g\n", r.Samples, r.Outputs, r.MeanMSE)
+		fmt.Fprintf(tw, "\noutput\tMSE\tRMSE\tMAE\tR2\tMAPE\tmax error\n")
+		for j := 0; j < r.Outputs; j++ {
+			fmt.Fprintf(tw, "%d\t%.4g\t%.4g\t%.4g\t%.4f\t%.4g\t%.4g\n", j, r.MSE[j], r.RMSE[j], r.MAE[j], r.R2[j], r.MAPE[j], r.MaxError[j])
+		}
+
+	case metrics.MultiLabelReport:
+		fmt.Fprintf(tw, "samples\t%d\nlabels\t%d\nhamming loss\t%.4f\nsubset accuracy\t%.4f\n",
+			r.Samples, r.Labels, r.HammingLoss, r.SubsetAccuracy)
+		fmt.Fprintf(tw, "\nlabel\tthreshold\tprecision\trecall\tF1\n")
+		for j := 0; j < r.Labels; j++ {
+			fmt.Fprintf(tw, "%d\t%.4f\t%.4f\t%.4f\t%.4f\n", j, r.Thresholds[j], r.Precision[j], r.Recall[j], r.F1[j])
+		}
+		fmt.Fprintf(tw, "macro\t\t%.4f\t%.4f\t%.4f\n", r.Macro.Precision, r.Macro.Recall, r.Macro.F1)
+		fmt.Fprintf(tw, "micro\t\t%.4f\t%.4f\t%.4f\n", r.Micro.Precision, r.Micro.Recall, r.Micro.F1)
+
+	default:
+		fmt.Fprintf(tw, "score\t%.4f\n", report.Score())
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	network "github.com/gmkvaal/parGoNN"
+)
+
+// runRuns runs the subcommands on run directories. compare prints a table of the
+// metadata and results of the runs, with the final metrics found in any of them
+func runRuns(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "compare" {
+		return fmt.Errorf("usage: pargonn runs compare dir...")
+	}
+	fs := flag.NewFlagSet("runs compare", flag.ContinueOnError)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: pargonn runs compare dir...")
+	}
+
+	summaries := make([]network.RunSummary, fs.NArg())
+	metricNames := make(map[string]bool)
+	for i, dir := range fs.Args() {
+		summary, err := network.LoadRunSummary(dir)
+		if err != nil {
+			return err
+		}
+		summaries[i] = summary
+		for name := range summary.Final {
+			metricNames[name] = true
+		}
+	}
+	var names []string
+	for name := range metricNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "run\tstart\tduration\tcores\tseed\tsizes\ttrain\tvalid\tepochs\tbest score\tbest epoch")
+	for _, name := range names {
+		fmt.Fprintf(tw, "\t%s", name)
+	}
+	fmt.Fprintln(tw)
+
+	for i, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%v\t%d\t%d\t%d", filepath.Base(fs.Arg(i)),
+			s.Start.Format("2006-01-02 15:04:05"), time.Duration(s.Duration*float64(time.Second)).Round(time.Millisecond),
+			s.Cores, s.Seed, s.Sizes, s.TrainingSamples, s.ValidationSamples, s.Epochs)
+		if s.BestEpoch >= 0 {
+			fmt.Fprintf(tw, "\t%.4f\t%d", s.BestScore, s.BestEpoch+1)
+		} else {
+			fmt.Fprintf(tw, "\t-\t-")
+		}
+		for _, name := range names {
+			if v, ok := s.Final[name]; ok {
+				fmt.Fprintf(tw, "\t%.4g", v)
+			} else {
+				fmt.Fprintf(tw, "\t-")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
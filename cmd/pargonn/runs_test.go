@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	train, validation := writeTrainingData(t, dir)
+	spec := writeFile(t, dir, "spec.yaml", `
+input: 2
+layers:
+  - units: 2
+    activation: sigmoid
+epochs: 4
+batchSize: 4
+eta: 0.5
+cores: 2
+seed: 3
+checkpointEvery: 2
+data:
+  train: `+train+`
+  validation: `+validation+`
+  header: true
+  label: true
+`)
+
+	var stdout bytes.Buffer
+	runs := []string{filepath.Join(dir, "run1"), filepath.Join(dir, "run2")}
+	for _, run := range runs {
+		assert.NoError(t, runTrain([]string{"-run", run, spec}, nil, &stdout))
+	}
+	assert.Contains(t, stdout.String(), "saved run to "+runs[1])
+	assert.NotContains(t, stdout.String(), "saved model to")
+	for _, name := range []string{"config.yaml", "metrics.csv", "metrics.jsonl", "model.json", "summary.json", "checkpoints/epoch-0003.json"} {
+		_, err := os.Stat(filepath.Join(runs[0], name))
+		assert.NoError(t, err, name)
+	}
+
+	// an existing run is not overwritten
+	assert.Error(t, runTrain([]string{"-run", runs[0], spec}, nil, &stdout))
+
+	stdout.Reset()
+	assert.NoError(t, runRuns(append([]string{"compare"}, runs...), nil, &stdout))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	for _, column := range []string{"run", "seed", "best score", "accuracy", "loss", "macroF1"} {
+		assert.Contains(t, lines[0], column)
+	}
+	assert.True(t, strings.HasPrefix(lines[1], "run1 "), lines[1])
+	assert.Contains(t, lines[2], "[2 2]")
+
+	assert.Error(t, runRuns([]string{"compare"}, nil, &stdout))
+	assert.Error(t, runRuns([]string{"compare", dir}, nil, &stdout))
+	assert.Error(t, runRuns([]string{"list"}, nil, &stdout))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/gmkvaal/parGoNN/grpcserver"
+	"google.golang.org/grpc"
+)
+
+// listenAndServe serves the handler on addr, and is replaced by tests
+var listenAndServe = http.ListenAndServe
+
+// runServe serves the predictions of saved networks over HTTP, and over gRPC if -grpc is given.
+// Models are given as name=path, or as the path only, served under the file name without extension
+func runServe(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	grpcAddr := fs.String("grpc", "", "address to serve the gRPC prediction service on, disabled if empty")
+	reload := fs.Duration("reload", 5*time.Second, "interval of checking the model files for changes, 0 to disable")
+	batch := fs.Int("batch", 64, "maximum number of inputs predicted together")
+	delay := fs.Duration("delay", 2*time.Millisecond, "maximum time a request waits for other requests to batch with")
+	cores := fs.Int("cores", runtime.NumCPU(), "number of cores predicting in parallel")
+	metrics := fs.Bool("metrics", false, "serve Prometheus metrics at /metrics")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: pargonn serve [-addr host:port] [-grpc host:port] [-reload interval] [-metrics] [name=]path...")
+	}
+
+	s := network.NewServer()
+	s.MaxBatch, s.BatchDelay, s.Cores = *batch, *delay, *cores
+	if *metrics {
+		s.Monitor = network.NewMonitor()
+		network.RecordTimings = true
+	}
+	defer s.Close()
+
+	for _, arg := range fs.Args() {
+		name, path := modelName(arg)
+		if err := s.Load(name, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "serving %s at /v1/models/%s:predict\n", path, name)
+	}
+	if *reload > 0 {
+		s.WatchModels(*reload)
+	}
+
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		g := grpc.NewServer()
+		grpcserver.Register(g, s)
+		go g.Serve(lis)
+		defer g.Stop()
+		fmt.Fprintf(stdout, "serving gRPC predictions at %s\n", lis.Addr())
+	}
+
+	return listenAndServe(*addr, s)
+}
+
+// modelName splits name=path, or returns the file name of path without extension as the name
+func modelName(arg string) (name, path string) {
+	if idx := strings.Index(arg, "="); idx >= 0 {
+		return arg[:idx], arg[idx+1:]
+	}
+	base := filepath.Base(arg)
+	return strings.TrimSuffix(base, filepath.Ext(base)), arg
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, model := saveTestModel(t, dir)
+
+	defer func(f func(string, http.Handler) error) { listenAndServe = f }(listenAndServe)
+	listenAndServe = func(addr string, handler http.Handler) error {
+		assert.Equal(t, ":9000", addr)
+		for _, name := range []string{"model", "other"} {
+			req := httptest.NewRequest("POST", "/v1/models/"+name+":predict", strings.NewReader(`{"instances": [[0.1, 0.2]]}`))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "predictions")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `pargonn_prediction_duration_seconds_count{model="other"} 1`)
+		return nil
+	}
+
+	var stdout bytes.Buffer
+	defer func() { network.RecordTimings = false }()
+	assert.NoError(t, runServe([]string{"-addr", ":9000", "-reload", "0", "-metrics", "-grpc", "127.0.0.1:0", model, "other=" + model}, nil, &stdout))
+	assert.Contains(t, stdout.String(), "/v1/models/other:predict")
+	assert.Contains(t, stdout.String(), "serving gRPC predictions at 127.0.0.1:")
+
+	assert.Error(t, runServe(nil, nil, &stdout))
+	assert.Error(t, runServe([]string{"missing.json"}, nil, &stdout))
+}
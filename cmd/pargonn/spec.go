@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/gonum/matrix/mat64"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the specification of a network and its training, read from YAML or JSON.
+// Every layer is given by its type (dense if left out) and its configuration, with the
+// same fields as in model files, e.g
+//
+//	input: 784
+//	layers:
+//	  - units: 30
+//	    activation: sigmoid
+//	  - units: 10
+//	    activation: sigmoid
+//	cost: crossEntropy
+//	optimizer: sgd
+//	metric: classification
+//	epochs: 30
+//	batchSize: 10
+//	eta: 0.5
+//	lambda: 5
+//	seed: 1
+//	data:
+//	  train: train.csv
+//	  validation: validation.csv
+//	  label: true
+//	model: model.json
+type Spec struct {
+	Input           int                      `yaml:"input"`
+	Layers          []map[string]interface{} `yaml:"layers"`
+	Cost            string                   `yaml:"cost"`
+	Optimizer       string                   `yaml:"optimizer"`
+	Metric          string                   `yaml:"metric"`
+	Epochs          int                      `yaml:"epochs"`
+	BatchSize       int                      `yaml:"batchSize"`
+	Eta             float64                  `yaml:"eta"`
+	Lambda          float64                  `yaml:"lambda"`
+	Cores           int                      `yaml:"cores"`
+	Shuffle         *bool                    `yaml:"shuffle"`
+	ClipValue       float64                  `yaml:"clipValue"`
+	ClipNorm        float64                  `yaml:"clipNorm"`
+	OnNonFinite     string                   `yaml:"onNonFinite"`
+	Seed            int64                    `yaml:"seed"`
+	CheckpointEvery int                      `yaml:"checkpointEvery"`
+	Data            DataSpec                 `yaml:"data"`
+	Model           string                   `yaml:"model"`
+}
+
+// validationMethods maps the metrics of specs to validation methods
+var validationMethods = map[string]func(n *network.Network, inputData, outputData []*mat64.Vector) bool{
+	"classification": network.ValidateClassification,
+	"regression":     network.ValidateRegression,
+	"multiLabel":     network.ValidateMultiLabel,
+}
+
+// nonFiniteResponses maps the responses to NaN and Inf values of specs to network
+// responses. The values are not checked if the response is left out
+var nonFiniteResponses = map[string]network.NonFiniteResponse{
+	"":         0,
+	"error":    network.StopOnNonFinite,
+	"skip":     network.SkipBatchOnNonFinite,
+	"lowerEta": network.LowerEtaOnNonFinite,
+}
+
+// readSpec reads the spec at path, and sets the defaults of the fields left out
+func readSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so both are read by the YAML decoder
+	spec := &Spec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if spec.Cost == "" {
+		spec.Cost = "crossEntropy"
+	}
+	if spec.Optimizer == "" {
+		spec.Optimizer = "sgd"
+	}
+	if spec.Metric == "" {
+		spec.Metric = "classification"
+	}
+	if spec.Cores <= 0 {
+		spec.Cores = runtime.NumCPU()
+	}
+	if spec.Shuffle == nil {
+		shuffle := true
+		spec.Shuffle = &shuffle
+	}
+
+	return spec, spec.validate()
+}
+
+// validate checks the training parameters of the spec
+func (spec *Spec) validate() error {
+	switch {
+	case spec.Input <= 0:
+		return fmt.Errorf("spec needs a positive input size")
+	case len(spec.Layers) == 0:
+		return fmt.Errorf("spec has no layers")
+	case spec.Epochs <= 0 || spec.BatchSize <= 0:
+		return fmt.Errorf("spec needs a positive number of epochs and batch size")
+	case spec.Eta <= 0 || spec.Lambda < 0:
+		return fmt.Errorf("spec needs a positive eta and a non-negative lambda")
+	case spec.CheckpointEvery < 0:
+		return fmt.Errorf("spec needs a non-negative checkpointEvery")
+	case spec.Cost != "crossEntropy":
+		return fmt.Errorf("unknown cost %q, only crossEntropy is supported", spec.Cost)
+	case spec.Optimizer != "sgd":
+		return fmt.Errorf("unknown optimizer %q, only sgd is supported", spec.Optimizer)
+	}
+
+	if _, ok := validationMethods[spec.Metric]; !ok {
+		return fmt.Errorf("unknown metric %q", spec.Metric)
+	}
+	if _, ok := nonFiniteResponses[spec.OnNonFinite]; !ok {
+		return fmt.Errorf("unknown response to NaN and Inf values %q", spec.OnNonFinite)
+	}
+	return nil
+}
+
+// buildNetwork returns the network of the spec, ready for loading data and training.
+// The initial weights are seeded by the seed of the spec, if not zero
+func (spec *Spec) buildNetwork() (*network.Network, error) {
+	n := &network.Network{}
+	if spec.Seed != 0 {
+		n.SeedWeights(spec.Seed)
+	}
+	n.AddLayer(spec.Input, nil, nil)
+
+	for idx, config := range spec.Layers {
+		name := "dense"
+		if t, ok := config["type"]; ok {
+			if name, ok = t.(string); !ok {
+				return nil, fmt.Errorf("layer %d: type is not a string", idx)
+			}
+		}
+
+		fields := make(map[string]interface{})
+		for key, value := range config {
+			if key != "type" {
+				fields[key] = value
+			}
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %v", idx, err)
+		}
+
+		layer, err := network.NewLayer(name, data)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %v", idx, err)
+		}
+		if err := n.Add(layer); err != nil {
+			return nil, err
+		}
+	}
+
+	n.InitNetworkMethods(network.OutputErrorXEntropy, validationMethods[spec.Metric])
+	n.SetGradientClipping(spec.ClipValue, spec.ClipNorm)
+	n.SetNonFiniteResponse(nonFiniteResponses[spec.OnNonFinite])
+
+	return n, nil
+}
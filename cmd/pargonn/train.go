@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/gmkvaal/parGoNN/metrics"
+)
+
+// runTrain trains the network of a spec, printing the results of every epoch,
+// and saves the trained network to the model file. With -run, the spec, metrics,
+// checkpoints, model and summary of the training are saved in a run directory.
+// On SIGINT, the training stops after the current mini batch, and the network is saved to the
+// checkpoint of the unfinished epoch of the run, or else to the model file suffixed .interrupted.
+// The seed of the spec, if not zero, seeds the initial weights and the shuffling
+func runTrain(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	model := fs.String("model", "", "path of the model file, overriding the model of the spec")
+	verbose := fs.Bool("v", false, "log the timings of the training steps")
+	tensorBoard := fs.String("tensorboard", "", "directory of a TensorBoard event file of the training")
+	runDir := fs.String("run", "", "new run directory of the training, see network.Run")
+	metricsAddr := fs.String("metrics", "", "address to serve Prometheus metrics of the training on at /metrics, disabled if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: pargonn train [-model path] [-run dir] [-tensorboard dir] [-metrics host:port] [-v] spec.yaml")
+	}
+
+	spec, err := readSpec(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *model != "" {
+		spec.Model = *model
+	}
+	if spec.Model == "" && *runDir == "" {
+		return fmt.Errorf("no model file given in the spec, with -model or -run")
+	}
+
+	n, err := spec.buildNetwork()
+	if err != nil {
+		return err
+	}
+	if err := loadData(n, spec); err != nil {
+		return err
+	}
+
+	network.LogTimings = *verbose
+	n.SetQuiet(true)
+	n.AddEpochCallback(func(n *network.Network, result network.EpochResult) {
+		fmt.Fprintf(stdout, "epoch %d/%d: %s (%s)\n", result.Epoch+1, spec.Epochs,
+			formatEpoch(result), result.Duration.Round(time.Millisecond))
+	})
+
+	if *metricsAddr != "" {
+		lis, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			return err
+		}
+		defer lis.Close()
+
+		monitor := network.NewMonitor()
+		n.SetMonitor(monitor)
+		network.RecordTimings = true
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", monitor)
+		go http.Serve(lis, mux)
+		fmt.Fprintf(stdout, "serving metrics at http://%s/metrics\n", lis.Addr())
+	}
+
+	var tb *network.TensorBoard
+	if *tensorBoard != "" {
+		if tb, err = network.NewTensorBoard(*tensorBoard); err != nil {
+			return err
+		}
+		n.AddEpochCallback(tb.Epoch)
+	}
+
+	var run *network.Run
+	if *runDir != "" {
+		if run, err = newRun(*runDir, fs.Arg(0), spec); err == nil {
+			err = run.Start(n, spec.Cores, spec.Seed)
+		}
+		if err != nil {
+			if tb != nil {
+				tb.Close()
+			}
+			return err
+		}
+	} else if spec.Seed != 0 {
+		n.SetSeed(spec.Seed)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	validate := spec.Data.Validation != ""
+	history, trainErr := n.TrainContext(ctx, spec.Epochs, spec.BatchSize, spec.Eta, spec.Lambda, *spec.Shuffle, validate, spec.Cores)
+	interrupted := trainErr != nil && trainErr == ctx.Err()
+	stop() // a second SIGINT kills the process while saving
+	if interrupted {
+		fmt.Fprintf(stdout, "interrupted after %d/%d epochs\n", len(history), spec.Epochs)
+		trainErr = nil
+	}
+
+	// the event file and the run are closed whether the training failed or not,
+	// and the error of the training is returned before the errors of closing them
+	err = trainErr
+	if tb != nil {
+		if closeErr := tb.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if run != nil {
+		run.Summary.Interrupted = interrupted
+		if trainErr != nil {
+			run.Summary.Error = trainErr.Error()
+		}
+		if finishErr := run.Finish(n); finishErr != nil {
+			if err == nil {
+				err = finishErr
+			}
+		} else {
+			fmt.Fprintln(stdout, "saved run to", run.Dir)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if interrupted {
+		// the network of the last update is saved as a checkpoint, keeping the model file as is
+		path := spec.Model + ".interrupted"
+		if run != nil {
+			path = run.ModelPath()
+		} else if err := n.SaveFile(path); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "saved interrupted network to", path)
+		return nil
+	}
+	if spec.Model == "" {
+		return nil
+	}
+	if err := n.SaveFile(spec.Model); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "saved model to", spec.Model)
+	return nil
+}
+
+// interruptContext returns a context done on SIGINT, and is replaced by tests
+var interruptContext = func() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// newRun creates the run directory dir, with a snapshot of the spec file
+func newRun(dir, specPath string, spec *Spec) (*network.Run, error) {
+	data, err := ioutil.ReadFile(specPath)
+	if err != nil {
+		return nil, err
+	}
+	run, err := network.NewRun(dir)
+	if err != nil {
+		return nil, err
+	}
+	run.CheckpointEvery = spec.CheckpointEvery
+
+	ext := strings.TrimPrefix(filepath.Ext(specPath), ".")
+	if ext == "" {
+		ext = "yaml"
+	}
+	return run, run.SaveConfig(ext, data)
+}
+
+// loadData loads the training data of the spec, and the validation data if given
+func loadData(n *network.Network, spec *Spec) error {
+	inputs, outputs := n.Sizes[0], n.Sizes[len(n.Sizes)-1]
+	input, output, err := spec.Data.readData(spec.Data.Train, inputs, outputs)
+	if err != nil {
+		return err
+	}
+	if spec.BatchSize > len(input) {
+		return fmt.Errorf("spec batch size %d is larger than the %d training samples of %s", spec.BatchSize, len(input), spec.Data.Train)
+	}
+	n.LoadTrainingData(input, output)
+
+	if spec.Data.Validation != "" {
+		input, output, err := spec.Data.readData(spec.Data.Validation, inputs, outputs)
+		if err != nil {
+			return err
+		}
+		n.LoadValidationData(input, output)
+	}
+	return nil
+}
+
+// formatEpoch returns the training cost and validation metrics of an epoch
+func formatEpoch(result network.EpochResult) string {
+	s := "loss n/a"
+	if !math.IsNaN(result.Loss) {
+		s = fmt.Sprintf("loss %.4f", result.Loss)
+	}
+	if result.Validation != nil {
+		s += ", " + formatResult(result.Validation)
+	}
+	return s
+}
+
+// formatResult returns the main metrics of a validation result
+func formatResult(result metrics.Result) string {
+	switch r := result.(type) {
+	case metrics.ClassificationReport:
+		return fmt.Sprintf("accuracy %.4f, macro F1 %.4f", r.Accuracy, r.Macro.F1)
+	case metrics.RegressionReport:
+		return fmt.Sprintf("MSE %.4g", r.MeanMSE)
+	case metrics.MultiLabelReport:
+		return fmt.Sprintf("micro F1 %.4f, subset accuracy %.4f", r.Micro.F1, r.SubsetAccuracy)
+	}
+	return fmt.Sprintf("score %.4f", result.Score())
+}
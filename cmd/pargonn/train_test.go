@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFile writes content to the file name in dir, and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// writeTrainingData writes a csv file with class labels and a jsonl file with one-hot
+// outputs, for the classes of two inputs: which input is largest
+func writeTrainingData(t *testing.T, dir string) (csvPath, jsonlPath string) {
+	var csvData, jsonlData strings.Builder
+	csvData.WriteString("x0,x1,class\n")
+	for idx := 0; idx < 40; idx++ {
+		x0, x1 := rand.Float64(), rand.Float64()
+		class := 0
+		if x1 > x0 {
+			class = 1
+		}
+		fmt.Fprintf(&csvData, "%v,%v,%d\n", x0, x1, class)
+		fmt.Fprintf(&jsonlData, `{"input": [%v, %v], "output": [%d, %d]}`+"\n", x0, x1, 1-class, class)
+	}
+	return writeFile(t, dir, "train.csv", csvData.String()), writeFile(t, dir, "validation.jsonl", jsonlData.String())
+}
+
+func TestTrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	train, validation := writeTrainingData(t, dir)
+	spec := writeFile(t, dir, "spec.yaml", `
+input: 2
+layers:
+  - units: 4
+    activation: tanh
+  - type: dense
+    units: 2
+    activation: sigmoid
+epochs: 3
+batchSize: 4
+eta: 0.5
+cores: 2
+data:
+  train: `+train+`
+  validation: `+validation+`
+  header: true
+  label: true
+model: `+filepath.Join(dir, "model.json")+`
+`)
+
+	var stdout bytes.Buffer
+	assert.NoError(t, runTrain([]string{spec}, nil, &stdout))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "epoch 1/3: loss "), lines[0])
+	assert.Contains(t, lines[2], "accuracy")
+
+	n, err := network.LoadFile(filepath.Join(dir, "model.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 4, 2}, n.Sizes)
+
+	// JSON specs, and the model path given as a flag
+	jsonSpec := writeFile(t, dir, "spec.json", `{"input": 2, "layers": [{"units": 2, "activation": "sigmoid"}],
+		"epochs": 1, "batchSize": 5, "eta": 1, "metric": "regression", "onNonFinite": "skip",
+		"data": {"train": "`+validation+`"}}`)
+	stdout.Reset()
+	logs := filepath.Join(dir, "logs")
+	defer func() { network.RecordTimings = false }()
+	assert.NoError(t, runTrain([]string{"-model", filepath.Join(dir, "model2.json"), "-tensorboard", logs,
+		"-metrics", "127.0.0.1:0", jsonSpec}, nil, &stdout))
+	assert.Contains(t, stdout.String(), "serving metrics at http://127.0.0.1:")
+	assert.Contains(t, stdout.String(), "saved model to")
+	_, err = os.Stat(filepath.Join(dir, "model2.json"))
+	assert.NoError(t, err)
+	events, err := filepath.Glob(filepath.Join(logs, "events.out.tfevents.*"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+}
+
+func TestTrainSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the same seed gives the same initial weights and shuffling, and so the same model
+	train, _ := writeTrainingData(t, dir)
+	spec := writeFile(t, dir, "spec.yaml", `
+input: 2
+layers: [{units: 3, activation: tanh}, {units: 2, activation: sigmoid}]
+epochs: 2
+batchSize: 4
+eta: 0.5
+seed: 5
+data: {train: `+train+`, header: true, label: true}
+`)
+	var models [][]byte
+	for _, name := range []string{"first.json", "second.json"} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, runTrain([]string{"-model", path, spec}, nil, ioutil.Discard))
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		models = append(models, data)
+	}
+	assert.Equal(t, string(models[0]), string(models[1]))
+}
+
+func TestTrainInterrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(f func() (context.Context, context.CancelFunc)) { interruptContext = f }(interruptContext)
+	interruptContext = func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx, cancel
+	}
+
+	train, _ := writeTrainingData(t, dir)
+	spec := writeFile(t, dir, "spec.yaml", `
+input: 2
+layers: [{units: 2, activation: sigmoid}]
+epochs: 3
+batchSize: 4
+eta: 0.5
+data: {train: `+train+`, header: true, label: true}
+model: `+filepath.Join(dir, "model.json")+`
+`)
+
+	var stdout bytes.Buffer
+	run := filepath.Join(dir, "run")
+	assert.NoError(t, runTrain([]string{"-run", run, spec}, nil, &stdout))
+	assert.Contains(t, stdout.String(), "interrupted after 0/3 epochs")
+	assert.Contains(t, stdout.String(), "saved interrupted network to "+filepath.Join(run, "checkpoints", "epoch-0000.json"))
+	assert.NotContains(t, stdout.String(), "saved model to")
+
+	// the model file is not replaced by the interrupted network
+	_, err = os.Stat(filepath.Join(dir, "model.json"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(run, "model.json"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = network.LoadFile(filepath.Join(run, "checkpoints", "epoch-0000.json"))
+	assert.NoError(t, err)
+	summary, err := network.LoadRunSummary(run)
+	assert.NoError(t, err)
+	assert.True(t, summary.Interrupted)
+	assert.Equal(t, 0, summary.Epochs)
+
+	// without a run, the network is saved next to the model file
+	stdout.Reset()
+	assert.NoError(t, runTrain([]string{spec}, nil, &stdout))
+	assert.Contains(t, stdout.String(), "saved interrupted network to "+filepath.Join(dir, "model.json.interrupted"))
+	_, err = network.LoadFile(filepath.Join(dir, "model.json.interrupted"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "model.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTrainError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the inputs are not valid ids of the embedding, so training fails
+	train, _ := writeTrainingData(t, dir)
+	spec := writeFile(t, dir, "spec.yaml", `
+input: 2
+layers: [{type: embedding, vocabulary: 4, dim: 2}, {units: 2, activation: sigmoid}]
+epochs: 3
+batchSize: 4
+eta: 0.5
+data: {train: `+train+`, header: true, label: true}
+`)
+
+	var stdout bytes.Buffer
+	run := filepath.Join(dir, "run")
+	logs := filepath.Join(dir, "logs")
+	err = runTrain([]string{"-run", run, "-tensorboard", logs, spec}, nil, &stdout)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "embedding: invalid id")
+
+	// the run is finished with the error, and the event file is closed
+	summary, err := network.LoadRunSummary(run)
+	assert.NoError(t, err)
+	assert.Contains(t, summary.Error, "embedding: invalid id")
+	assert.False(t, summary.Interrupted)
+	events, err := filepath.Glob(filepath.Join(logs, "events.out.tfevents.*"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+}
+
+func TestSpecErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pargonn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, spec := range []string{
+		`{"input": 2, "epochs": 1, "batchSize": 1, "eta": 1}`,
+		`{"input": 2, "layers": [{"units": 2}], "epochs": 1, "batchSize": 1, "eta": 1, "optimizer": "adam"}`,
+		`{"input": 2, "layers": [{"units": 2}], "epochs": 1, "batchSize": 1, "eta": 1, "metric": "auc"}`,
+		`{"input": 2, "layers": [{"units": 2}], "epochs": 0, "batchSize": 1, "eta": 1}`,
+	} {
+		_, err := readSpec(writeFile(t, dir, "spec.json", spec))
+		assert.Error(t, err, spec)
+	}
+
+	spec, err := readSpec(writeFile(t, dir, "spec.yaml", `
+input: 2
+layers: [{type: pool, size: 2}]
+epochs: 1
+batchSize: 1
+eta: 1
+`))
+	assert.NoError(t, err)
+	_, err = spec.buildNetwork()
+	assert.EqualError(t, err, `layer 0: unknown layer type "pool"`)
+
+	// Invalid data files
+	ds := DataSpec{Label: true}
+	_, _, err = ds.readData(writeFile(t, dir, "bad.csv", "1,2,3\n"), 2, 2)
+	assert.Error(t, err)
+	_, _, err = ds.readData(writeFile(t, dir, "bad.csv", "1,2\n"), 2, 2)
+	assert.Error(t, err)
+	_, _, err = ds.readData(writeFile(t, dir, "bad.jsonl", `{"input": [1], "output": [0, 1]}`), 2, 2)
+	assert.Error(t, err)
+
+	// Batch sizes larger than the training data
+	train, _ := writeTrainingData(t, dir)
+	spec.Layers[0] = map[string]interface{}{"units": 2, "activation": "sigmoid"}
+	spec.BatchSize = 41
+	spec.Data = DataSpec{Train: train, Header: true, Label: true}
+	n, err := spec.buildNetwork()
+	assert.NoError(t, err)
+	assert.EqualError(t, loadData(n, spec), "spec batch size 41 is larger than the 40 training samples of "+train)
+}
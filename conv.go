@@ -0,0 +1,294 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// Shape is the shape of an image. Images are stored as vectors, channel by channel and row by row
+type Shape struct {
+	Channels int
+	Height   int
+	Width    int
+}
+
+// Size returns the number of entries in an image of the shape
+func (s Shape) Size() int {
+	return s.Channels * s.Height * s.Width
+}
+
+// SpatialLayer is implemented by layers operating on images. When such a layer is added to the
+// network without an input shape, the output shape of the previous layer is used
+type SpatialLayer interface {
+	InputShape() Shape
+	SetInputShape(s Shape)
+	OutputShape() Shape
+}
+
+// checkInputShape checks that the input shape is set and matches the input size
+func checkInputShape(s Shape, inputSize int) error {
+	if s.Channels <= 0 || s.Height <= 0 || s.Width <= 0 {
+		return fmt.Errorf("invalid input shape %v", s)
+	}
+	if s.Size() != inputSize {
+		return fmt.Errorf("input shape %v does not match input size %d", s, inputSize)
+	}
+	return nil
+}
+
+// Conv2D is a 2D convolutional layer with an elementwise activation function. Each of the Filters
+// filters covers Kernel x Kernel pixels of every input channel, moved Stride (default 1) pixels
+// at a time over the input zero padded with Padding pixels. The convolution is computed as a
+// matrix product with the image patches as columns (im2col)
+type Conv2D struct {
+	Input      Shape
+	Filters    int
+	Kernel     int
+	Stride     int
+	Padding    int
+	Activation string
+	activationFunction
+	output  Shape
+	weights *mat64.Dense
+	biases  *mat64.Vector
+	params  []*Param
+	nablaW  []*mat64.Dense
+	nablaB  []*mat64.Vector
+	grads   [][]*mat64.Dense
+	tmpW    []*mat64.Dense
+	cols    []*mat64.Dense
+	dCols   []*mat64.Dense
+	z       []*mat64.Vector
+	a       []*mat64.Vector
+	delta   []*mat64.Vector
+	deltaIn []*mat64.Vector
+	weightSource
+}
+
+func (c *Conv2D) Name() string { return "conv2d" }
+
+func (c *Conv2D) InputShape() Shape { return c.Input }
+
+func (c *Conv2D) SetInputShape(s Shape) { c.Input = s }
+
+func (c *Conv2D) OutputShape() Shape { return c.output }
+
+// Init initiates the filters and biases with random numbers
+func (c *Conv2D) Init(inputSize int) (int, error) {
+	if err := checkInputShape(c.Input, inputSize); err != nil {
+		return 0, err
+	}
+
+	if c.Stride == 0 {
+		c.Stride = 1
+	}
+
+	if c.Filters <= 0 || c.Kernel <= 0 || c.Stride < 0 || c.Padding < 0 {
+		return 0, fmt.Errorf("invalid filters %d, kernel %d, stride %d or padding %d",
+			c.Filters, c.Kernel, c.Stride, c.Padding)
+	}
+
+	c.output = Shape{
+		Channels: c.Filters,
+		Height:   (c.Input.Height+2*c.Padding-c.Kernel)/c.Stride + 1,
+		Width:    (c.Input.Width+2*c.Padding-c.Kernel)/c.Stride + 1,
+	}
+	if c.Input.Height+2*c.Padding < c.Kernel || c.Input.Width+2*c.Padding < c.Kernel {
+		return 0, fmt.Errorf("kernel %d larger than padded input %v", c.Kernel, c.Input)
+	}
+
+	if c.function == nil {
+		af, ok := activationFunctions[c.Activation]
+		if !ok {
+			return 0, fmt.Errorf("unknown activation function %q", c.Activation)
+		}
+		c.activationFunction = af
+	}
+
+	patchSize := c.Input.Channels * c.Kernel * c.Kernel
+	random := randomFunc(c.rng)
+	c.weights = mat64.NewDense(c.Filters, patchSize, nil)
+	c.weights.Apply(func(i, j int, v float64) float64 { return random(patchSize) }, c.weights)
+	c.biases = sliceWithGonumVector(1, []int{c.Filters}, randomFunc(c.rng))[0]
+	c.params = []*Param{{Value: c.weights, Regularize: true}, {Value: vectorAsDense(c.biases)}}
+
+	return c.output.Size(), nil
+}
+
+// Alloc allocates the containers and gradients for every core
+func (c *Conv2D) Alloc(nCores int) {
+	patchSize := c.Input.Channels * c.Kernel * c.Kernel
+	patches := c.output.Height * c.output.Width
+
+	c.nablaW = sliceWithGonumDense(nCores, repeat(c.Filters, nCores), repeat(patchSize, nCores), zeroFunc())
+	c.tmpW = sliceWithGonumDense(nCores, repeat(c.Filters, nCores), repeat(patchSize, nCores), zeroFunc())
+	c.nablaB = sliceWithGonumVector(nCores, repeat(c.Filters, nCores), zeroFunc())
+	c.cols = sliceWithGonumDense(nCores, repeat(patchSize, nCores), repeat(patches, nCores), zeroFunc())
+	c.dCols = sliceWithGonumDense(nCores, repeat(patchSize, nCores), repeat(patches, nCores), zeroFunc())
+	c.z = sliceWithGonumVector(nCores, repeat(c.output.Size(), nCores), zeroFunc())
+	c.a = sliceWithGonumVector(nCores, repeat(c.output.Size(), nCores), zeroFunc())
+	c.delta = sliceWithGonumVector(nCores, repeat(c.output.Size(), nCores), zeroFunc())
+	c.deltaIn = sliceWithGonumVector(nCores, repeat(c.Input.Size(), nCores), zeroFunc())
+
+	c.grads = make([][]*mat64.Dense, nCores)
+	for proc := range c.grads {
+		c.grads[proc] = []*mat64.Dense{c.nablaW[proc], vectorAsDense(c.nablaB[proc])}
+	}
+}
+
+// im2col writes every (Kernel x Kernel x Channels) patch of the image x
+// as a column of cols, with zeros where the patch covers the padding
+func (c *Conv2D) im2col(x []float64, cols *mat64.Dense) {
+	raw := cols.RawMatrix()
+	for ch := 0; ch < c.Input.Channels; ch++ {
+		for ki := 0; ki < c.Kernel; ki++ {
+			for kj := 0; kj < c.Kernel; kj++ {
+				row := raw.Data[((ch*c.Kernel+ki)*c.Kernel+kj)*raw.Stride:]
+				for oy := 0; oy < c.output.Height; oy++ {
+					y := oy*c.Stride + ki - c.Padding
+					for ox := 0; ox < c.output.Width; ox++ {
+						x0 := ox*c.Stride + kj - c.Padding
+						if y < 0 || y >= c.Input.Height || x0 < 0 || x0 >= c.Input.Width {
+							row[oy*c.output.Width+ox] = 0
+							continue
+						}
+						row[oy*c.output.Width+ox] = x[(ch*c.Input.Height+y)*c.Input.Width+x0]
+					}
+				}
+			}
+		}
+	}
+}
+
+// col2im adds the columns of cols back to the pixels of the image dx they were taken from
+func (c *Conv2D) col2im(cols *mat64.Dense, dx []float64) {
+	for idx := range dx {
+		dx[idx] = 0
+	}
+
+	raw := cols.RawMatrix()
+	for ch := 0; ch < c.Input.Channels; ch++ {
+		for ki := 0; ki < c.Kernel; ki++ {
+			for kj := 0; kj < c.Kernel; kj++ {
+				row := raw.Data[((ch*c.Kernel+ki)*c.Kernel+kj)*raw.Stride:]
+				for oy := 0; oy < c.output.Height; oy++ {
+					y := oy*c.Stride + ki - c.Padding
+					if y < 0 || y >= c.Input.Height {
+						continue
+					}
+					for ox := 0; ox < c.output.Width; ox++ {
+						x0 := ox*c.Stride + kj - c.Padding
+						if x0 < 0 || x0 >= c.Input.Width {
+							continue
+						}
+						dx[(ch*c.Input.Height+y)*c.Input.Width+x0] += row[oy*c.output.Width+ox]
+					}
+				}
+			}
+		}
+	}
+}
+
+// convolve computes the z-s into z and the activations into a, given the patches in cols
+func (c *Conv2D) convolve(x *mat64.Vector, cols *mat64.Dense, z, a *mat64.Vector) {
+	patches := c.output.Height * c.output.Width
+
+	c.im2col(x.RawVector().Data, cols)
+	mat64.NewDense(c.Filters, patches, z.RawVector().Data).Mul(c.weights, cols)
+
+	zData, aData := z.RawVector().Data, a.RawVector().Data
+	for f := 0; f < c.Filters; f++ {
+		for j := f * patches; j < (f+1)*patches; j++ {
+			zData[j] += c.biases.At(f, 0)
+			aData[j] = c.function(zData[j])
+		}
+	}
+}
+
+// Forward computes the z-s and activations of the layer
+func (c *Conv2D) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	if proc == inference {
+		cols := mat64.NewDense(c.Input.Channels*c.Kernel*c.Kernel, c.output.Height*c.output.Width, nil)
+		a := mat64.NewVector(c.output.Size(), nil)
+		c.convolve(x, cols, mat64.NewVector(c.output.Size(), nil), a)
+		return a
+	}
+
+	c.convolve(x, c.cols[proc], c.z[proc], c.a[proc])
+	return c.a[proc]
+}
+
+// Backward multiplies the error at the activations with the differentiated
+// activation function, and backpropagates it with BackwardOutput
+func (c *Conv2D) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	dData, zData := c.delta[proc].RawVector().Data, c.z[proc].RawVector().Data
+	for j := range dData {
+		dData[j] = delta.At(j, 0) * c.prime(zData[j])
+	}
+
+	return c.BackwardOutput(c.delta[proc], proc)
+}
+
+// BackwardOutput adds the gradients given the error at the z-s,
+// and returns the error at the input of the layer
+func (c *Conv2D) BackwardOutput(delta *mat64.Vector, proc int) *mat64.Vector {
+	patches := c.output.Height * c.output.Width
+	dZ := mat64.NewDense(c.Filters, patches, delta.RawVector().Data)
+
+	c.tmpW[proc].Mul(dZ, c.cols[proc].T())
+	c.nablaW[proc].Add(c.nablaW[proc], c.tmpW[proc])
+	for f := 0; f < c.Filters; f++ {
+		var sum float64
+		for _, v := range dZ.RawRowView(f) {
+			sum += v
+		}
+		c.nablaB[proc].SetVec(f, c.nablaB[proc].At(f, 0)+sum)
+	}
+
+	c.dCols[proc].Mul(c.weights.T(), dZ)
+	c.col2im(c.dCols[proc], c.deltaIn[proc].RawVector().Data)
+
+	return c.deltaIn[proc]
+}
+
+// Params returns the filters (one per row) and the biases (as a column matrix)
+func (c *Conv2D) Params() []*Param {
+	return c.params
+}
+
+// Grads returns the filter and bias gradients at proc
+func (c *Conv2D) Grads(proc int) []*mat64.Dense {
+	return c.grads[proc]
+}
+
+// Flatten marks the transition from images to plain vectors, e.g before a dense layer.
+// Since images are stored as vectors, the input is passed on as is
+type Flatten struct {
+	Input Shape
+}
+
+func (f *Flatten) Name() string { return "flatten" }
+
+func (f *Flatten) InputShape() Shape { return f.Input }
+
+func (f *Flatten) SetInputShape(s Shape) { f.Input = s }
+
+func (f *Flatten) OutputShape() Shape { return Shape{Channels: f.Input.Size(), Height: 1, Width: 1} }
+
+func (f *Flatten) Init(inputSize int) (int, error) {
+	if f.Input == (Shape{}) {
+		f.Input = Shape{Channels: inputSize, Height: 1, Width: 1}
+	}
+	return inputSize, checkInputShape(f.Input, inputSize)
+}
+
+func (f *Flatten) Alloc(nCores int) {}
+
+func (f *Flatten) Forward(x *mat64.Vector, proc int) *mat64.Vector { return x }
+
+func (f *Flatten) Backward(delta *mat64.Vector, proc int) *mat64.Vector { return delta }
+
+func (f *Flatten) Params() []*Param { return nil }
+
+func (f *Flatten) Grads(proc int) []*mat64.Dense { return nil }
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConv2DForward(t *testing.T) {
+	c := &Conv2D{Input: Shape{1, 3, 3}, Filters: 1, Kernel: 2, Activation: "identity"}
+	size, err := c.Init(9)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+	assert.Equal(t, Shape{1, 2, 2}, c.OutputShape())
+
+	c.weights.Copy(mat64.NewDense(1, 4, []float64{1, 0, 0, -1}))
+	c.biases.SetVec(0, 0.5)
+
+	x := mat64.NewVector(9, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	assert.Equal(t, []float64{-3.5, -3.5, -3.5, -3.5}, c.Forward(x, inference).RawVector().Data)
+
+	// Zero padding and stride
+	c = &Conv2D{Input: Shape{1, 3, 3}, Filters: 1, Kernel: 3, Stride: 2, Padding: 1, Activation: "identity"}
+	size, err = c.Init(9)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+	c.weights.Copy(mat64.NewDense(1, 9, []float64{0, 0, 0, 0, 1, 0, 0, 0, 0}))
+	c.biases.SetVec(0, 0)
+	assert.Equal(t, []float64{1, 3, 7, 9}, c.Forward(x, inference).RawVector().Data)
+}
+
+func TestConv2DGradients(t *testing.T) {
+	checkLayerGradients(t, &Conv2D{Input: Shape{2, 4, 5}, Filters: 3, Kernel: 3, Stride: 1, Padding: 1, Activation: "sigmoid"}, 40)
+	checkLayerGradients(t, &Conv2D{Input: Shape{1, 5, 5}, Filters: 2, Kernel: 2, Stride: 2, Activation: "sigmoid"}, 25)
+}
+
+func TestPooling(t *testing.T) {
+	x := mat64.NewVector(8, []float64{1, 5, 2, 0, 3, 4, 8, 6})
+
+	m := NewMaxPool2D(2, 0)
+	m.SetInputShape(Shape{2, 2, 2})
+	size, err := m.Init(8)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size)
+	assert.Equal(t, []float64{5, 8}, m.Forward(x, inference).RawVector().Data)
+
+	a := NewAvgPool2D(2, 0)
+	a.SetInputShape(Shape{2, 2, 2})
+	_, err = a.Init(8)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{2, 5.25}, a.Forward(x, inference).RawVector().Data)
+}
+
+func TestPoolingGradients(t *testing.T) {
+	m := NewMaxPool2D(2, 1)
+	m.SetInputShape(Shape{2, 4, 4})
+	checkLayerGradients(t, m, 32)
+
+	a := NewAvgPool2D(2, 2)
+	a.SetInputShape(Shape{1, 4, 6})
+	checkLayerGradients(t, a, 24)
+}
+
+func TestConvNetwork(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(36, nil, nil)
+	assert.NoError(t, n.Add(&Conv2D{Input: Shape{1, 6, 6}, Filters: 2, Kernel: 3, Padding: 1, Activation: "sigmoid"}))
+	assert.NoError(t, n.Add(NewMaxPool2D(2, 0)))
+	assert.NoError(t, n.Add(&Flatten{}))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	assert.Equal(t, []int{36, 72, 18, 18, 2}, n.Sizes)
+
+	var input, output [][]float64
+	for idx := 0; idx < 8; idx++ {
+		x := make([]float64, 36)
+		x[idx] = 1
+		input = append(input, x)
+		output = append(output, []float64{float64(idx % 2), float64(1 - idx%2)})
+	}
+	n.LoadTrainingData(input, output)
+	n.TrainNetwork(2, 4, 0.5, 0, true, false, 2)
+	assert.Equal(t, 2, len(n.Predict(input[0])))
+}
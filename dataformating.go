@@ -12,8 +12,14 @@ type data struct {
 	validationInput  []*mat64.Vector
 	validationOutput []*mat64.Vector
 	miniBatches      [][][]*mat64.Vector
+	// the sparse inputs of the samples, nil for dense samples. The slices are nil until
+	// sparse inputs are loaded, and the inputs of the sparse samples are nil
+	trainingSparse   []*SparseVector
+	validationSparse []*SparseVector
+	miniBatchSparse  [][]*SparseVector
 	n                float64
 	miniBatchSize    float64
+	rng              *rand.Rand
 }
 
 func (data *data) LoadTrainingData(trainingInput, trainingOutput [][]float64) {
@@ -22,6 +28,9 @@ func (data *data) LoadTrainingData(trainingInput, trainingOutput [][]float64) {
 			mat64.NewVector(len(trainingInput[idx]), trainingInput[idx]))
 		data.trainingOutput = append(data.trainingOutput,
 			mat64.NewVector(len(trainingOutput[idx]), trainingOutput[idx]))
+		if data.trainingSparse != nil {
+			data.trainingSparse = append(data.trainingSparse, nil)
+		}
 	}
 }
 
@@ -31,6 +40,9 @@ func (data *data) LoadValidationData(validationInput, validationOutput [][]float
 			mat64.NewVector(len(validationInput[idx]), validationInput[idx]))
 		data.validationOutput = append(data.validationOutput,
 			mat64.NewVector(len(validationOutput[idx]), validationOutput[idx]))
+		if data.validationSparse != nil {
+			data.validationSparse = append(data.validationSparse, nil)
+		}
 	}
 }
 
@@ -40,35 +52,38 @@ func (data *data) initSizes(trainingSetLength int, miniBatchSize int) {
 	data.miniBatchSize = float64(miniBatchSize)
 }
 
-// shuffleTrainingData shuffles the training data
+// SetSeed seeds the shuffling of the training data, so that the mini batches of
+// every epoch are the same from run to run. The initial weights are seeded by Network.SeedWeights
+func (data *data) SetSeed(seed int64) {
+	data.rng = rand.New(rand.NewSource(seed))
+}
+
+// shuffleTrainingData shuffles the training data with the source of the data
 func (data *data) shuffleTrainingData() {
 	for i := len(data.trainingInput) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
+		j := data.rng.Intn(i + 1)
 		data.trainingInput[i], data.trainingInput[j] = data.trainingInput[j], data.trainingInput[i]
 		data.trainingOutput[i], data.trainingOutput[j] = data.trainingOutput[j], data.trainingOutput[i]
+		if data.trainingSparse != nil {
+			data.trainingSparse[i], data.trainingSparse[j] = data.trainingSparse[j], data.trainingSparse[i]
+		}
 	}
 }
 
-// shuffleValidationData shuffles the validation data
-func (data *data) shuffleValidationData() {
-	for i := len(data.validationInput) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		data.validationInput[i], data.validationInput[j] = data.validationInput[j], data.validationInput[i]
-		data.validationOutput[i], data.validationOutput[j] = data.validationOutput[j], data.validationOutput[i]
-	}
-}
-
-// shuffleAllData sets a unique seed to initiate unique shuffles
-// and calls shuffleTrainingData and suffleValidationData
+// shuffleAllData creates a source with a unique seed, if SetSeed was not called,
+// to initiate unique shuffles and calls shuffleTrainingData. The validation data
+// is left as is, since its order does not affect the validation
 func (data *data) shuffleAllData() {
-	rand.Seed(time.Now().UnixNano())
+	if data.rng == nil {
+		data.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
 	data.shuffleTrainingData()
-	data.shuffleValidationData()
 }
 
 // miniBatchGenerator generates a new set of miniBatches from the training data.
 // miniBatches contain (numberOfMiniBatches) number of mini batches, each of which contains (miniBatchSize) number
 // of len 2 slices containing the trainingInput and trainingOutput at the respective entries.
+// The sparse inputs of the mini batches, if any, are in miniBatchSparse
 func (data *data) miniBatchGenerator(miniBatchSize int, shuffle bool) {
 
 	if shuffle {
@@ -78,6 +93,10 @@ func (data *data) miniBatchGenerator(miniBatchSize int, shuffle bool) {
 	trainingSetLength := len(data.trainingInput)
 	numberOfMiniBatches := int(trainingSetLength / miniBatchSize)
 	data.miniBatches = make([][][]*mat64.Vector, numberOfMiniBatches, numberOfMiniBatches)
+	data.miniBatchSparse = nil
+	if data.trainingSparse != nil {
+		data.miniBatchSparse = make([][]*SparseVector, numberOfMiniBatches)
+	}
 	data.initSizes(trainingSetLength, miniBatchSize)
 
 	for i := 0; i < numberOfMiniBatches; i++ {
@@ -86,6 +105,9 @@ func (data *data) miniBatchGenerator(miniBatchSize int, shuffle bool) {
 			data.miniBatches[i][j] = []*mat64.Vector{data.trainingInput[i*miniBatchSize+j],
 				data.trainingOutput[i*miniBatchSize+j]}
 		}
+		if data.trainingSparse != nil {
+			data.miniBatchSparse[i] = data.trainingSparse[i*miniBatchSize : (i+1)*miniBatchSize]
+		}
 	}
 }
 
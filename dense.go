@@ -0,0 +1,200 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// Dense is a fully connected layer with an elementwise activation function.
+// The weights are stored as an (input size x Units) matrix
+type Dense struct {
+	Units      int
+	Activation string
+	activationFunction
+	weights *mat64.Dense
+	biases  *mat64.Vector
+	params  []*Param
+	nablaW  []*mat64.Dense
+	nablaB  []*mat64.Vector
+	grads   [][]*mat64.Dense
+	input   []*mat64.Vector
+	sparse  []*SparseVector
+	rows    []rowSet
+	dense   []bool
+	z       []*mat64.Vector
+	a       []*mat64.Vector
+	sp      []*mat64.Vector
+	delta   []*mat64.Vector
+	deltaIn []*mat64.Vector
+	weightSource
+}
+
+// NewDense returns a dense layer with the given number of units and activation function
+func NewDense(units int, activationFunction, activationPrime func(v float64) float64) *Dense {
+	d := &Dense{Units: units}
+	d.function = activationFunction
+	d.prime = activationPrime
+	d.Activation, _ = activationName(d.activationFunction)
+	return d
+}
+
+func (d *Dense) Name() string { return "dense" }
+
+// Init initiates the weights and biases with random numbers
+func (d *Dense) Init(inputSize int) (int, error) {
+	if d.Units <= 0 {
+		return 0, fmt.Errorf("dense layer needs a positive number of units, got %d", d.Units)
+	}
+
+	if d.function == nil {
+		af, ok := activationFunctions[d.Activation]
+		if !ok {
+			return 0, fmt.Errorf("unknown activation function %q", d.Activation)
+		}
+		d.activationFunction = af
+	}
+
+	d.weights = sliceWithGonumDense(1, []int{inputSize}, []int{d.Units}, randomFunc(d.rng))[0]
+	d.biases = sliceWithGonumVector(1, []int{d.Units}, randomFunc(d.rng))[0]
+	d.params = []*Param{{Value: d.weights, Regularize: true}, {Value: vectorAsDense(d.biases)}}
+
+	return d.Units, nil
+}
+
+// Alloc allocates the containers and gradients for every core
+func (d *Dense) Alloc(nCores int) {
+	inputSize, _ := d.weights.Dims()
+	sizes := repeat(d.Units, nCores)
+	inputSizes := repeat(inputSize, nCores)
+
+	d.nablaW = sliceWithGonumDense(nCores, inputSizes, sizes, zeroFunc())
+	d.nablaB = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	d.z = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	d.a = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	d.sp = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	d.delta = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	d.deltaIn = sliceWithGonumVector(nCores, inputSizes, zeroFunc())
+	d.input = make([]*mat64.Vector, nCores)
+	d.sparse = make([]*SparseVector, nCores)
+	d.dense = make([]bool, nCores)
+	d.rows = make([]rowSet, nCores)
+
+	d.grads = make([][]*mat64.Dense, nCores)
+	for proc := range d.grads {
+		d.grads[proc] = []*mat64.Dense{d.nablaW[proc], vectorAsDense(d.nablaB[proc])}
+		d.rows[proc] = newRowSet(inputSize)
+	}
+}
+
+// Forward computes the z-s and activations of the layer
+func (d *Dense) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	if proc == inference {
+		a := mat64.NewVector(d.Units, nil)
+		a.MulVec(d.weights.T(), x)
+		a.AddVec(a, d.biases)
+		for j := 0; j < d.Units; j++ {
+			a.SetVec(j, d.function(a.At(j, 0)))
+		}
+		return a
+	}
+
+	d.input[proc] = x
+	d.sparse[proc] = nil
+	d.z[proc].MulVec(d.weights.T(), x)
+	d.z[proc].AddVec(d.z[proc], d.biases)
+
+	for j := 0; j < d.Units; j++ {
+		d.a[proc].SetVec(j, d.function(d.z[proc].At(j, 0)))
+	}
+
+	return d.a[proc]
+}
+
+// ForwardSparse computes the z-s and activations of the layer for the sparse input x,
+// using only the rows of the weights at its non-zero entries
+func (d *Dense) ForwardSparse(x *SparseVector, proc int) *mat64.Vector {
+	var z, a *mat64.Vector
+	if proc == inference {
+		z, a = mat64.NewVector(d.Units, nil), mat64.NewVector(d.Units, nil)
+	} else {
+		d.input[proc] = nil
+		d.sparse[proc] = x
+		z, a = d.z[proc], d.a[proc]
+	}
+
+	z.CopyVec(d.biases)
+	zData := z.RawVector().Data
+	for idx, i := range x.Indices {
+		v := x.Values[idx]
+		for j, w := range d.weights.RawRowView(i) {
+			zData[j] += v * w
+		}
+	}
+
+	for j := 0; j < d.Units; j++ {
+		a.SetVec(j, d.function(zData[j]))
+	}
+
+	return a
+}
+
+// Backward multiplies the error at the activations with the differentiated
+// activation function, and backpropagates it with BackwardOutput
+func (d *Dense) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	for j := 0; j < d.Units; j++ {
+		d.sp[proc].SetVec(j, d.prime(d.z[proc].At(j, 0)))
+	}
+	d.delta[proc].MulElemVec(delta, d.sp[proc])
+
+	return d.BackwardOutput(d.delta[proc], proc)
+}
+
+// BackwardOutput adds the gradients given the error at the z-s, and returns the error at
+// the input of the layer. For sparse inputs, only the weight gradients of the non-zero
+// entries are added, and the error at the input is not computed
+func (d *Dense) BackwardOutput(delta *mat64.Vector, proc int) *mat64.Vector {
+	d.nablaB[proc].AddVec(d.nablaB[proc], delta)
+
+	if s := d.sparse[proc]; s != nil {
+		for idx, i := range s.Indices {
+			d.rows[proc].add(i)
+			v, row := s.Values[idx], d.nablaW[proc].RawRowView(i)
+			for j, dv := range delta.RawVector().Data {
+				row[j] += v * dv
+			}
+		}
+		return d.deltaIn[proc]
+	}
+
+	d.dense[proc] = true
+	d.nablaW[proc].RankOne(d.nablaW[proc], 1, d.input[proc], delta)
+	d.deltaIn[proc].MulVec(d.weights, delta)
+
+	return d.deltaIn[proc]
+}
+
+// Params returns the weights and the biases (as a column matrix)
+func (d *Dense) Params() []*Param {
+	return d.params
+}
+
+// Grads returns the weight and bias gradients at proc
+func (d *Dense) Grads(proc int) []*mat64.Dense {
+	return d.grads[proc]
+}
+
+// SparseRows returns the weight rows of the sparse inputs at proc. The weights are
+// not sparse if any dense input was used, and the biases are never sparse
+func (d *Dense) SparseRows(i, proc int) ([]int, bool) {
+	if i != 0 || d.dense[proc] {
+		return nil, false
+	}
+	return d.rows[proc].rows, true
+}
+
+// ClearSparseRows forgets the weight rows of the sparse inputs at proc
+func (d *Dense) ClearSparseRows(proc int) {
+	d.rows[proc].clear()
+	d.dense[proc] = false
+}
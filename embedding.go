@@ -0,0 +1,152 @@
+package network
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// Embedding maps integer ids in [0, Vocabulary) to learned vectors of Dim entries. The input
+// is a vector of ids (e.g the words of a sentence), and the output is the vectors of the ids,
+// one after another, which makes the layer usable as the input of recurrent layers. Only the
+// rows of the ids used in a mini batch are updated, and the vectors are not regularized
+type Embedding struct {
+	Vocabulary int
+	Dim        int
+	ids        int
+	table      *mat64.Dense
+	params     []*Param
+	nablaW     []*mat64.Dense
+	grads      [][]*mat64.Dense
+	input      [][]int
+	rows       []rowSet
+	a          []*mat64.Vector
+	deltaIn    []*mat64.Vector
+	weightSource
+}
+
+// NewEmbedding returns an embedding layer for the given number of ids and vector size
+func NewEmbedding(vocabulary, dim int) *Embedding {
+	return &Embedding{Vocabulary: vocabulary, Dim: dim}
+}
+
+func (e *Embedding) Name() string { return "embedding" }
+
+// Init initiates the vectors with random numbers
+func (e *Embedding) Init(inputSize int) (int, error) {
+	if e.Vocabulary <= 0 || e.Dim <= 0 {
+		return 0, fmt.Errorf("invalid vocabulary %d or dim %d", e.Vocabulary, e.Dim)
+	}
+
+	e.ids = inputSize
+	random := randomFunc(e.rng)
+	e.table = mat64.NewDense(e.Vocabulary, e.Dim, nil)
+	e.table.Apply(func(i, j int, v float64) float64 { return random(e.Dim) }, e.table)
+	e.params = []*Param{{Value: e.table}}
+
+	return e.ids * e.Dim, nil
+}
+
+// Alloc allocates the containers and gradients for every core
+func (e *Embedding) Alloc(nCores int) {
+	e.nablaW = sliceWithGonumDense(nCores, repeat(e.Vocabulary, nCores), repeat(e.Dim, nCores), zeroFunc())
+	e.a = sliceWithGonumVector(nCores, repeat(e.ids*e.Dim, nCores), zeroFunc())
+	e.deltaIn = sliceWithGonumVector(nCores, repeat(e.ids, nCores), zeroFunc())
+	e.input = make([][]int, nCores)
+	e.rows = make([]rowSet, nCores)
+
+	e.grads = make([][]*mat64.Dense, nCores)
+	for proc := range e.grads {
+		e.input[proc] = make([]int, e.ids)
+		e.rows[proc] = newRowSet(e.Vocabulary)
+		e.grads[proc] = []*mat64.Dense{e.nablaW[proc]}
+	}
+}
+
+// validID returns whether v is an integer id in [0, Vocabulary)
+func (e *Embedding) validID(v float64) bool {
+	return v == math.Trunc(v) && v >= 0 && v < float64(e.Vocabulary)
+}
+
+// CheckInput returns an error if an entry of x is not a valid id
+func (e *Embedding) CheckInput(x []float64) error {
+	for t, v := range x {
+		if !e.validID(v) {
+			return fmt.Errorf("embedding: invalid id %v at entry %d, expected an integer in [0, %d)", v, t, e.Vocabulary)
+		}
+	}
+	return nil
+}
+
+// id returns entry t of x as an id. Inputs are checked by CheckInput before they are
+// fed to the network, and an invalid id here is a bug that panics
+func (e *Embedding) id(x *mat64.Vector, t int) int {
+	v := x.At(t, 0)
+	if !e.validID(v) {
+		panic(fmt.Sprintf("embedding: invalid id %v at entry %d", v, t))
+	}
+	return int(v)
+}
+
+// Forward looks up the vectors of the ids in x
+func (e *Embedding) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var a *mat64.Vector
+	if proc == inference {
+		a = mat64.NewVector(e.ids*e.Dim, nil)
+	} else {
+		a = e.a[proc]
+	}
+
+	aData := a.RawVector().Data
+	for t := 0; t < e.ids; t++ {
+		id := e.id(x, t)
+		if proc != inference {
+			e.input[proc][t] = id
+		}
+		copy(aData[t*e.Dim:(t+1)*e.Dim], e.table.RawRowView(id))
+	}
+
+	return a
+}
+
+// Backward adds the errors at the vectors to the gradients of their rows. The ids
+// are not differentiable, and the error at the input is always zero
+func (e *Embedding) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	dData := delta.RawVector().Data
+	for t, id := range e.input[proc] {
+		e.rows[proc].add(id)
+		row := e.nablaW[proc].RawRowView(id)
+		for j := range row {
+			row[j] += dData[t*e.Dim+j]
+		}
+	}
+
+	return e.deltaIn[proc]
+}
+
+// Params returns the vectors of the ids as the rows of a matrix
+func (e *Embedding) Params() []*Param {
+	return e.params
+}
+
+// Grads returns the gradients of the vectors at proc
+func (e *Embedding) Grads(proc int) []*mat64.Dense {
+	return e.grads[proc]
+}
+
+// SparseRows returns the rows of the ids used at proc
+func (e *Embedding) SparseRows(i, proc int) ([]int, bool) {
+	return e.rows[proc].rows, true
+}
+
+// ClearSparseRows forgets the rows of the ids used at proc
+func (e *Embedding) ClearSparseRows(proc int) {
+	e.rows[proc].clear()
+}
+
+// SequenceSteps returns the number of ids in the input, so that
+// sequences of ids can be loaded with LoadSequenceTrainingData
+func (e *Embedding) SequenceSteps() int {
+	return e.ids
+}
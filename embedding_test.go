@@ -0,0 +1,65 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedding(t *testing.T) {
+	e := NewEmbedding(4, 2)
+	size, err := e.Init(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, size)
+	e.Alloc(1)
+	e.table.Copy(mat64.NewDense(4, 2, []float64{0, 1, 2, 3, 4, 5, 6, 7}))
+
+	x := mat64.NewVector(3, []float64{2, 0, 2})
+	assert.Equal(t, []float64{4, 5, 0, 1, 4, 5}, e.Forward(x, inference).RawVector().Data)
+
+	e.Forward(x, 0)
+	e.Backward(mat64.NewVector(6, []float64{1, 1, 2, 2, 3, 3}), 0)
+	assert.Equal(t, []float64{2, 2, 0, 0, 4, 4, 0, 0}, e.nablaW[0].RawMatrix().Data)
+
+	rows, ok := e.SparseRows(0, 0)
+	assert.True(t, ok)
+	assert.Equal(t, []int{2, 0}, rows)
+
+	assert.NoError(t, e.CheckInput([]float64{3, 0, 1}))
+	for _, x := range [][]float64{{1, 4, 0}, {1, -1, 0}, {0.5, 1, 2}} {
+		assert.Error(t, e.CheckInput(x))
+	}
+	assert.Panics(t, func() { e.Forward(mat64.NewVector(3, []float64{1, 4, 0}), inference) })
+}
+
+func TestEmbeddingNetwork(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	assert.NoError(t, n.Add(NewEmbedding(6, 3)))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+
+	before := mat64.DenseCopyOf(n.layers[0].Params()[0].Value)
+	n.LoadTrainingData([][]float64{{0, 1}, {1, 2}, {2, 0}, {1, 1}}, [][]float64{{1, 0}, {0, 1}, {1, 0}, {0, 1}})
+	n.TrainNetwork(3, 2, 0.5, 0.1, true, false, 2)
+
+	// Only the vectors of the ids used are updated
+	after := n.layers[0].Params()[0].Value
+	for id := 0; id < 6; id++ {
+		if id < 3 {
+			assert.NotEqual(t, before.RawRowView(id), after.RawRowView(id), "id %d", id)
+		} else {
+			assert.Equal(t, before.RawRowView(id), after.RawRowView(id), "id %d", id)
+		}
+	}
+
+	// invalid ids give errors rather than panics
+	assert.NoError(t, n.CheckInput([]float64{5, 0}))
+	assert.EqualError(t, n.CheckInput([]float64{5, 6}), "embedding: invalid id 6 at entry 1, expected an integer in [0, 6)")
+	assert.EqualError(t, n.CheckInput([]float64{5}), "input has 1 entries, network expects 2")
+	n.LoadTrainingData([][]float64{{0, 1}, {1, 7}}, [][]float64{{1, 0}, {0, 1}})
+	_, err := n.TrainContext(context.Background(), 1, 2, 0.5, 0, true, false, 1)
+	assert.Regexp(t, `^training sample \d+: embedding: invalid id 7 at entry 1`, err.Error())
+}
@@ -0,0 +1,110 @@
+package network
+
+import (
+	"math"
+	"time"
+
+	"github.com/gmkvaal/parGoNN/metrics"
+)
+
+// EpochResult contains the results of a training epoch. Loss is the mean training cost of the
+// epoch (see GradientCheck), and is NaN if the cost of the output layer is not known. Validation
+// is the result appended to the validation history by the validation method, if any.
+// GradientNorms contains the mean (L2) norm of the mean gradients of every layer over the
+// mini batches of the epoch, before clipping, and is zero for layers that are not trained
+type EpochResult struct {
+	Epoch         int
+	Loss          float64
+	Validation    metrics.Result
+	Duration      time.Duration
+	GradientNorms []float64
+}
+
+// EpochCallback is called by TrainNetwork at the end of every epoch
+type EpochCallback func(n *Network, result EpochResult)
+
+// AddEpochCallback adds a callback called at the end of every training epoch,
+// after the callbacks added before it
+func (n *Network) AddEpochCallback(callback EpochCallback) {
+	n.epochCallbacks = append(n.epochCallbacks, callback)
+}
+
+// SetQuiet turns off the printing of the epochs and the training cost in TrainNetwork, and of
+// the hit rate in ValidateArgMaxSlice, e.g when the results are reported by epoch callbacks
+func (n *Network) SetQuiet(quiet bool) {
+	n.quiet = quiet
+}
+
+// StopTraining stops TrainNetwork at the end of the current epoch, e.g from an
+// epoch callback when the validation score stops improving
+func (n *Network) StopTraining() {
+	n.stopped = true
+}
+
+// epochLoss returns the mean training cost of the mini batches of the epoch,
+// and resets the training cost of every core
+func (n *Network) epochLoss() float64 {
+	var sum float64
+	for proc := range n.loss {
+		sum += n.loss[proc]
+		n.loss[proc] = 0
+	}
+
+	samples := 0
+	for _, miniBatch := range n.data.miniBatches {
+		samples += len(miniBatch)
+	}
+	if !n.lossKnown || samples == 0 {
+		return math.NaN()
+	}
+	return sum / float64(samples)
+}
+
+// validationMetrics returns the main metrics of a validation result by name, as
+// logged by TensorBoard and Run. Results of unknown types give their score
+func validationMetrics(result metrics.Result) map[string]float64 {
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case metrics.ClassificationReport:
+		return map[string]float64{"accuracy": r.Accuracy, "macroF1": r.Macro.F1}
+	case metrics.RegressionReport:
+		return map[string]float64{"mse": r.MeanMSE}
+	case metrics.MultiLabelReport:
+		return map[string]float64{"microF1": r.Micro.F1, "subsetAccuracy": r.SubsetAccuracy}
+	}
+	return map[string]float64{"score": result.Score()}
+}
+
+// addGradientNorms adds the norms of the merged gradients of the trained layers
+func (n *Network) addGradientNorms() {
+	if len(n.gradientNorms) != n.l {
+		n.gradientNorms = make([]float64, n.l)
+	}
+
+	for k := n.lowestTrainable(); k < n.l; k++ {
+		if n.frozen[k] {
+			continue
+		}
+		var squares float64
+		for _, grad := range n.layers[k].Grads(0) {
+			squares += sumSquares(grad)
+		}
+		n.gradientNorms[k] += math.Sqrt(squares) / n.data.miniBatchSize
+	}
+	n.normBatches++
+}
+
+// epochGradientNorms returns the mean gradient norms of every layer over the
+// mini batches of the epoch, and resets the summed norms
+func (n *Network) epochGradientNorms() []float64 {
+	norms := make([]float64, n.l)
+	for k := range n.gradientNorms {
+		if n.normBatches > 0 {
+			norms[k] = n.gradientNorms[k] / float64(n.normBatches)
+		}
+		n.gradientNorms[k] = 0
+	}
+	n.normBatches = 0
+	return norms
+}
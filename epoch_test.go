@@ -0,0 +1,102 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/gmkvaal/parGoNN/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEpochCallbacks(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(4, Sigmoid, SigmoidPrime)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateClassification)
+
+	var input, output [][]float64
+	for idx := 0; idx < 20; idx++ {
+		x := []float64{rand.Float64(), rand.Float64()}
+		input = append(input, x)
+		if x[0] > x[1] {
+			output = append(output, []float64{1, 0})
+		} else {
+			output = append(output, []float64{0, 1})
+		}
+	}
+	n.LoadTrainingData(input, output)
+	n.LoadValidationData(input, output)
+
+	var results []EpochResult
+	n.AddEpochCallback(func(n *Network, result EpochResult) {
+		results = append(results, result)
+	})
+	n.TrainNetwork(3, 4, 0.5, 0, true, true, 2)
+
+	assert.Equal(t, 3, len(results))
+	for idx, result := range results {
+		assert.Equal(t, idx, result.Epoch)
+		assert.False(t, math.IsNaN(result.Loss))
+		assert.IsType(t, metrics.ClassificationReport{}, result.Validation)
+	}
+
+	// The loss of a network with an unknown cost is NaN
+	n = &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(2, ReLU, ReLUPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateClassification)
+	n.LoadTrainingData(input, output)
+	n.AddEpochCallback(func(n *Network, result EpochResult) {
+		assert.True(t, math.IsNaN(result.Loss))
+		assert.Nil(t, result.Validation)
+	})
+	n.TrainNetwork(1, 4, 0.5, 0, true, false, 1)
+}
+
+func TestTrainContext(t *testing.T) {
+	n, _ := newTunerNetwork(nil)
+	data := tunerData(20)
+	n.LoadTrainingData(data.Input, data.Output)
+	n.LoadValidationData(data.Input, data.Output)
+	n.SetQuiet(true)
+
+	// cancelled after the second epoch, before the first mini batch of the third
+	ctx, cancel := context.WithCancel(context.Background())
+	n.AddEpochCallback(func(n *Network, result EpochResult) {
+		if result.Epoch == 1 {
+			cancel()
+		}
+	})
+	history, err := n.TrainContext(ctx, 5, 4, 0.5, 0, true, true, 2)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, 1, history[1].Epoch)
+	assert.IsType(t, metrics.ClassificationReport{}, history[1].Validation)
+
+	// the gradients are cleared, and the network can be trained further
+	for k, layer := range n.layers {
+		for proc := 0; proc < n.procs; proc++ {
+			for _, grad := range layer.Grads(proc) {
+				assert.Equal(t, 0.0, sumSquares(grad), "layer %d", k)
+			}
+		}
+	}
+	history, err = n.TrainContext(context.Background(), 2, 4, 0.5, 0, true, false, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.False(t, math.IsNaN(history[1].Loss))
+
+	// errors are returned
+	_, err = (&Network{}).TrainContext(context.Background(), 1, 1, 1, 0, true, false, 1)
+	assert.EqualError(t, err, "Network has no layers")
+	_, err = n.TrainContext(ctx, 1, 4, 0.5, 0, true, false, 2)
+	assert.Equal(t, context.Canceled, err)
+	for _, size := range []int{0, 21} {
+		_, err = n.TrainContext(context.Background(), 1, size, 0.5, 0, true, false, 2)
+		assert.EqualError(t, err, fmt.Sprintf("Invalid mini batch size %d for 20 training samples", size))
+	}
+}
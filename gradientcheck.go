@@ -0,0 +1,174 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// GradientCheck compares the gradients of every layer computed by BackPropAlgorithm for input x
+// and output y with central finite differences of the cost, using steps of size eps. It returns
+// the relative error |analytic - numerical| / (|analytic| + |numerical|) at every layer of the
+// network (as returned by Layers), which is zero for layers without parameters and frozen
+// layers. Relative errors around 1e-7 or less mean the gradients are correct.
+//
+// The cost is the one OutputErrorXEntropy is the gradient of at the output layer: the cross entropy
+// for sigmoid outputs, the quadratic cost for linear outputs and outputs of layers without
+// activation functions, and the matching cost of tanh outputs. The loss weights of graph heads are
+// included. x is fed to the input layer as is (without the preprocessing pipeline), and the
+// regularization of the weights is not included. The check runs on a copy of the layers, so
+// that the training state of the network, such as the gradients of a mini batch, is left as is
+func GradientCheck(n *Network, x, y []float64, eps float64) ([]float64, error) {
+	if n.l == 0 {
+		return nil, fmt.Errorf("network has no layers")
+	}
+	if n.outputErrorFunc == nil {
+		return nil, fmt.Errorf("network methods are not initiated")
+	}
+	if len(x) != n.Sizes[0] || len(y) != n.Sizes[n.l] {
+		return nil, fmt.Errorf("input and output sizes %d and %d do not match network sizes %d and %d",
+			len(x), len(y), n.Sizes[0], n.Sizes[n.l])
+	}
+
+	n, err := copyLayers(n)
+	if err != nil {
+		return nil, err
+	}
+	n.initDataContainers(1, 1)
+	xv := mat64.NewVector(len(x), append([]float64(nil), x...))
+
+	cost := func() (float64, error) {
+		return outputCost(n.layers[n.l-1], n.forwardFeed(xv, nil, inference).RawVector().Data, y)
+	}
+	if _, err := cost(); err != nil {
+		return nil, err
+	}
+
+	for k := range n.layers {
+		n.clearGradientsAtLayer(k, 0)
+	}
+	n.BackPropAlgorithm(xv, mat64.NewVector(len(y), y), 0)
+
+	relativeErrors := make([]float64, n.l)
+	for k, layer := range n.layers {
+		if n.frozen[k] {
+			n.clearGradientsAtLayer(k, 0)
+			continue
+		}
+
+		var diff, analyticNorm, numericalNorm float64
+		for i, param := range layer.Params() {
+			grad := layer.Grads(0)[i]
+			rows, cols := param.Value.Dims()
+			for r := 0; r < rows; r++ {
+				for c := 0; c < cols; c++ {
+					v := param.Value.At(r, c)
+					param.Value.Set(r, c, v+eps)
+					plus, _ := cost()
+					param.Value.Set(r, c, v-eps)
+					minus, _ := cost()
+					param.Value.Set(r, c, v)
+
+					numerical, analytic := (plus-minus)/(2*eps), grad.At(r, c)
+					diff += (analytic - numerical) * (analytic - numerical)
+					analyticNorm += analytic * analytic
+					numericalNorm += numerical * numerical
+				}
+			}
+		}
+
+		if analyticNorm+numericalNorm > 0 {
+			relativeErrors[k] = math.Sqrt(diff) / (math.Sqrt(analyticNorm) + math.Sqrt(numericalNorm))
+		}
+		n.clearGradientsAtLayer(k, 0)
+	}
+
+	return relativeErrors, nil
+}
+
+// copyLayers returns a network with copies of the layers and the methods of n, and
+// without data, so that it can be fed and backpropagated without changing n
+func copyLayers(n *Network) (*Network, error) {
+	c := &Network{Sizes: []int{n.Sizes[0]}, NetworkMethods: n.NetworkMethods}
+	for idx, layer := range n.layers {
+		config, err := json.Marshal(layer)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d (%s) can not be copied: %v", idx, layer.Name(), err)
+		}
+		copied, err := NewLayer(layer.Name(), config)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d (%s) can not be copied: %v", idx, layer.Name(), err)
+		}
+		if err := c.Add(copied); err != nil {
+			return nil, err
+		}
+
+		for i, param := range copied.Params() {
+			param.Value.Copy(layer.Params()[i].Value)
+		}
+		c.frozen[idx] = n.frozen[idx]
+	}
+	return c, nil
+}
+
+// outputCost returns the cost of the output a of the output layer for the output y, which
+// the output error of the network is the gradient of
+func outputCost(layer Layer, a, y []float64) (float64, error) {
+	if _, ok := layer.(OutputLayer); !ok {
+		return activationCost("identity", a, y)
+	}
+
+	switch l := layer.(type) {
+	case *Dense:
+		return activationCost(l.Activation, a, y)
+	case *TimeDistributed:
+		var sum float64
+		for t := 0; t < l.Steps; t++ {
+			c, err := outputCost(l.Layer, a[t*l.outputDim:(t+1)*l.outputDim], y[t*l.outputDim:(t+1)*l.outputDim])
+			if err != nil {
+				return 0, err
+			}
+			sum += c
+		}
+		return sum, nil
+	case *Graph:
+		var sum float64
+		offset := 0
+		for idx, node := range l.outputs {
+			head := Layer(nil)
+			if node.kind == layerNode {
+				head = node.layer
+			}
+			c, err := outputCost(head, a[offset:offset+node.size], y[offset:offset+node.size])
+			if err != nil {
+				return 0, err
+			}
+			sum += l.weights[idx] * c
+			offset += node.size
+		}
+		return sum, nil
+	}
+
+	return 0, fmt.Errorf("no cost known for output layer %s", layer.Name())
+}
+
+// activationCost returns the cost of the outputs a with the given activation function for the
+// output y, with the gradient a - y with respect to the weighted inputs of the activation
+func activationCost(activation string, a, y []float64) (float64, error) {
+	var sum float64
+	for idx := range a {
+		switch activation {
+		case "sigmoid":
+			sum += -y[idx]*math.Log(a[idx]) - (1-y[idx])*math.Log(1-a[idx])
+		case "identity":
+			sum += (a[idx] - y[idx]) * (a[idx] - y[idx]) / 2
+		case "tanh":
+			sum += -math.Log(1-a[idx]*a[idx])/2 - y[idx]*math.Atanh(a[idx])
+		default:
+			return 0, fmt.Errorf("no cost known for activation function %q", activation)
+		}
+	}
+	return sum, nil
+}
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func randomSlice(size int) []float64 {
+	x := make([]float64, size)
+	for i := range x {
+		x[i] = rand.NormFloat64()
+	}
+	return x
+}
+
+func assertGradientCheck(t *testing.T, n *Network, y []float64) {
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	relativeErrors, err := GradientCheck(n, randomSlice(n.Sizes[0]), y, 1e-6)
+	assert.NoError(t, err)
+	assert.Equal(t, len(n.Layers()), len(relativeErrors))
+	for k, e := range relativeErrors {
+		assert.True(t, e < 1e-6, "layer %d (%s): relative error %g", k, n.Layers()[k].Name(), e)
+	}
+}
+
+func TestGradientCheck(t *testing.T) {
+	// Sigmoid outputs with the cross entropy cost
+	n := &Network{}
+	n.AddLayer(5, nil, nil)
+	n.AddLayer(4, Tanh, TanhPrime)
+	n.AddLayer(3, Sigmoid, SigmoidPrime)
+	assertGradientCheck(t, n, []float64{0, 1, 0})
+
+	// Linear and tanh outputs
+	n = &Network{}
+	n.AddLayer(4, nil, nil)
+	n.AddLayer(3, Sigmoid, SigmoidPrime)
+	n.AddLayer(2, Identity, IdentityPrime)
+	assertGradientCheck(t, n, []float64{0.5, -2})
+
+	n = &Network{}
+	n.AddLayer(4, nil, nil)
+	n.AddLayer(2, Tanh, TanhPrime)
+	assertGradientCheck(t, n, []float64{0.5, -0.2})
+
+	// Output layer without an activation function
+	n = &Network{}
+	n.AddLayer(4, nil, nil)
+	n.AddLayer(3, Sigmoid, SigmoidPrime)
+	assert.NoError(t, n.Add(NewLayerNorm()))
+	assertGradientCheck(t, n, []float64{1, 0, -1})
+
+	// Convolutions and recurrent layers
+	n = &Network{}
+	n.AddLayer(16, nil, nil)
+	assert.NoError(t, n.Add(&Conv2D{Input: Shape{1, 4, 4}, Filters: 2, Kernel: 3, Padding: 1, Activation: "tanh"}))
+	assert.NoError(t, n.Add(NewAvgPool2D(2, 0)))
+	assert.NoError(t, n.Add(&Flatten{}))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	assertGradientCheck(t, n, []float64{1, 0})
+
+	n = &Network{}
+	n.AddLayer(6, nil, nil)
+	assert.NoError(t, n.Add(NewLSTM(3, 3, true)))
+	assert.NoError(t, n.Add(NewGRU(2, 3, false)))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	assertGradientCheck(t, n, []float64{0, 1})
+
+	// Graph with weighted heads
+	g := NewGraph()
+	x := g.Input(3)
+	h := g.Layer(NewDense(3, Tanh, TanhPrime), x)
+	g.Output(g.Layer(NewDense(2, Sigmoid, SigmoidPrime), g.Add(x, h)), 1)
+	g.Output(g.Layer(NewDense(1, Identity, IdentityPrime), h), 0.5)
+	n, err := NewGraphNetwork(g)
+	assert.NoError(t, err)
+	assertGradientCheck(t, n, []float64{1, 0, 0.3})
+}
+
+func TestGradientCheckErrors(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(2, ReLU, ReLUPrime)
+	_, err := GradientCheck(n, []float64{1, 2}, []float64{0, 1}, 1e-6)
+	assert.Error(t, err)
+
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	_, err = GradientCheck(n, []float64{1, 2}, []float64{0, 1}, 1e-6)
+	assert.Error(t, err)
+
+	_, err = GradientCheck(n, []float64{1}, []float64{0, 1}, 1e-6)
+	assert.Error(t, err)
+}
+
+func TestGradientCheckKeepsTrainingState(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(3, nil, nil)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	n.initDataContainers(2, 2)
+	n.BackPropAlgorithm(mat64.NewVector(3, []float64{1, 0, -1}), mat64.NewVector(2, []float64{0, 1}), 0)
+	grads := mat64.DenseCopyOf(n.layers[0].Grads(0)[0])
+	weights := mat64.DenseCopyOf(n.layers[0].Params()[0].Value)
+
+	_, err := GradientCheck(n, []float64{0.5, 0.2, 0}, []float64{1, 0}, 1e-6)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n.procs)
+	assert.True(t, mat64.Equal(grads, n.layers[0].Grads(0)[0]))
+	assert.True(t, mat64.Equal(weights, n.layers[0].Params()[0].Value))
+}
@@ -0,0 +1,468 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// The kinds of graph nodes
+const (
+	inputNode  = "input"
+	layerNode  = "layer"
+	addNode    = "add"
+	concatNode = "concat"
+)
+
+// Node is a node of a Graph: an input, a layer, or a join of other nodes
+type Node struct {
+	kind   string
+	layer  Layer
+	inputs []*Node
+	index  int
+	size   int
+	offset int
+	output bool
+	a      []*mat64.Vector
+	delta  []*mat64.Vector
+}
+
+// Size returns the output size of the node. The size of layer and join nodes is known once
+// the graph is initiated, e.g when added to a network
+func (node *Node) Size() int {
+	return node.size
+}
+
+// Graph is a layer made of nodes connected as a directed acyclic graph, such as residual blocks,
+// models with several inputs, and models with several output heads. Nodes are created from
+// nodes created before them, with Input, Layer, Add and Concat. The input of the graph is the
+// inputs concatenated in the order they were created, and the output is the outputs (heads)
+// concatenated in the order they were marked with Output. When the graph is the output layer
+// of the network, the output error of every head is scaled by its loss weight
+type Graph struct {
+	nodes      []*Node
+	inputs     []*Node
+	outputs    []*Node
+	weights    []float64
+	inputSize  int
+	outputSize int
+	params     []*Param
+	owners     []paramOwner
+	grads      [][]*mat64.Dense
+	a          []*mat64.Vector
+	deltaIn    []*mat64.Vector
+	weightSource
+}
+
+// paramOwner is the layer and index of a parameter of a graph
+type paramOwner struct {
+	layer Layer
+	i     int
+}
+
+// NewGraph returns an empty graph
+func NewGraph() *Graph {
+	return &Graph{}
+}
+
+// NewGraphNetwork returns a network with the inputs of the graph as input layer and the graph as
+// its only layer. The network is ready for InitNetworkMethods, loading data and training
+func NewGraphNetwork(g *Graph) (*Network, error) {
+	n := &Network{Sizes: []int{g.InputSize()}}
+	if err := n.Add(g); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (g *Graph) addNode(node *Node) *Node {
+	node.index = len(g.nodes)
+	g.nodes = append(g.nodes, node)
+	return node
+}
+
+// Input adds an input of the given size
+func (g *Graph) Input(size int) *Node {
+	node := g.addNode(&Node{kind: inputNode, size: size, offset: g.inputSize})
+	g.inputs = append(g.inputs, node)
+	g.inputSize += size
+	return node
+}
+
+// Layer adds a node feeding the output of input through layer. Every node needs its own layer
+func (g *Graph) Layer(layer Layer, input *Node) *Node {
+	return g.addNode(&Node{kind: layerNode, layer: layer, inputs: []*Node{input}})
+}
+
+// Add adds a node summing the outputs of the inputs, which must have the same size
+func (g *Graph) Add(inputs ...*Node) *Node {
+	return g.addNode(&Node{kind: addNode, inputs: inputs})
+}
+
+// Concat adds a node concatenating the outputs of the inputs
+func (g *Graph) Concat(inputs ...*Node) *Node {
+	return g.addNode(&Node{kind: concatNode, inputs: inputs})
+}
+
+// Output marks the node as an output head with the given loss weight. Output heads can not
+// be used as inputs of other nodes
+func (g *Graph) Output(node *Node, weight float64) {
+	node.output = true
+	g.outputs = append(g.outputs, node)
+	g.weights = append(g.weights, weight)
+}
+
+// InputSize returns the size of all the inputs of the graph
+func (g *Graph) InputSize() int {
+	return g.inputSize
+}
+
+// SplitOutputs splits the output of the graph (e.g from Predict) into the outputs of every head
+func (g *Graph) SplitOutputs(a []float64) [][]float64 {
+	heads := make([][]float64, len(g.outputs))
+	offset := 0
+	for idx, node := range g.outputs {
+		heads[idx] = a[offset : offset+node.size]
+		offset += node.size
+	}
+	return heads
+}
+
+func (g *Graph) Name() string { return "graph" }
+
+// Init checks the graph, and initiates the layer of every node in the order the nodes were created
+func (g *Graph) Init(inputSize int) (int, error) {
+	if inputSize != g.inputSize {
+		return 0, fmt.Errorf("graph inputs have size %d, got input size %d", g.inputSize, inputSize)
+	}
+	if len(g.outputs) == 0 {
+		return 0, fmt.Errorf("graph has no outputs")
+	}
+
+	g.params, g.owners = nil, nil
+	layers := make(map[Layer]bool)
+	for _, node := range g.nodes {
+		for _, input := range node.inputs {
+			if input == nil || input.index >= node.index || g.nodes[input.index] != input {
+				return 0, fmt.Errorf("node %d has an input not created before it in the graph", node.index)
+			}
+			if input.output {
+				return 0, fmt.Errorf("output node %d is used as input of node %d", input.index, node.index)
+			}
+		}
+
+		switch node.kind {
+		case layerNode:
+			if layers[node.layer] {
+				return 0, fmt.Errorf("node %d reuses the layer of another node", node.index)
+			}
+			layers[node.layer] = true
+			if _, ok := node.layer.(BatchLayer); ok {
+				return 0, fmt.Errorf("node %d: batch layers are not supported in graphs", node.index)
+			}
+
+			input := node.inputs[0]
+			if spatial, ok := node.layer.(SpatialLayer); ok && spatial.InputShape() == (Shape{}) && input.kind == layerNode {
+				if previous, ok := input.layer.(SpatialLayer); ok {
+					spatial.SetInputShape(previous.OutputShape())
+				}
+			}
+
+			size, err := initLayer(node.layer, input.size, g.rng)
+			if err != nil {
+				return 0, fmt.Errorf("node %d (%s): %v", node.index, node.layer.Name(), err)
+			}
+			node.size = size
+
+			for i, param := range node.layer.Params() {
+				g.params = append(g.params, param)
+				g.owners = append(g.owners, paramOwner{node.layer, i})
+			}
+		case addNode:
+			if len(node.inputs) == 0 {
+				return 0, fmt.Errorf("add node %d has no inputs", node.index)
+			}
+			node.size = node.inputs[0].size
+			for _, input := range node.inputs {
+				if input.size != node.size {
+					return 0, fmt.Errorf("add node %d has inputs of size %d and %d", node.index, node.size, input.size)
+				}
+			}
+		case concatNode:
+			node.size = 0
+			for _, input := range node.inputs {
+				node.size += input.size
+			}
+		}
+
+		if node.size <= 0 {
+			return 0, fmt.Errorf("node %d has size %d", node.index, node.size)
+		}
+	}
+
+	g.outputSize = 0
+	for _, node := range g.outputs {
+		g.outputSize += node.size
+	}
+
+	return g.outputSize, nil
+}
+
+// Alloc allocates the containers of every node and layer for every core
+func (g *Graph) Alloc(nCores int) {
+	for _, node := range g.nodes {
+		if node.kind == layerNode {
+			node.layer.Alloc(nCores)
+		}
+		if node.kind == addNode || node.kind == concatNode {
+			node.a = sliceWithGonumVector(nCores, repeat(node.size, nCores), zeroFunc())
+		}
+		node.delta = sliceWithGonumVector(nCores, repeat(node.size, nCores), zeroFunc())
+	}
+
+	g.a = sliceWithGonumVector(nCores, repeat(g.outputSize, nCores), zeroFunc())
+	g.deltaIn = sliceWithGonumVector(nCores, repeat(g.inputSize, nCores), zeroFunc())
+
+	g.grads = make([][]*mat64.Dense, nCores)
+	for proc := range g.grads {
+		for _, owner := range g.owners {
+			g.grads[proc] = append(g.grads[proc], owner.layer.Grads(proc)[owner.i])
+		}
+	}
+}
+
+// Forward feeds x through the nodes in the order they were created, and
+// returns the outputs of the heads concatenated
+func (g *Graph) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	outputs := make([]*mat64.Vector, len(g.nodes))
+	for _, node := range g.nodes {
+		var a *mat64.Vector
+		if node.kind == addNode || node.kind == concatNode {
+			if proc == inference {
+				a = mat64.NewVector(node.size, nil)
+			} else {
+				a = node.a[proc]
+			}
+		}
+
+		switch node.kind {
+		case inputNode:
+			a = x.ViewVec(node.offset, node.size)
+		case layerNode:
+			a = node.layer.Forward(outputs[node.inputs[0].index], proc)
+		case addNode:
+			a.CopyVec(outputs[node.inputs[0].index])
+			for _, input := range node.inputs[1:] {
+				a.AddVec(a, outputs[input.index])
+			}
+		case concatNode:
+			offset := 0
+			for _, input := range node.inputs {
+				a.ViewVec(offset, input.size).CopyVec(outputs[input.index])
+				offset += input.size
+			}
+		}
+		outputs[node.index] = a
+	}
+
+	var a *mat64.Vector
+	if proc == inference {
+		a = mat64.NewVector(g.outputSize, nil)
+	} else {
+		a = g.a[proc]
+	}
+
+	offset := 0
+	for _, node := range g.outputs {
+		a.ViewVec(offset, node.size).CopyVec(outputs[node.index])
+		offset += node.size
+	}
+
+	return a
+}
+
+// backward backpropagates the error at the heads through the nodes in reverse order.
+// With output, the errors are the output errors of the network, which are scaled by the
+// loss weights, and heads ending in an activation function get them with BackwardOutput
+func (g *Graph) backward(delta *mat64.Vector, proc int, output bool) *mat64.Vector {
+	for _, node := range g.nodes {
+		zeroVec(node.delta[proc])
+	}
+	zeroVec(g.deltaIn[proc])
+
+	offset := 0
+	for idx, node := range g.outputs {
+		weight := 1.0
+		if output {
+			weight = g.weights[idx]
+		}
+		node.delta[proc].AddScaledVec(node.delta[proc], weight, delta.ViewVec(offset, node.size))
+		offset += node.size
+	}
+
+	for k := len(g.nodes) - 1; k >= 0; k-- {
+		node := g.nodes[k]
+		d := node.delta[proc]
+
+		switch node.kind {
+		case inputNode:
+			in := g.deltaIn[proc].ViewVec(node.offset, node.size)
+			in.AddVec(in, d)
+		case layerNode:
+			var in *mat64.Vector
+			if out, ok := node.layer.(OutputLayer); ok && output && node.output {
+				in = out.BackwardOutput(d, proc)
+			} else {
+				in = node.layer.Backward(d, proc)
+			}
+			inputDelta := node.inputs[0].delta[proc]
+			inputDelta.AddVec(inputDelta, in)
+		case addNode:
+			for _, input := range node.inputs {
+				input.delta[proc].AddVec(input.delta[proc], d)
+			}
+		case concatNode:
+			offset := 0
+			for _, input := range node.inputs {
+				input.delta[proc].AddVec(input.delta[proc], d.ViewVec(offset, input.size))
+				offset += input.size
+			}
+		}
+	}
+
+	return g.deltaIn[proc]
+}
+
+// Backward backpropagates the error at the output through the graph
+func (g *Graph) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	return g.backward(delta, proc, false)
+}
+
+// BackwardOutput backpropagates the output error of the network through the graph
+func (g *Graph) BackwardOutput(delta *mat64.Vector, proc int) *mat64.Vector {
+	return g.backward(delta, proc, true)
+}
+
+// Params returns the parameters of every layer of the graph
+func (g *Graph) Params() []*Param {
+	return g.params
+}
+
+// Grads returns the gradients of every layer of the graph at proc
+func (g *Graph) Grads(proc int) []*mat64.Dense {
+	return g.grads[proc]
+}
+
+// SparseRows returns the sparse rows of parameter i if its layer is sparse
+func (g *Graph) SparseRows(i, proc int) ([]int, bool) {
+	if sparse, ok := g.owners[i].layer.(SparseLayer); ok {
+		return sparse.SparseRows(g.owners[i].i, proc)
+	}
+	return nil, false
+}
+
+// ClearSparseRows clears the sparse rows of every sparse layer of the graph
+func (g *Graph) ClearSparseRows(proc int) {
+	for _, node := range g.nodes {
+		if sparse, ok := node.layer.(SparseLayer); ok {
+			sparse.ClearSparseRows(proc)
+		}
+	}
+}
+
+// graphFile is the format in which graphs are saved, as the configuration of the graph
+// layer. The parameters are saved as the parameters of the graph
+type graphFile struct {
+	Nodes   []graphNodeFile `json:"nodes"`
+	Outputs []int           `json:"outputs"`
+	Weights []float64       `json:"weights"`
+}
+
+type graphNodeFile struct {
+	Kind   string          `json:"kind"`
+	Inputs []int           `json:"inputs,omitempty"`
+	Size   int             `json:"size,omitempty"`
+	Type   string          `json:"type,omitempty"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// MarshalJSON returns the nodes of the graph and the configuration of their layers
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	gf := graphFile{Weights: g.weights}
+	for _, node := range g.nodes {
+		nf := graphNodeFile{Kind: node.kind}
+		for _, input := range node.inputs {
+			nf.Inputs = append(nf.Inputs, input.index)
+		}
+
+		switch node.kind {
+		case inputNode:
+			nf.Size = node.size
+		case layerNode:
+			config, err := json.Marshal(node.layer)
+			if err != nil {
+				return nil, fmt.Errorf("node %d (%s): %v", node.index, node.layer.Name(), err)
+			}
+			nf.Type, nf.Config = node.layer.Name(), config
+		}
+		gf.Nodes = append(gf.Nodes, nf)
+	}
+
+	for _, node := range g.outputs {
+		gf.Outputs = append(gf.Outputs, node.index)
+	}
+
+	return json.Marshal(gf)
+}
+
+// UnmarshalJSON rebuilds a graph saved with MarshalJSON
+func (g *Graph) UnmarshalJSON(data []byte) error {
+	var gf graphFile
+	if err := json.Unmarshal(data, &gf); err != nil {
+		return err
+	}
+	if len(gf.Outputs) != len(gf.Weights) {
+		return fmt.Errorf("graph has %d outputs and %d weights", len(gf.Outputs), len(gf.Weights))
+	}
+
+	*g = Graph{}
+	for idx, nf := range gf.Nodes {
+		inputs := make([]*Node, len(nf.Inputs))
+		for i, input := range nf.Inputs {
+			if input < 0 || input >= idx {
+				return fmt.Errorf("node %d has invalid input %d", idx, input)
+			}
+			inputs[i] = g.nodes[input]
+		}
+
+		switch nf.Kind {
+		case inputNode:
+			g.Input(nf.Size)
+		case layerNode:
+			layer, err := NewLayer(nf.Type, nf.Config)
+			if err != nil {
+				return err
+			}
+			if len(inputs) != 1 {
+				return fmt.Errorf("layer node %d has %d inputs", idx, len(inputs))
+			}
+			g.Layer(layer, inputs[0])
+		case addNode:
+			g.Add(inputs...)
+		case concatNode:
+			g.Concat(inputs...)
+		default:
+			return fmt.Errorf("unknown node kind %q", nf.Kind)
+		}
+	}
+
+	for idx, output := range gf.Outputs {
+		if output < 0 || output >= len(g.nodes) {
+			return fmt.Errorf("invalid output node %d", output)
+		}
+		g.Output(g.nodes[output], gf.Weights[idx])
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package network
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphGradients(t *testing.T) {
+	// Residual block
+	g := NewGraph()
+	x := g.Input(4)
+	h := g.Layer(NewDense(4, Sigmoid, SigmoidPrime), x)
+	r := g.Add(x, h)
+	g.Output(g.Layer(NewDense(3, Sigmoid, SigmoidPrime), r), 1)
+	checkLayerGradients(t, g, 4)
+
+	// Two inputs joined by concat, and two heads
+	g = NewGraph()
+	a := g.Input(3)
+	b := g.Input(2)
+	c := g.Concat(g.Layer(NewDense(2, Sigmoid, SigmoidPrime), a), b)
+	g.Output(g.Layer(NewDense(2, Sigmoid, SigmoidPrime), c), 1)
+	g.Output(g.Layer(&Dense{Units: 1, Activation: "identity"}, c), 0.5)
+	checkLayerGradients(t, g, 5)
+}
+
+func TestGraphErrors(t *testing.T) {
+	g := NewGraph()
+	x := g.Input(2)
+	h := g.Layer(NewDense(2, Sigmoid, SigmoidPrime), x)
+	g.Output(h, 1)
+	g.Layer(NewDense(2, Sigmoid, SigmoidPrime), h)
+	_, err := g.Init(2)
+	assert.Error(t, err)
+
+	g = NewGraph()
+	x = g.Input(2)
+	d := NewDense(2, Sigmoid, SigmoidPrime)
+	g.Output(g.Add(g.Layer(d, x), g.Layer(d, x)), 1)
+	_, err = g.Init(2)
+	assert.Error(t, err)
+
+	g = NewGraph()
+	g.Output(g.Add(g.Input(2), g.Input(3)), 1)
+	_, err = g.Init(5)
+	assert.Error(t, err)
+}
+
+func TestGraphNetwork(t *testing.T) {
+	g := NewGraph()
+	image := g.Input(16)
+	tabular := g.Input(2)
+	conv := g.Layer(&Conv2D{Input: Shape{1, 4, 4}, Filters: 2, Kernel: 3, Padding: 1, Activation: "sigmoid"}, image)
+	pool := g.Layer(NewMaxPool2D(2, 0), conv)
+	joined := g.Concat(pool, tabular)
+	hidden := g.Layer(NewDense(8, Sigmoid, SigmoidPrime), joined)
+	residual := g.Add(hidden, g.Layer(NewDense(8, Sigmoid, SigmoidPrime), hidden))
+	class := g.Layer(NewDense(2, Sigmoid, SigmoidPrime), residual)
+	frozen := g.Layer(&Dense{Units: 1, Activation: "identity"}, residual)
+	g.Output(class, 1)
+	g.Output(frozen, 0)
+
+	n, err := NewGraphNetwork(g)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{18, 3}, n.Sizes)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+
+	var input, output [][]float64
+	for idx := 0; idx < 16; idx++ {
+		x := make([]float64, 18)
+		for i := range x {
+			x[i] = rand.Float64()
+		}
+		input = append(input, x)
+		output = append(output, []float64{float64(idx % 2), float64(1 - idx%2), 1})
+	}
+
+	before := mat64.DenseCopyOf(frozen.layer.Params()[0].Value)
+	n.LoadTrainingData(input, output)
+	n.TrainNetwork(2, 4, 0.5, 0, true, false, 2)
+
+	// The head with loss weight zero is not trained
+	assert.Equal(t, before.RawMatrix().Data, frozen.layer.Params()[0].Value.RawMatrix().Data)
+
+	heads := g.SplitOutputs(n.Predict(input[0]))
+	assert.Equal(t, 2, len(heads[0]))
+	assert.Equal(t, 1, len(heads[1]))
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, n.Sizes, loaded.Sizes)
+	assert.Equal(t, n.Predict(input[1]), loaded.Predict(input[1]))
+}
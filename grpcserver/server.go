@@ -0,0 +1,113 @@
+// Package grpcserver serves the predictions of a network.Server over gRPC, with the
+// PredictionService of the predictpb package
+package grpcserver
+
+import (
+	"context"
+	"io"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/gmkvaal/parGoNN/predictpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Service implements the PredictionService with the batched and validated predictions
+// of a network.Server, so HTTP and gRPC requests to a model are batched together
+type Service struct {
+	predictpb.UnimplementedPredictionServiceServer
+	s *network.Server
+}
+
+// New returns the service of the models of s
+func New(s *network.Server) *Service {
+	return &Service{s: s}
+}
+
+// Register registers the service of the models of s with g
+func Register(g *grpc.Server, s *network.Server) {
+	predictpb.RegisterPredictionServiceServer(g, New(s))
+}
+
+// Predict predicts the instances of the request
+func (svc *Service) Predict(ctx context.Context, req *predictpb.PredictRequest) (*predictpb.PredictResponse, error) {
+	return svc.predict(ctx, req)
+}
+
+// PredictStream responds with the predictions of every request on the stream, in order,
+// until the client closes the stream
+func (svc *Service) PredictStream(stream predictpb.PredictionService_PredictStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := svc.predict(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// ModelMetadata returns the layer sizes and model file of the requested model
+func (svc *Service) ModelMetadata(ctx context.Context, req *predictpb.ModelMetadataRequest) (*predictpb.ModelMetadataResponse, error) {
+	metadata, err := svc.s.Metadata(req.GetModel())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	sizes := make([]int32, len(metadata.Sizes))
+	for i, size := range metadata.Sizes {
+		sizes[i] = int32(size)
+	}
+	return &predictpb.ModelMetadataResponse{Model: metadata.Name, Path: metadata.Path, Sizes: sizes}, nil
+}
+
+// predict converts the request to the instances of the server, and the predictions to the
+// response. Unknown models are NotFound, invalid instances InvalidArgument, failed
+// predictions Internal, requests to a closed server Unavailable, and requests whose ctx is
+// done Canceled or DeadlineExceeded
+func (svc *Service) predict(ctx context.Context, req *predictpb.PredictRequest) (*predictpb.PredictResponse, error) {
+	if _, err := svc.s.Metadata(req.GetModel()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	instances := make([][]float64, len(req.GetInstances()))
+	for i, x := range req.GetInstances() {
+		instances[i] = x.GetValues()
+	}
+	predictions, err := svc.s.PredictContext(ctx, req.GetModel(), instances)
+	if err != nil {
+		return nil, status.Error(predictCode(err), err.Error())
+	}
+
+	resp := &predictpb.PredictResponse{Predictions: make([]*predictpb.Vector, len(predictions))}
+	for i, y := range predictions {
+		resp.Predictions[i] = &predictpb.Vector{Values: y}
+	}
+	return resp, nil
+}
+
+// predictCode returns the status code of an error of network.Server.PredictContext
+func predictCode(err error) codes.Code {
+	switch err {
+	case network.ErrServerClosed:
+		return codes.Unavailable
+	case context.Canceled:
+		return codes.Canceled
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	}
+	if _, ok := err.(*network.PredictionError); ok {
+		return codes.Internal
+	}
+	return codes.InvalidArgument
+}
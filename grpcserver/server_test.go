@@ -0,0 +1,102 @@
+package grpcserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	network "github.com/gmkvaal/parGoNN"
+	"github.com/gmkvaal/parGoNN/predictpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grpcserver")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &network.Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(3, network.Tanh, network.TanhPrime)
+	n.AddLayer(2, network.Sigmoid, network.SigmoidPrime)
+	path := filepath.Join(dir, "model.json")
+	assert.NoError(t, n.SaveFile(path))
+
+	s := network.NewServer()
+	defer s.Close()
+	assert.NoError(t, s.Load("xor", path))
+
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	Register(g, s)
+	go g.Serve(lis)
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := predictpb.NewPredictionServiceClient(conn)
+	ctx := context.Background()
+
+	metadata, err := client.ModelMetadata(ctx, &predictpb.ModelMetadataRequest{Model: "xor"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{2, 3, 2}, metadata.Sizes)
+	assert.Equal(t, path, metadata.Path)
+
+	inputs := [][]float64{{0.1, 0.2}, {-1, 3}}
+	req := &predictpb.PredictRequest{Model: "xor"}
+	for _, x := range inputs {
+		req.Instances = append(req.Instances, &predictpb.Vector{Values: x})
+	}
+	resp, err := client.Predict(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, len(inputs), len(resp.Predictions))
+	for i, x := range inputs {
+		assert.InDeltaSlice(t, n.Predict(x), resp.Predictions[i].Values, 1e-12)
+	}
+
+	stream, err := client.PredictStream(ctx)
+	assert.NoError(t, err)
+	for _, x := range inputs {
+		assert.NoError(t, stream.Send(&predictpb.PredictRequest{Model: "xor", Instances: []*predictpb.Vector{{Values: x}}}))
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.InDeltaSlice(t, n.Predict(x), resp.Predictions[0].Values, 1e-12)
+	}
+	assert.NoError(t, stream.CloseSend())
+
+	_, err = client.Predict(ctx, &predictpb.PredictRequest{Model: "other", Instances: req.Instances})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Predict(ctx, &predictpb.PredictRequest{Model: "xor", Instances: []*predictpb.Vector{{Values: []float64{1}}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.ModelMetadata(ctx, &predictpb.ModelMetadataRequest{Model: "other"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	assert.Equal(t, codes.Internal, predictCode(&network.PredictionError{Model: "xor"}))
+	assert.Equal(t, codes.Canceled, predictCode(context.Canceled))
+
+	// requests whose deadline passes while they are batched are DeadlineExceeded
+	slow := network.NewServer()
+	slow.MaxBatch, slow.BatchDelay = 1000, time.Minute
+	defer slow.Close()
+	assert.NoError(t, slow.Load("xor", path))
+	deadline, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = New(slow).Predict(deadline, req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	s.Close()
+	_, err = client.Predict(ctx, req)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
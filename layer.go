@@ -0,0 +1,128 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// inference is passed as proc to Forward when no training containers should be used.
+// Layers then allocate their outputs, so that inference is safe for concurrent use
+const inference = -1
+
+// Layer is a layer of the network. Layers keep separate containers for every core (proc),
+// so that the samples of a mini batch can be processed in parallel
+type Layer interface {
+	// Name returns the name under which the layer type is registered
+	Name() string
+	// Init initiates the parameters of the layer for the given input size, and returns the output size
+	Init(inputSize int) (int, error)
+	// Alloc allocates the containers and gradients used in training at nCores cores
+	Alloc(nCores int)
+	// Forward computes the output of the layer for the input x
+	Forward(x *mat64.Vector, proc int) *mat64.Vector
+	// Backward adds the gradients given the error (derivative of the cost) at the output of the
+	// layer from the last call to Forward, and returns the error at the input of the layer
+	Backward(delta *mat64.Vector, proc int) *mat64.Vector
+	// Params returns the trainable parameters of the layer
+	Params() []*Param
+	// Grads returns the gradients of the parameters accumulated at proc, in the order of Params
+	Grads(proc int) []*mat64.Dense
+}
+
+// OutputLayer is implemented by layers ending in an activation function. At the output layer of the
+// network, the output error is the error before the activation, and is passed to BackwardOutput
+type OutputLayer interface {
+	BackwardOutput(delta *mat64.Vector, proc int) *mat64.Vector
+}
+
+// InputLayer is implemented by layers accepting only some inputs, such as the ids of embeddings.
+// CheckInput is called with the preprocessed inputs of the network when the layer is the first
+// layer, so that invalid inputs give errors before they reach Forward
+type InputLayer interface {
+	CheckInput(x []float64) error
+}
+
+// RandomLayer is implemented by layers initiating their parameters with random numbers.
+// SetRand is called before Init with the source of the network, see Network.SeedWeights
+type RandomLayer interface {
+	SetRand(rng *rand.Rand)
+}
+
+// initLayer initiates the layer, with rng as the source of its random numbers
+func initLayer(layer Layer, inputSize int, rng *rand.Rand) (int, error) {
+	if random, ok := layer.(RandomLayer); ok {
+		random.SetRand(rng)
+	}
+	return layer.Init(inputSize)
+}
+
+// BatchLayer is implemented by layers computing statistics over the whole mini batch, such as
+// batch normalization. Networks with batch layers are trained one layer at a time over the mini
+// batch, with the containers of sample idx at proc idx, and the work split across nCores cores.
+// Forward and Backward are used for single samples outside of training
+type BatchLayer interface {
+	Layer
+	// ForwardBatch computes the outputs of the layer for the samples of a mini batch
+	ForwardBatch(x []*mat64.Vector, nCores int) []*mat64.Vector
+	// BackwardBatch adds the gradients given the errors at the outputs from the
+	// last call to ForwardBatch, and returns the errors at the inputs
+	BackwardBatch(delta []*mat64.Vector, nCores int) []*mat64.Vector
+}
+
+// Param is a trainable parameter of a layer. L2 regularization is applied if Regularize is true.
+// A positive LearningRate is used for the parameter instead of the learning rate of the network
+type Param struct {
+	Value        *mat64.Dense
+	Regularize   bool
+	LearningRate float64
+}
+
+// layerTypes maps layer names to constructors, used when loading saved networks
+var layerTypes = map[string]func() Layer{
+	"dense":     func() Layer { return &Dense{} },
+	"conv2d":    func() Layer { return &Conv2D{} },
+	"maxPool2d": func() Layer { return &MaxPool2D{} },
+	"avgPool2d": func() Layer { return &AvgPool2D{} },
+	"flatten":   func() Layer { return &Flatten{} },
+	"batchNorm": func() Layer { return &BatchNorm{} },
+	"layerNorm": func() Layer { return &LayerNorm{} },
+	"rnn":       func() Layer { return &RNN{} },
+	"lstm":      func() Layer { return &LSTM{} },
+	"gru":       func() Layer { return &GRU{} },
+	"embedding": func() Layer { return &Embedding{} },
+	"graph":     func() Layer { return &Graph{} },
+
+	"timeDistributed":    func() Layer { return &TimeDistributed{} },
+	"multiHeadAttention": func() Layer { return &MultiHeadAttention{} },
+	"positionalEncoding": func() Layer { return &PositionalEncoding{} },
+}
+
+// RegisterLayer makes a custom layer type available when loading saved networks
+func RegisterLayer(name string, newLayer func() Layer) {
+	layerTypes[name] = newLayer
+}
+
+// NewLayer returns a layer of the registered type name, configured with the JSON
+// config (as saved in model files). The layer is initiated when added to a network
+func NewLayer(name string, config []byte) (Layer, error) {
+	newLayer, ok := layerTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown layer type %q", name)
+	}
+
+	layer := newLayer()
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, layer); err != nil {
+			return nil, fmt.Errorf("%s layer: %v", name, err)
+		}
+	}
+	return layer, nil
+}
+
+// vectorAsDense returns a (len x 1) dense sharing the data of the vector v
+func vectorAsDense(v *mat64.Vector) *mat64.Dense {
+	return mat64.NewDense(v.Len(), 1, v.RawVector().Data)
+}
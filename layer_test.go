@@ -0,0 +1,79 @@
+package network
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkLayerGradients compares the input and parameter gradients from Backward with
+// central finite differences of the cost sum(r * output), for random x and r
+func checkLayerGradients(t *testing.T, layer Layer, inputSize int) {
+	outputSize, err := layer.Init(inputSize)
+	assert.NoError(t, err)
+	layer.Alloc(1)
+
+	x := mat64.NewVector(inputSize, nil)
+	for i := 0; i < inputSize; i++ {
+		x.SetVec(i, rand.NormFloat64())
+	}
+	r := mat64.NewVector(outputSize, nil)
+	for i := 0; i < outputSize; i++ {
+		r.SetVec(i, rand.NormFloat64())
+	}
+
+	cost := func() float64 {
+		return mat64.Dot(r, layer.Forward(x, inference))
+	}
+
+	layer.Forward(x, 0)
+	dx := mat64.NewVector(inputSize, nil)
+	dx.CloneVec(layer.Backward(r, 0))
+
+	const eps = 1e-6
+	for i := 0; i < inputSize; i++ {
+		v := x.At(i, 0)
+		x.SetVec(i, v+eps)
+		plus := cost()
+		x.SetVec(i, v-eps)
+		minus := cost()
+		x.SetVec(i, v)
+		assert.InDelta(t, (plus-minus)/(2*eps), dx.At(i, 0), 1e-6, "input %d", i)
+	}
+
+	for p, param := range layer.Params() {
+		grad := layer.Grads(0)[p]
+		rows, cols := param.Value.Dims()
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				v := param.Value.At(i, j)
+				param.Value.Set(i, j, v+eps)
+				plus := cost()
+				param.Value.Set(i, j, v-eps)
+				minus := cost()
+				param.Value.Set(i, j, v)
+				assert.InDelta(t, (plus-minus)/(2*eps), grad.At(i, j), 1e-6, "param %d (%d, %d)", p, i, j)
+			}
+		}
+	}
+}
+
+func TestDenseGradients(t *testing.T) {
+	checkLayerGradients(t, NewDense(4, Sigmoid, SigmoidPrime), 3)
+}
+
+func TestSeedWeights(t *testing.T) {
+	weights := func(seed int64) []float64 {
+		n := &Network{}
+		n.SeedWeights(seed)
+		n.AddLayer(4, nil, nil)
+		d := NewDense(3, Sigmoid, SigmoidPrime)
+		assert.NoError(t, n.Add(d))
+		return mat64.DenseCopyOf(d.Params()[0].Value).RawMatrix().Data
+	}
+	first := weights(1)
+	assert.Equal(t, first, weights(1))
+	assert.NotEqual(t, first, weights(2))
+}
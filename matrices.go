@@ -40,4 +40,43 @@ func sliceWithGonumVector(lenSlice int, vecLen[]int, input func(int) float64) []
 			}
 		}
 	return w
-}
\ No newline at end of file
+}
+
+// repeat returns a slice containing size n times
+func repeat(size, n int) []int {
+	s := make([]int, n)
+	for idx := range s {
+		s[idx] = size
+	}
+	return s
+}
+
+// zeroDense sets every entry of m to zero. Unlike scaling by zero, this also clears NaN and Inf values
+func zeroDense(m *mat64.Dense) {
+	rows, _ := m.Dims()
+	for i := 0; i < rows; i++ {
+		row := m.RawRowView(i)
+		for j := range row {
+			row[j] = 0
+		}
+	}
+}
+
+// zeroVec sets every entry of v to zero
+func zeroVec(v *mat64.Vector) {
+	for i := 0; i < v.Len(); i++ {
+		v.SetVec(i, 0)
+	}
+}
+
+// sumSquares returns the sum of the squared entries of m
+func sumSquares(m *mat64.Dense) float64 {
+	var sum float64
+	rows, _ := m.Dims()
+	for i := 0; i < rows; i++ {
+		for _, v := range m.RawRowView(i) {
+			sum += v * v
+		}
+	}
+	return sum
+}
@@ -0,0 +1,296 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// epsilon clips probabilities away from 0 and 1 in the log loss
+const epsilon = 1e-15
+
+// Averages contains averaged precision, recall and F1 scores
+type Averages struct {
+	Precision float64
+	Recall    float64
+	F1        float64
+}
+
+// ClassificationReport contains the classification metrics of a set of predictions.
+// Confusion[i][j] is the number of samples of class i predicted as class j.
+// ROCAUC and PRAUC are only computed for binary outputs, given by Binary
+type ClassificationReport struct {
+	Classes   int
+	Samples   int
+	Confusion [][]int
+	Accuracy  float64
+	Precision []float64
+	Recall    []float64
+	F1        []float64
+	Macro     Averages
+	Micro     Averages
+	TopK      map[int]float64
+	LogLoss   float64
+	Binary    bool
+	ROCAUC    float64
+	PRAUC     float64
+}
+
+// Score returns the accuracy
+func (r ClassificationReport) Score() float64 {
+	return r.Accuracy
+}
+
+// class returns the class of an output. Outputs of length one are
+// binary, with class 1 if the output is at least 0.5
+func class(y []float64) int {
+	if len(y) == 1 {
+		if y[0] >= 0.5 {
+			return 1
+		}
+		return 0
+	}
+	return argMax(y)
+}
+
+// numberOfClasses returns the number of classes given the output length
+func numberOfClasses(y []float64) int {
+	if len(y) == 1 {
+		return 2
+	}
+	return len(y)
+}
+
+// ConfusionMatrix returns the confusion matrix of the predictions, where
+// entry [i][j] is the number of samples of class i predicted as class j
+func ConfusionMatrix(predictions, targets [][]float64) [][]int {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	classes := numberOfClasses(targets[0])
+	confusion := make([][]int, classes)
+	for i := range confusion {
+		confusion[i] = make([]int, classes)
+	}
+
+	for idx := range predictions {
+		confusion[class(targets[idx])][class(predictions[idx])]++
+	}
+
+	return confusion
+}
+
+// Classification computes the classification report of the predictions,
+// including the top-k accuracy for every k in topK
+func Classification(predictions, targets [][]float64, topK ...int) ClassificationReport {
+	r := ClassificationReport{
+		Samples:   len(targets),
+		Confusion: ConfusionMatrix(predictions, targets),
+		TopK:      make(map[int]float64),
+	}
+	if r.Samples == 0 {
+		return r
+	}
+
+	r.Classes = len(r.Confusion)
+	r.Precision = make([]float64, r.Classes)
+	r.Recall = make([]float64, r.Classes)
+	r.F1 = make([]float64, r.Classes)
+
+	var tpSum, fpSum, fnSum int
+	for c := 0; c < r.Classes; c++ {
+		var tp, fp, fn int
+		for other := 0; other < r.Classes; other++ {
+			if other == c {
+				tp = r.Confusion[c][c]
+				continue
+			}
+			fp += r.Confusion[other][c]
+			fn += r.Confusion[c][other]
+		}
+
+		r.Precision[c], r.Recall[c], r.F1[c] = precisionRecallF1(tp, fp, fn)
+		r.Macro.Precision += r.Precision[c] / float64(r.Classes)
+		r.Macro.Recall += r.Recall[c] / float64(r.Classes)
+		r.Macro.F1 += r.F1[c] / float64(r.Classes)
+
+		tpSum += tp
+		fpSum += fp
+		fnSum += fn
+	}
+
+	r.Micro.Precision, r.Micro.Recall, r.Micro.F1 = precisionRecallF1(tpSum, fpSum, fnSum)
+	r.Accuracy = float64(tpSum) / float64(r.Samples)
+
+	for _, k := range topK {
+		r.TopK[k] = TopKAccuracy(predictions, targets, k)
+	}
+
+	r.LogLoss = LogLoss(predictions, targets)
+
+	if r.Classes == 2 {
+		scores, labels := binaryScores(predictions, targets)
+		r.Binary = true
+		r.ROCAUC = ROCAUC(scores, labels)
+		r.PRAUC = PRAUC(scores, labels)
+	}
+
+	return r
+}
+
+// precisionRecallF1 returns the precision, recall and F1 score given the number of
+// true positives, false positives and false negatives. Undefined scores are set to zero
+func precisionRecallF1(tp, fp, fn int) (precision, recall, f1 float64) {
+	if tp+fp > 0 {
+		precision = float64(tp) / float64(tp+fp)
+	}
+	if tp+fn > 0 {
+		recall = float64(tp) / float64(tp+fn)
+	}
+	if precision+recall > 0 {
+		f1 = 2 * precision * recall / (precision + recall)
+	}
+	return precision, recall, f1
+}
+
+// TopKAccuracy returns the fraction of the samples where the target class
+// is among the k largest entries of the prediction
+func TopKAccuracy(predictions, targets [][]float64, k int) float64 {
+	if len(targets) == 0 {
+		return 0
+	}
+
+	var hits int
+	for idx := range predictions {
+		target := argMax(targets[idx])
+		var larger int
+		for _, v := range predictions[idx] {
+			if v > predictions[idx][target] {
+				larger++
+			}
+		}
+		if larger < k {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(len(targets))
+}
+
+// LogLoss returns the mean cross entropy of the predictions. Outputs of length one
+// are treated as binary probabilities, longer outputs are normalized to sum to one
+func LogLoss(predictions, targets [][]float64) float64 {
+	if len(targets) == 0 {
+		return 0
+	}
+
+	var loss float64
+	for idx := range predictions {
+		p, y := predictions[idx], targets[idx]
+		if len(p) == 1 {
+			q := math.Min(math.Max(p[0], epsilon), 1-epsilon)
+			loss -= y[0]*math.Log(q) + (1-y[0])*math.Log(1-q)
+			continue
+		}
+
+		var sum float64
+		for _, v := range p {
+			sum += v
+		}
+		for c := range p {
+			if y[c] != 0 {
+				loss -= y[c] * math.Log(math.Min(math.Max(p[c]/sum, epsilon), 1-epsilon))
+			}
+		}
+	}
+
+	return loss / float64(len(targets))
+}
+
+// binaryScores returns the score of the positive class and the label of every sample
+func binaryScores(predictions, targets [][]float64) ([]float64, []bool) {
+	scores := make([]float64, len(predictions))
+	labels := make([]bool, len(targets))
+	for idx := range predictions {
+		if len(predictions[idx]) == 1 {
+			scores[idx] = predictions[idx][0]
+		} else {
+			scores[idx] = predictions[idx][1] / (predictions[idx][0] + predictions[idx][1])
+		}
+		labels[idx] = class(targets[idx]) == 1
+	}
+	return scores, labels
+}
+
+// rankByScore returns the indices of the scores sorted by decreasing score
+func rankByScore(scores []float64) []int {
+	order := make([]int, len(scores))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	return order
+}
+
+// ROCAUC returns the area under the receiver operating characteristic curve,
+// i.e. the probability that a random positive sample scores higher than
+// a random negative sample (counting ties as one half)
+func ROCAUC(scores []float64, labels []bool) float64 {
+	order := rankByScore(scores)
+
+	var positives, negatives, area float64
+	for i := 0; i < len(order); {
+		// Samples with equal scores are handled as one step
+		var tiedPositives, tiedNegatives float64
+		j := i
+		for ; j < len(order) && scores[order[j]] == scores[order[i]]; j++ {
+			if labels[order[j]] {
+				tiedPositives++
+			} else {
+				tiedNegatives++
+			}
+		}
+		area += tiedNegatives * (positives + tiedPositives/2)
+		positives += tiedPositives
+		negatives += tiedNegatives
+		i = j
+	}
+
+	if positives == 0 || negatives == 0 {
+		return math.NaN()
+	}
+
+	return area / (positives * negatives)
+}
+
+// PRAUC returns the area under the precision-recall curve,
+// computed as the average precision
+func PRAUC(scores []float64, labels []bool) float64 {
+	order := rankByScore(scores)
+
+	var total float64
+	for _, label := range labels {
+		if label {
+			total++
+		}
+	}
+	if total == 0 {
+		return math.NaN()
+	}
+
+	var truePositives, area float64
+	for i := 0; i < len(order); {
+		var tiedPositives float64
+		j := i
+		for ; j < len(order) && scores[order[j]] == scores[order[i]]; j++ {
+			if labels[order[j]] {
+				tiedPositives++
+			}
+		}
+		truePositives += tiedPositives
+		area += tiedPositives / total * truePositives / float64(j)
+		i = j
+	}
+
+	return area
+}
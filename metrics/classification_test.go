@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfusionMatrix(t *testing.T) {
+	predictions := [][]float64{{0.9, 0.1, 0}, {0.2, 0.7, 0.1}, {0.1, 0.2, 0.7}, {0.6, 0.3, 0.1}}
+	targets := [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 1, 0}, {0, 0, 1}}
+
+	assert.Equal(t, [][]int{{1, 0, 0}, {0, 1, 1}, {1, 0, 0}}, ConfusionMatrix(predictions, targets))
+}
+
+func TestClassification(t *testing.T) {
+	predictions := [][]float64{{0.9, 0.1, 0}, {0.2, 0.7, 0.1}, {0.1, 0.2, 0.7}, {0.6, 0.3, 0.1}}
+	targets := [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 1, 0}, {0, 0, 1}}
+
+	r := Classification(predictions, targets, 1, 2)
+	assert.Equal(t, 3, r.Classes)
+	assert.Equal(t, 0.5, r.Accuracy)
+	assert.Equal(t, []float64{0.5, 1, 0}, r.Precision)
+	assert.Equal(t, []float64{1, 0.5, 0}, r.Recall)
+	assert.InDelta(t, 2.0/3, r.F1[0], 1e-12)
+	assert.InDelta(t, 2.0/3, r.F1[1], 1e-12)
+	assert.InDelta(t, 0.5, r.Macro.Precision, 1e-12)
+	assert.InDelta(t, 0.5, r.Macro.Recall, 1e-12)
+	assert.InDelta(t, 0.5, r.Micro.F1, 1e-12)
+	assert.Equal(t, 0.5, r.TopK[1])
+	assert.Equal(t, 0.75, r.TopK[2])
+	assert.False(t, r.Binary)
+
+	expectedLoss := -(math.Log(0.9) + math.Log(0.7) + math.Log(0.2) + math.Log(0.1)) / 4
+	assert.InDelta(t, expectedLoss, r.LogLoss, 1e-12)
+	assert.Equal(t, r.Accuracy, r.Score())
+}
+
+func TestBinaryClassification(t *testing.T) {
+	predictions := [][]float64{{0.1}, {0.4}, {0.35}, {0.8}}
+	targets := [][]float64{{0}, {0}, {1}, {1}}
+
+	r := Classification(predictions, targets)
+	assert.True(t, r.Binary)
+	assert.Equal(t, [][]int{{2, 0}, {1, 1}}, r.Confusion)
+	assert.InDelta(t, 0.75, r.ROCAUC, 1e-12)
+	assert.InDelta(t, (1+2.0/3)/2, r.PRAUC, 1e-12)
+}
+
+func TestROCAUCTies(t *testing.T) {
+	assert.Equal(t, 0.5, ROCAUC([]float64{0.5, 0.5}, []bool{true, false}))
+	assert.Equal(t, 1.0, ROCAUC([]float64{0.9, 0.2, 0.1}, []bool{true, false, false}))
+	assert.True(t, math.IsNaN(ROCAUC([]float64{0.9, 0.2}, []bool{true, true})))
+}
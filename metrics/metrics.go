@@ -0,0 +1,20 @@
+// Package metrics computes evaluation metrics from network outputs and target outputs
+package metrics
+
+// Result is a structured evaluation result. Score returns a single number
+// summarizing the result, where higher is better
+type Result interface {
+	Score() float64
+}
+
+// argMax returns the index corresponding
+// to the largest entry in slice s
+func argMax(s []float64) int {
+	largestNumberIdx := 0
+	for idx, val := range s {
+		if val > s[largestNumberIdx] {
+			largestNumberIdx = idx
+		}
+	}
+	return largestNumberIdx
+}
@@ -0,0 +1,159 @@
+package metrics
+
+// MultiLabelReport contains the multi-label classification metrics of a set of predictions,
+// where label j of a sample is predicted active if the output is at least Thresholds[j]
+type MultiLabelReport struct {
+	Samples        int
+	Labels         int
+	Thresholds     []float64
+	HammingLoss    float64
+	SubsetAccuracy float64
+	Precision      []float64
+	Recall         []float64
+	F1             []float64
+	Macro          Averages
+	Micro          Averages
+}
+
+// Score returns the micro averaged F1 score
+func (r MultiLabelReport) Score() float64 {
+	return r.Micro.F1
+}
+
+// expandThresholds returns one threshold per label. A single threshold is used for every
+// label, and no thresholds gives the default threshold 0.5
+func expandThresholds(thresholds []float64, labels int) []float64 {
+	if len(thresholds) == labels {
+		return thresholds
+	}
+
+	threshold := 0.5
+	if len(thresholds) > 0 {
+		threshold = thresholds[0]
+	}
+
+	expanded := make([]float64, labels)
+	for j := range expanded {
+		expanded[j] = threshold
+	}
+	return expanded
+}
+
+// ApplyThresholds returns the active labels of the output y given the thresholds,
+// which are either global (length one) or per label
+func ApplyThresholds(y []float64, thresholds []float64) []bool {
+	thresholds = expandThresholds(thresholds, len(y))
+	active := make([]bool, len(y))
+	for j := range y {
+		active[j] = y[j] >= thresholds[j]
+	}
+	return active
+}
+
+// MultiLabel computes the multi-label report of the predictions. The thresholds are either
+// global (length one) or per label. Targets are active where they are at least 0.5
+func MultiLabel(predictions, targets [][]float64, thresholds []float64) MultiLabelReport {
+	r := MultiLabelReport{Samples: len(targets)}
+	if r.Samples == 0 {
+		return r
+	}
+
+	r.Labels = len(targets[0])
+	r.Thresholds = expandThresholds(thresholds, r.Labels)
+	r.Precision = make([]float64, r.Labels)
+	r.Recall = make([]float64, r.Labels)
+	r.F1 = make([]float64, r.Labels)
+
+	tp := make([]int, r.Labels)
+	fp := make([]int, r.Labels)
+	fn := make([]int, r.Labels)
+
+	var wrongLabels, exactMatches int
+	for idx := range predictions {
+		predicted := ApplyThresholds(predictions[idx], r.Thresholds)
+		exact := true
+		for j := range predicted {
+			actual := targets[idx][j] >= 0.5
+			switch {
+			case predicted[j] && actual:
+				tp[j]++
+			case predicted[j]:
+				fp[j]++
+			case actual:
+				fn[j]++
+			}
+			if predicted[j] != actual {
+				wrongLabels++
+				exact = false
+			}
+		}
+		if exact {
+			exactMatches++
+		}
+	}
+
+	var tpSum, fpSum, fnSum int
+	for j := 0; j < r.Labels; j++ {
+		r.Precision[j], r.Recall[j], r.F1[j] = precisionRecallF1(tp[j], fp[j], fn[j])
+		r.Macro.Precision += r.Precision[j] / float64(r.Labels)
+		r.Macro.Recall += r.Recall[j] / float64(r.Labels)
+		r.Macro.F1 += r.F1[j] / float64(r.Labels)
+		tpSum += tp[j]
+		fpSum += fp[j]
+		fnSum += fn[j]
+	}
+
+	r.Micro.Precision, r.Micro.Recall, r.Micro.F1 = precisionRecallF1(tpSum, fpSum, fnSum)
+	r.HammingLoss = float64(wrongLabels) / float64(r.Samples*r.Labels)
+	r.SubsetAccuracy = float64(exactMatches) / float64(r.Samples)
+
+	return r
+}
+
+// TuneThresholds returns the threshold of every label that maximizes the F1 score of the label
+// on the predictions. Labels without active targets get the default threshold 0.5
+func TuneThresholds(predictions, targets [][]float64) []float64 {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	thresholds := make([]float64, len(targets[0]))
+	scores := make([]float64, len(predictions))
+	for j := range thresholds {
+		var positives int
+		for idx := range predictions {
+			scores[idx] = predictions[idx][j]
+			if targets[idx][j] >= 0.5 {
+				positives++
+			}
+		}
+
+		thresholds[j] = 0.5
+		if positives == 0 {
+			continue
+		}
+
+		order := rankByScore(scores)
+
+		// Lowering the threshold through the scores one distinct score at a time
+		var tp, fp int
+		bestF1 := -1.0
+		for i := 0; i < len(order); {
+			k := i
+			for ; k < len(order) && scores[order[k]] == scores[order[i]]; k++ {
+				if targets[order[k]][j] >= 0.5 {
+					tp++
+				} else {
+					fp++
+				}
+			}
+			if _, _, f1 := precisionRecallF1(tp, fp, positives-tp); f1 > bestF1 {
+				bestF1 = f1
+				thresholds[j] = scores[order[i]]
+			}
+			i = k
+		}
+	}
+
+	return thresholds
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiLabel(t *testing.T) {
+	predictions := [][]float64{{0.9, 0.2, 0.6}, {0.1, 0.8, 0.4}, {0.7, 0.6, 0.3}}
+	targets := [][]float64{{1, 0, 1}, {0, 1, 1}, {1, 0, 0}}
+
+	r := MultiLabel(predictions, targets, nil)
+	assert.Equal(t, []float64{0.5, 0.5, 0.5}, r.Thresholds)
+	assert.InDelta(t, 2.0/9, r.HammingLoss, 1e-12)
+	assert.InDelta(t, 1.0/3, r.SubsetAccuracy, 1e-12)
+	assert.Equal(t, []float64{1, 0.5, 1}, r.Precision)
+	assert.Equal(t, []float64{1, 1, 0.5}, r.Recall)
+	assert.InDelta(t, 2.0/3, r.F1[1], 1e-12)
+	assert.InDelta(t, 0.8, r.Micro.F1, 1e-12)
+
+	// Per label thresholds
+	r = MultiLabel(predictions, targets, []float64{0.5, 0.7, 0.35})
+	assert.Equal(t, 0.0, r.HammingLoss)
+	assert.Equal(t, 1.0, r.SubsetAccuracy)
+	assert.Equal(t, r.Micro.F1, r.Score())
+}
+
+func TestTuneThresholds(t *testing.T) {
+	predictions := [][]float64{{0.9, 0.2, 0.6}, {0.1, 0.8, 0.4}, {0.7, 0.6, 0.3}}
+	targets := [][]float64{{1, 0, 1}, {0, 1, 1}, {1, 0, 0}}
+
+	thresholds := TuneThresholds(predictions, targets)
+	assert.Equal(t, []float64{0.7, 0.8, 0.4}, thresholds)
+	assert.Equal(t, 1.0, MultiLabel(predictions, targets, thresholds).SubsetAccuracy)
+}
+
+func TestApplyThresholds(t *testing.T) {
+	assert.Equal(t, []bool{true, false}, ApplyThresholds([]float64{0.3, 0.1}, []float64{0.2}))
+	assert.Equal(t, []bool{false, true}, ApplyThresholds([]float64{0.3, 0.1}, []float64{0.4, 0.1}))
+}
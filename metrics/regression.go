@@ -0,0 +1,74 @@
+package metrics
+
+import "math"
+
+// RegressionReport contains the regression metrics of a set of predictions for every output dimension,
+// along with the mean squared error over all output dimensions. MAPE is computed over the samples
+// with nonzero target only, and is NaN if there are none
+type RegressionReport struct {
+	Samples  int
+	Outputs  int
+	MSE      []float64
+	RMSE     []float64
+	MAE      []float64
+	R2       []float64
+	MAPE     []float64
+	MaxError []float64
+	MeanMSE  float64
+}
+
+// Score returns the negative mean squared error
+func (r RegressionReport) Score() float64 {
+	return -r.MeanMSE
+}
+
+// Regression computes the regression report of the predictions
+func Regression(predictions, targets [][]float64) RegressionReport {
+	r := RegressionReport{Samples: len(targets)}
+	if r.Samples == 0 {
+		return r
+	}
+
+	r.Outputs = len(targets[0])
+	r.MSE = make([]float64, r.Outputs)
+	r.RMSE = make([]float64, r.Outputs)
+	r.MAE = make([]float64, r.Outputs)
+	r.R2 = make([]float64, r.Outputs)
+	r.MAPE = make([]float64, r.Outputs)
+	r.MaxError = make([]float64, r.Outputs)
+
+	N := float64(r.Samples)
+	for j := 0; j < r.Outputs; j++ {
+		var mean, totalSquares float64
+		for idx := range targets {
+			mean += targets[idx][j] / N
+		}
+
+		var nonzero int
+		for idx := range targets {
+			residual := math.Abs(predictions[idx][j] - targets[idx][j])
+			r.MSE[j] += residual * residual / N
+			r.MAE[j] += residual / N
+			r.MaxError[j] = math.Max(r.MaxError[j], residual)
+			totalSquares += (targets[idx][j] - mean) * (targets[idx][j] - mean)
+
+			if targets[idx][j] != 0 {
+				r.MAPE[j] += residual / math.Abs(targets[idx][j])
+				nonzero++
+			}
+		}
+
+		r.RMSE[j] = math.Sqrt(r.MSE[j])
+		r.MAPE[j] /= float64(nonzero)
+		r.MeanMSE += r.MSE[j] / float64(r.Outputs)
+
+		switch {
+		case totalSquares > 0:
+			r.R2[j] = 1 - r.MSE[j]*N/totalSquares
+		case r.MSE[j] == 0:
+			r.R2[j] = 1
+		}
+	}
+
+	return r
+}
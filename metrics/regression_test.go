@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegression(t *testing.T) {
+	predictions := [][]float64{{2.5, 1}, {0, 1}, {2, 1}, {8, 1}}
+	targets := [][]float64{{3, 1}, {-0.5, 1}, {2, 1}, {7, 1}}
+
+	r := Regression(predictions, targets)
+	assert.Equal(t, 2, r.Outputs)
+	assert.InDelta(t, 0.375, r.MSE[0], 1e-12)
+	assert.InDelta(t, math.Sqrt(0.375), r.RMSE[0], 1e-12)
+	assert.InDelta(t, 0.5, r.MAE[0], 1e-12)
+	assert.InDelta(t, 0.9486081370449679, r.R2[0], 1e-12)
+	assert.InDelta(t, (0.5/3+0.5/0.5+0+1.0/7)/4, r.MAPE[0], 1e-12)
+	assert.Equal(t, 1.0, r.MaxError[0])
+
+	// Constant and perfectly predicted output
+	assert.Equal(t, 0.0, r.MSE[1])
+	assert.Equal(t, 1.0, r.R2[1])
+
+	assert.InDelta(t, -0.1875, r.Score(), 1e-12)
+}
@@ -0,0 +1,152 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// modelFile is the format in which networks are saved
+type modelFile struct {
+	Input      int                `json:"input"`
+	Layers     []layerFile        `json:"layers"`
+	Pipeline   []preprocessorFile `json:"pipeline,omitempty"`
+	Thresholds []float64          `json:"thresholds,omitempty"`
+}
+
+// layerFile contains the type and configuration of a layer, the raw (row major)
+// data of every parameter of the layer, and whether the layer is frozen
+type layerFile struct {
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+	Params [][]float64     `json:"params"`
+	Frozen bool            `json:"frozen,omitempty"`
+}
+
+// preprocessorFile contains the type and the fitted parameters of a preprocessor
+type preprocessorFile struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Save writes the layers, parameters, preprocessing pipeline
+// and multi-label thresholds of the network to w
+func (n *Network) Save(w io.Writer) error {
+	if n.l == 0 {
+		return fmt.Errorf("network has no layers to save")
+	}
+
+	mf := modelFile{Input: n.Sizes[0], Thresholds: n.thresholds}
+	for idx, layer := range n.layers {
+		config, err := json.Marshal(layer)
+		if err != nil {
+			return fmt.Errorf("layer %d (%s): %v", idx, layer.Name(), err)
+		}
+
+		lf := layerFile{Type: layer.Name(), Config: config, Frozen: n.frozen[idx]}
+		for _, param := range layer.Params() {
+			lf.Params = append(lf.Params, mat64.DenseCopyOf(param.Value).RawMatrix().Data)
+		}
+		mf.Layers = append(mf.Layers, lf)
+	}
+
+	if n.pipeline != nil {
+		if !n.pipeline.Fitted {
+			return fmt.Errorf("preprocessing pipeline is not fitted")
+		}
+		for _, step := range n.pipeline.Steps {
+			params, err := json.Marshal(step)
+			if err != nil {
+				return err
+			}
+			mf.Pipeline = append(mf.Pipeline, preprocessorFile{Type: step.Name(), Params: params})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(mf)
+}
+
+// SaveFile saves the network to the file at path
+func (n *Network) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := n.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Load reads a network saved with Save. The returned network is ready for Predict
+func Load(r io.Reader) (*Network, error) {
+	var mf modelFile
+	if err := json.NewDecoder(r).Decode(&mf); err != nil {
+		return nil, err
+	}
+
+	if mf.Input <= 0 || len(mf.Layers) == 0 {
+		return nil, fmt.Errorf("inconsistent model file")
+	}
+
+	n := &Network{Sizes: []int{mf.Input}, thresholds: mf.Thresholds}
+	for idx, lf := range mf.Layers {
+		layer, err := NewLayer(lf.Type, lf.Config)
+		if err != nil {
+			return nil, err
+		}
+		if err := n.Add(layer); err != nil {
+			return nil, err
+		}
+
+		params := layer.Params()
+		if len(params) != len(lf.Params) {
+			return nil, fmt.Errorf("layer %d (%s) has %d parameters, file has %d", idx, lf.Type, len(params), len(lf.Params))
+		}
+		for i, param := range params {
+			rows, cols := param.Value.Dims()
+			if rows*cols != len(lf.Params[i]) {
+				return nil, fmt.Errorf("parameter %d of layer %d (%s) does not match the layer size", i, idx, lf.Type)
+			}
+			param.Value.Copy(mat64.NewDense(rows, cols, lf.Params[i]))
+		}
+		n.frozen[idx] = lf.Frozen
+	}
+	if err := n.checkThresholds(n.thresholds); err != nil {
+		return nil, err
+	}
+
+	if len(mf.Pipeline) > 0 {
+		n.pipeline = &Pipeline{Fitted: true}
+		for _, pf := range mf.Pipeline {
+			newPreprocessor, ok := preprocessorTypes[pf.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown preprocessor %q", pf.Type)
+			}
+			step := newPreprocessor()
+			if err := json.Unmarshal(pf.Params, step); err != nil {
+				return nil, err
+			}
+			n.pipeline.Steps = append(n.pipeline.Steps, step)
+		}
+	}
+
+	return n, nil
+}
+
+// LoadFile loads a network from the file at path
+func LoadFile(path string) (*Network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
@@ -0,0 +1,58 @@
+package network
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.AddLayer(3, Sigmoid, SigmoidPrime)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	n.SetPipeline(NewPipeline(&StandardScaler{}))
+
+	var buf bytes.Buffer
+	assert.Error(t, (&Network{}).Save(&buf))
+	assert.Error(t, n.Save(&buf))
+
+	n.LoadTrainingData([][]float64{{0, 10}, {1, 20}, {2, 30}, {3, 40}},
+		[][]float64{{1, 0}, {0, 1}, {1, 0}, {0, 1}})
+	n.TrainNetwork(1, 2, 0.5, 0, false, false, 1)
+
+	assert.NoError(t, n.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, n.Sizes, loaded.Sizes)
+
+	for _, x := range [][]float64{{0, 10}, {1.5, 25}, {3, 40}} {
+		assert.Equal(t, n.Predict(x), loaded.Predict(x))
+	}
+}
+
+func TestSaveAndLoadThresholds(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(3, Sigmoid, SigmoidPrime)
+	assert.NoError(t, n.SetThresholds(0.2, 0.5, 0.7))
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	data := buf.String()
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.2, 0.5, 0.7}, loaded.thresholds)
+	x := []float64{0.1, -0.3}
+	assert.Equal(t, n.PredictLabels(x), loaded.PredictLabels(x))
+
+	// files with thresholds of another length than 1 or the number of labels are rejected
+	_, err = Load(strings.NewReader(strings.Replace(data, "[0.2,0.5,0.7]", "[0.2,0.5]", 1)))
+	assert.EqualError(t, err, "2 thresholds given for 3 labels, expected 1 or 3")
+	loaded, err = Load(strings.NewReader(strings.Replace(data, "[0.2,0.5,0.7]", "[0.3]", 1)))
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.3}, loaded.thresholds)
+}
@@ -0,0 +1,290 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Monitor collects live metrics of training and serving, and serves them in the Prometheus
+// text exposition format, e.g at /metrics. The metrics of a network are collected after
+// n.SetMonitor(m), and the prediction latencies of a server when set as its Monitor:
+//
+//	pargonn_training_epoch                    current epoch, counted from 0
+//	pargonn_training_batch                    mini batches done in the current epoch
+//	pargonn_training_batches                  mini batches per epoch
+//	pargonn_training_loss                     loss of the last epoch
+//	pargonn_training_validation_score         validation score of the last epoch
+//	pargonn_training_samples_total            samples trained on
+//	pargonn_training_samples_per_second       throughput of the current epoch
+//	pargonn_phase_seconds_total{phase}        time spent in the phases timed by TimeTrack
+//	pargonn_phase_calls_total{phase}          calls of the phases timed by TimeTrack
+//	pargonn_goroutines                        number of goroutines
+//	pargonn_prediction_duration_seconds{model} histogram of the prediction latencies
+//
+// The phases are recorded while RecordTimings is set
+type Monitor struct {
+	LatencyBuckets []float64
+
+	mu           sync.Mutex
+	training     bool
+	epoch        int
+	batch        int
+	batches      int
+	loss         float64
+	score        float64
+	samples      int64
+	epochSamples int
+	epochStart   time.Time
+	throughput   float64
+	latencies    map[string]*histogram
+}
+
+// histogram holds the observations of a Prometheus histogram. counts[i] is
+// the number of observations in the bucket ending at LatencyBuckets[i]
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewMonitor returns a monitor with latency buckets from 0.5ms to 1s
+func NewMonitor() *Monitor {
+	return &Monitor{
+		LatencyBuckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		loss:           math.NaN(),
+		score:          math.NaN(),
+		latencies:      make(map[string]*histogram),
+	}
+}
+
+// SetMonitor makes the network report its training progress to m
+func (n *Network) SetMonitor(m *Monitor) {
+	n.monitor = m
+	m.mu.Lock()
+	m.training = true
+	m.mu.Unlock()
+}
+
+// startEpoch resets the progress of the epoch
+func (m *Monitor) startEpoch(epoch, batches int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.epoch, m.batch, m.batches = epoch, 0, batches
+	m.epochSamples = 0
+	m.epochStart = time.Now()
+}
+
+// batchDone adds a mini batch of the given size to the progress of the epoch
+func (m *Monitor) batchDone(size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batch++
+	m.samples += int64(size)
+	m.epochSamples += size
+	if elapsed := time.Since(m.epochStart).Seconds(); elapsed > 0 {
+		m.throughput = float64(m.epochSamples) / elapsed
+	}
+}
+
+// endEpoch records the loss and validation score of the epoch
+func (m *Monitor) endEpoch(result EpochResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loss = result.Loss
+	m.score = validationScore(result)
+}
+
+// ObservePrediction adds the latency of a prediction by the named model
+func (m *Monitor) ObservePrediction(model string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.latencies[model]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.LatencyBuckets))}
+		m.latencies[model] = h
+	}
+	seconds := d.Seconds()
+	if i := sort.SearchFloat64s(m.LatencyBuckets, seconds); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.metrics())
+}
+
+// metrics returns the metrics in the Prometheus text exposition format
+func (m *Monitor) metrics() []byte {
+	var b bytes.Buffer
+
+	m.mu.Lock()
+	if m.training {
+		writeMetric(&b, "pargonn_training_epoch", "gauge", "Current training epoch, counted from 0.", sample{value: float64(m.epoch)})
+		writeMetric(&b, "pargonn_training_batch", "gauge", "Mini batches done in the current epoch.", sample{value: float64(m.batch)})
+		writeMetric(&b, "pargonn_training_batches", "gauge", "Mini batches per epoch.", sample{value: float64(m.batches)})
+		writeMetric(&b, "pargonn_training_loss", "gauge", "Training loss of the last epoch.", sample{value: m.loss})
+		writeMetric(&b, "pargonn_training_validation_score", "gauge", "Validation score of the last epoch.", sample{value: m.score})
+		writeMetric(&b, "pargonn_training_samples_total", "counter", "Samples trained on.", sample{value: float64(m.samples)})
+		writeMetric(&b, "pargonn_training_samples_per_second", "gauge", "Training throughput of the current epoch.", sample{value: m.throughput})
+	}
+	var latencies []sample
+	for _, model := range sortedKeys(m.latencies) {
+		latencies = append(latencies, histogramSamples("pargonn_prediction_duration_seconds", m.LatencyBuckets, m.latencies[model], "model", model)...)
+	}
+	m.mu.Unlock()
+
+	var seconds, calls []sample
+	for _, phase := range recordedPhases() {
+		seconds = append(seconds, sample{labels: []string{"phase", phase.name}, value: float64(atomic.LoadInt64(&phase.nanos)) / 1e9})
+		calls = append(calls, sample{labels: []string{"phase", phase.name}, value: float64(atomic.LoadInt64(&phase.calls))})
+	}
+	writeMetric(&b, "pargonn_phase_seconds_total", "counter", "Time spent in the phases timed by TimeTrack.", seconds...)
+	writeMetric(&b, "pargonn_phase_calls_total", "counter", "Calls of the phases timed by TimeTrack.", calls...)
+	writeMetric(&b, "pargonn_goroutines", "gauge", "Number of goroutines.", sample{value: float64(runtime.NumGoroutine())})
+	writeMetric(&b, "pargonn_prediction_duration_seconds", "histogram", "Latency of predictions by model.", latencies...)
+	return b.Bytes()
+}
+
+// sample is a sample of a metric, with the labels as name, value pairs. The
+// suffix is added to the name of the metric, as for the series of histograms
+type sample struct {
+	suffix string
+	labels []string
+	value  float64
+}
+
+// writeMetric writes the HELP and TYPE lines and the samples of a metric. Metrics without samples are left out
+func writeMetric(b *bytes.Buffer, name, typ, help string, samples ...sample) {
+	if len(samples) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	for _, s := range samples {
+		b.WriteString(name + s.suffix)
+		if len(s.labels) > 0 {
+			b.WriteByte('{')
+			for i := 0; i < len(s.labels); i += 2 {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(b, "%s=\"%s\"", s.labels[i], escapeLabel(s.labels[i+1]))
+			}
+			b.WriteByte('}')
+		}
+		fmt.Fprintf(b, " %s\n", formatValue(s.value))
+	}
+}
+
+// histogramSamples returns the cumulative buckets, sum and count of a histogram with the given labels
+func histogramSamples(name string, buckets []float64, h *histogram, labels ...string) []sample {
+	var samples []sample
+	var cumulative uint64
+	for i, le := range buckets {
+		cumulative += h.counts[i]
+		samples = append(samples, sample{suffix: "_bucket", labels: append(labels[:len(labels):len(labels)], "le", formatValue(le)), value: float64(cumulative)})
+	}
+	samples = append(samples,
+		sample{suffix: "_bucket", labels: append(labels[:len(labels):len(labels)], "le", "+Inf"), value: float64(h.count)},
+		sample{suffix: "_sum", labels: labels, value: h.sum},
+		sample{suffix: "_count", labels: labels, value: float64(h.count)})
+	return samples
+}
+
+// formatValue formats a sample value, with NaN and Inf as in the exposition format
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes backslashes, double quotes and line feeds of label values
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// sortedKeys returns the model names of the histograms in order
+func sortedKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RecordTimings turns the recording of the time spent in the phases timed by TimeTrack
+// on and off. The phases are the functions calling TimeTrack, and are exposed by Monitor
+var RecordTimings = false
+
+// phaseTiming is the number of calls and the total time in nanoseconds of a phase
+type phaseTiming struct {
+	name  string
+	calls int64
+	nanos int64
+}
+
+var (
+	// phaseCallers maps the program counters of the calls to TimeTrack to the timings of their phases
+	phaseCallers sync.Map
+	// phases maps the names of the phases to their timings
+	phases   = make(map[string]*phaseTiming)
+	phasesMu sync.Mutex
+)
+
+// recordPhase adds the elapsed time to the phase of the function calling TimeTrack at pc
+func recordPhase(pc uintptr, elapsed time.Duration) {
+	v, ok := phaseCallers.Load(pc)
+	if !ok {
+		name := "unknown"
+		if f := runtime.FuncForPC(pc); f != nil {
+			name = f.Name()[strings.LastIndex(f.Name(), ".")+1:]
+		}
+		phasesMu.Lock()
+		phase, ok := phases[name]
+		if !ok {
+			phase = &phaseTiming{name: name}
+			phases[name] = phase
+		}
+		phasesMu.Unlock()
+		v, _ = phaseCallers.LoadOrStore(pc, phase)
+	}
+	phase := v.(*phaseTiming)
+	atomic.AddInt64(&phase.calls, 1)
+	atomic.AddInt64(&phase.nanos, int64(elapsed))
+}
+
+// recordedPhases returns the timings of the recorded phases by name
+func recordedPhases() []*phaseTiming {
+	phasesMu.Lock()
+	defer phasesMu.Unlock()
+	timings := make([]*phaseTiming, 0, len(phases))
+	for _, phase := range phases {
+		timings = append(timings, phase)
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i].name < timings[j].name })
+	return timings
+}
@@ -0,0 +1,111 @@
+package network
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape gets the metrics of the handler, and returns the value of every series by name and labels
+func scrape(t *testing.T, handler http.Handler) map[string]float64 {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	series := make(map[string]float64)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			assert.Regexp(t, `^# (HELP|TYPE) pargonn_\w+ `, line)
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[idx+1:], 64)
+		assert.NoError(t, err, line)
+		series[line[:idx]] = v
+	}
+	return series
+}
+
+func TestMonitor(t *testing.T) {
+	RecordTimings = true
+	defer func() { RecordTimings = false }()
+
+	m := NewMonitor()
+	series := scrape(t, m)
+	assert.NotContains(t, series, "pargonn_training_epoch")
+	assert.True(t, series["pargonn_goroutines"] > 0)
+	// the phases are recorded globally, also by earlier runs of the test
+	updates := `pargonn_phase_calls_total{phase="updateWeightsAndBiases"}`
+	before := series[updates]
+
+	n, _ := newTunerNetwork(map[string]float64{"hidden": 3})
+	data := tunerData(20)
+	n.LoadTrainingData(data.Input, data.Output)
+	n.LoadValidationData(data.Input, data.Output)
+	n.SetQuiet(true)
+	n.SetMonitor(m)
+	n.TrainNetwork(3, 4, 0.5, 0, true, true, 2)
+
+	series = scrape(t, m)
+	assert.Equal(t, 2.0, series["pargonn_training_epoch"])
+	assert.Equal(t, 5.0, series["pargonn_training_batch"])
+	assert.Equal(t, 5.0, series["pargonn_training_batches"])
+	assert.Equal(t, 60.0, series["pargonn_training_samples_total"])
+	assert.True(t, series["pargonn_training_samples_per_second"] > 0)
+	assert.True(t, series["pargonn_training_loss"] > 0)
+	assert.Contains(t, series, "pargonn_training_validation_score")
+	assert.Equal(t, before+15, series[updates])
+	assert.True(t, series[`pargonn_phase_seconds_total{phase="forwardFeed"}`] > 0)
+
+	m.ObservePrediction(`a"b`, 3*time.Millisecond)
+	m.ObservePrediction(`a"b`, 2*time.Second)
+	series = scrape(t, m)
+	assert.Equal(t, 0.0, series[`pargonn_prediction_duration_seconds_bucket{model="a\"b",le="0.0025"}`])
+	assert.Equal(t, 1.0, series[`pargonn_prediction_duration_seconds_bucket{model="a\"b",le="0.005"}`])
+	assert.Equal(t, 1.0, series[`pargonn_prediction_duration_seconds_bucket{model="a\"b",le="1"}`])
+	assert.Equal(t, 2.0, series[`pargonn_prediction_duration_seconds_bucket{model="a\"b",le="+Inf"}`])
+	assert.Equal(t, 2.0, series[`pargonn_prediction_duration_seconds_count{model="a\"b"}`])
+	assert.InDelta(t, 2.003, series[`pargonn_prediction_duration_seconds_sum{model="a\"b"}`], 1e-9)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("POST", "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestServerMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	n, _ := newTunerNetwork(nil)
+	path := filepath.Join(dir, "model.json")
+	assert.NoError(t, n.SaveFile(path))
+
+	s := NewServer()
+	defer s.Close()
+	assert.NoError(t, s.Load("model", path))
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	s.Monitor = NewMonitor()
+	for idx := 0; idx < 3; idx++ {
+		_, err := s.Predict("model", [][]float64{{0.1, 0.2}})
+		assert.NoError(t, err)
+	}
+	series := scrape(t, s)
+	assert.Equal(t, 3.0, series[`pargonn_prediction_duration_seconds_count{model="model"}`])
+	assert.NotContains(t, series, "pargonn_training_epoch")
+}
@@ -1,49 +1,51 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/gmkvaal/parGoNN/metrics"
 	"github.com/gonum/matrix/mat64"
 	"log"
-	"math"
+	"math/rand"
 	"regexp"
 	"runtime"
 	"sync"
 	"time"
 )
 
-var wg sync.WaitGroup
-
-
 // Network contains the
-// fields Sizes, biases, and weights
+// fields Sizes and layers
 type Network struct {
-	Sizes  []int
-	layer  layer
-	layers []layer
-	l      int
-	nCores int
-	hp     HyperParameters
+	Sizes             []int
+	layers            []Layer
+	l                 int
+	nCores            int
+	procs             int
+	hp                HyperParameters
+	pipeline          *Pipeline
+	validationHistory []metrics.Result
+	thresholds        []float64
+	frozen            []bool
+	epochCallbacks    []EpochCallback
+	quiet             bool
+	stopped           bool
+	monitor           *Monitor
+	weightRand        *rand.Rand
 	data
 	NetworkMethods
 	dataContainers
+	stability
 }
 
-type layer struct {
-	size int
-	activationFunction
-}
-
+// dataContainers contains the output error and the summed training cost at every core,
+// and the summed gradient norms of every layer over the mini batches of the epoch
 type dataContainers struct {
-	weights     []*mat64.Dense
-	biases      []*mat64.Vector
-	nablaW      [][]*mat64.Dense
-	nablaB      [][]*mat64.Vector
-	deltaNablaW [][]*mat64.Dense
-	deltaNablaB [][]*mat64.Vector
-	delta       [][]*mat64.Vector
-	z           [][]*mat64.Vector
-	activations [][]*mat64.Vector
-	sp          [][]*mat64.Vector
+	delta         []*mat64.Vector
+	loss          []float64
+	lossKnown     bool
+	gradientNorms []float64
+	normBatches   int
 }
 
 type activationFunction struct {
@@ -61,38 +63,181 @@ type HyperParameters struct {
 	lambda float64
 }
 
+// AddLayer adds a dense layer with the given size and activation function.
+// The first layer added is the input layer, and only its size is used
 func (n *Network) AddLayer(layerSize int, activationFunction, activationPrime func(v float64) float64) {
-	n.layer.size = layerSize
-	n.layer.function = activationFunction
-	n.layer.prime = activationPrime
+	if len(n.Sizes) == 0 {
+		n.Sizes = []int{layerSize}
+		return
+	}
 
-	n.layers = append(n.layers, n.layer)
+	if err := n.Add(NewDense(layerSize, activationFunction, activationPrime)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// SeedWeights seeds the random initiation of the parameters of the layers added after it,
+// so that networks built the same way get the same initial weights from run to run
+func (n *Network) SeedWeights(seed int64) {
+	n.weightRand = rand.New(rand.NewSource(seed))
 }
 
-func (n *Network) setSizes() {
-	for idx := range n.layers {
-		n.Sizes = append(n.Sizes, n.layers[idx].size)
+// Add initiates the layer with the output size of the last layer as input size,
+// and adds it to the network. Spatial layers without an input shape get the output
+// shape of the last layer. The input layer must be added first, with AddLayer
+func (n *Network) Add(layer Layer) error {
+	if len(n.Sizes) == 0 {
+		return fmt.Errorf("the input layer must be added before %s layer", layer.Name())
 	}
+
+	if spatial, ok := layer.(SpatialLayer); ok && spatial.InputShape() == (Shape{}) && n.l > 0 {
+		if previous, ok := n.layers[n.l-1].(SpatialLayer); ok {
+			spatial.SetInputShape(previous.OutputShape())
+		}
+	}
+
+	size, err := initLayer(layer, n.Sizes[len(n.Sizes)-1], n.weightRand)
+	if err != nil {
+		return fmt.Errorf("layer %d (%s): %v", len(n.layers), layer.Name(), err)
+	}
+
+	n.layers = append(n.layers, layer)
+	n.Sizes = append(n.Sizes, size)
+	n.frozen = append(n.frozen, false)
+	n.l = len(n.layers)
+
+	return nil
+}
+
+// ReplaceOutputLayer replaces the output layer of the network with layer, which is initiated
+// with new parameters, e.g to fine-tune a loaded network on new labels. The multi-label
+// thresholds of the old output layer are removed. Output layers are appended with Add
+func (n *Network) ReplaceOutputLayer(layer Layer) error {
+	if n.l == 0 {
+		return fmt.Errorf("network has no output layer to replace")
+	}
+
+	old, oldSize, oldFrozen := n.layers[n.l-1], n.Sizes[n.l], n.frozen[n.l-1]
+	n.layers, n.Sizes, n.frozen = n.layers[:n.l-1], n.Sizes[:n.l], n.frozen[:n.l-1]
+	n.l--
+
+	if err := n.Add(layer); err != nil {
+		n.layers = append(n.layers, old)
+		n.Sizes = append(n.Sizes, oldSize)
+		n.frozen = append(n.frozen, oldFrozen)
+		n.l++
+		return err
+	}
+
+	n.thresholds = nil
+	return nil
+}
+
+// SetTrainable sets whether the parameters of layer k (as returned by Layers) are updated in
+// training. The error is not backpropagated below the lowest trainable layer
+func (n *Network) SetTrainable(k int, trainable bool) error {
+	if k < 0 || k >= n.l {
+		return fmt.Errorf("layer %d does not exist, the network has %d layers", k, n.l)
+	}
+	n.frozen[k] = !trainable
+	return nil
+}
+
+// Trainable returns true if the parameters of layer k are updated in training
+func (n *Network) Trainable(k int) bool {
+	return !n.frozen[k]
+}
+
+// SetLearningRate sets the learning rate of every parameter of layer k, used instead of the
+// learning rate given to TrainNetwork. A learning rate of zero restores the learning rate of
+// the network. Parameters can be given separate learning rates through Params
+func (n *Network) SetLearningRate(k int, eta float64) error {
+	if k < 0 || k >= n.l {
+		return fmt.Errorf("layer %d does not exist, the network has %d layers", k, n.l)
+	}
+	for _, param := range n.layers[k].Params() {
+		param.LearningRate = eta
+	}
+	return nil
+}
+
+// lowestTrainable returns the index of the lowest trainable layer,
+// and n.l if every layer is frozen
+func (n *Network) lowestTrainable() int {
+	for k := range n.layers {
+		if !n.frozen[k] {
+			return k
+		}
+	}
+	return n.l
+}
+
+// Layers returns the layers of the network, not including the input layer
+func (n *Network) Layers() []Layer {
+	return n.layers
 }
 
-// initNetwork initiates the weights
-// and biases with random numbers
-func (n *Network) initDataContainers(nCores int) {
-	n.setSizes()
-	n.l = len(n.Sizes) - 1
+// SetPipeline sets the preprocessing pipeline of the network. The pipeline is fitted on the
+// first training data loaded (unless already fitted), and is applied to all loaded data and in Predict
+func (n *Network) SetPipeline(p *Pipeline) {
+	n.pipeline = p
+}
+
+// preprocess applies the pipeline to the input data, fitting it first if fit is true
+// and the pipeline is not already fitted
+func (n *Network) preprocess(input [][]float64, fit bool) [][]float64 {
+	if n.pipeline == nil {
+		return input
+	}
+
+	if fit && !n.pipeline.Fitted {
+		if err := n.pipeline.Fit(input); err != nil {
+			log.Fatal("Could not fit preprocessing pipeline: ", err)
+		}
+	}
+
+	return n.pipeline.TransformAll(input)
+}
+
+// LoadTrainingData preprocesses and loads the training data
+func (n *Network) LoadTrainingData(trainingInput, trainingOutput [][]float64) {
+	n.data.LoadTrainingData(n.preprocess(trainingInput, true), trainingOutput)
+}
+
+// LoadValidationData preprocesses and loads the validation data
+func (n *Network) LoadValidationData(validationInput, validationOutput [][]float64) {
+	n.data.LoadValidationData(n.preprocess(validationInput, false), validationOutput)
+}
+
+// initDataContainers allocates the containers of every layer at every core. Networks with
+// batch layers are trained layer by layer over the mini batch, and get containers for every sample
+func (n *Network) initDataContainers(nCores, miniBatchSize int) {
 	n.nCores = nCores
-	n.weights = sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[:], n.Sizes[1:], randomFunc())
-	n.biases = sliceWithGonumVector(len(n.Sizes[1:]), n.Sizes[1:], randomFunc())
-	for idx := 0; idx < n.nCores; idx++ {
-		n.nablaW = append(n.nablaW, sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[:], n.Sizes[1:], zeroFunc()))
-		n.nablaB = append(n.nablaB, sliceWithGonumVector(len(n.Sizes[1:]), n.Sizes[1:], zeroFunc()))
-		n.deltaNablaW = append(n.deltaNablaW, sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[:], n.Sizes[1:], zeroFunc()))
-		n.deltaNablaB = append(n.deltaNablaB, sliceWithGonumVector(len(n.Sizes[1:]), n.Sizes[1:], zeroFunc()))
-		n.delta = append(n.delta, sliceWithGonumVector(len(n.Sizes[1:]), n.Sizes[1:], zeroFunc()))
-		n.z = append(n.z, sliceWithGonumVector(len(n.Sizes[1:]), n.Sizes[1:], zeroFunc()))
-		n.activations = append(n.activations, sliceWithGonumVector(len(n.Sizes[:]), n.Sizes[:], zeroFunc()))
-		n.sp = append(n.sp, sliceWithGonumVector(len(n.Sizes[1:]), n.Sizes[1:], zeroFunc()))
+	n.procs = nCores
+	if n.hasBatchLayers() && miniBatchSize > nCores {
+		n.procs = miniBatchSize
+	}
+
+	for _, layer := range n.layers {
+		layer.Alloc(n.procs)
+	}
+	n.delta = sliceWithGonumVector(n.procs, repeat(n.Sizes[n.l], n.procs), zeroFunc())
+	n.nonFinite = make([]*NonFiniteError, n.procs)
+	n.loss = make([]float64, n.procs)
+
+	zeros := make([]float64, n.Sizes[n.l])
+	_, err := outputCost(n.layers[n.l-1], zeros, zeros)
+	n.lossKnown = err == nil
+}
+
+// hasBatchLayers returns true if any layer of the network is a batch layer
+func (n *Network) hasBatchLayers() bool {
+	for _, layer := range n.layers {
+		if _, ok := layer.(BatchLayer); ok {
+			return true
+		}
 	}
+	return false
 }
 
 func (nm *NetworkMethods) InitNetworkMethods(outputError func(delta, a, y *mat64.Vector),
@@ -107,209 +252,461 @@ func (hp *HyperParameters) InitHyperParameters(eta float64, lambda float64) {
 	hp.lambda = lambda
 }
 
-// forwardFeed computes the z-s and activations at every neuron and returns the output layer
-func (n *Network) forwardFeed(x *mat64.Vector, proc int) *mat64.Vector {
+// forwardFeed feeds x, or the sparse input s if not nil, through every layer and returns the output layer
+func (n *Network) forwardFeed(x *mat64.Vector, s *SparseVector, proc int) *mat64.Vector {
 	defer TimeTrack(time.Now())
 
-	n.activations[proc][0].CloneVec(x)
-	for k := range n.Sizes[1:] {
-		n.z[proc][k].MulVec(n.weights[k].T(), n.activations[proc][k])
-		n.z[proc][k].AddVec(n.z[proc][k], n.biases[k])
-
-		for j := 0; j < n.Sizes[k+1]; j++ {
-			n.activations[proc][k+1].SetVec(j, n.layers[k].activationFunction.function(n.z[proc][k].At(j, 0)))
-		}
+	a := n.forwardInput(x, s, proc)
+	n.checkActivations(0, a, proc)
+	for k, layer := range n.layers[1:] {
+		a = layer.Forward(a, proc)
+		n.checkActivations(k+1, a, proc)
 	}
 
-	return n.activations[proc][n.l]
+	return a
 }
 
-// outputError computes the error at the output neurons
-func (n *Network) outputError(y *mat64.Vector, proc int) {
-	defer TimeTrack(time.Now())
-	n.outputErrorFunc(n.delta[proc][n.l-1], n.activations[proc][n.l], y)
+// CheckInput returns an error if the (unprocessed) input x can not be predicted: if its
+// preprocessed size does not match the input size of the network, or the first layer
+// rejects it (see InputLayer). Predict and PredictBatch panic on such inputs
+func (n *Network) CheckInput(x []float64) (err error) {
+	if n.l == 0 {
+		return fmt.Errorf("network has no layers")
+	}
+	if n.pipeline != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("input of %d entries can not be preprocessed: %v", len(x), r)
+			}
+		}()
+		x = n.pipeline.Transform(x)
+	}
+	if len(x) != n.Sizes[0] {
+		return fmt.Errorf("input has %d entries, network expects %d", len(x), n.Sizes[0])
+	}
+	return n.checkLayerInput(x)
 }
 
-// outputGradients computes the (delta) gradients at the output layer
-func (n *Network) outputGradients(proc int) {
-	defer TimeTrack(time.Now())
-
-	n.deltaNablaB[proc][n.l-1].CloneVec(n.delta[proc][n.l-1])
-	n.deltaNablaW[proc][n.l-1].Mul(n.activations[proc][n.l-1], n.delta[proc][n.l-1].T())
+// checkLayerInput checks the preprocessed input x with the first layer, if it is an InputLayer
+func (n *Network) checkLayerInput(x []float64) error {
+	if input, ok := n.layers[0].(InputLayer); ok {
+		return input.CheckInput(x)
+	}
+	return nil
 }
 
-// backPropError backpropagates the error and computes the (delta) gradients
-// at every layer
-func (n *Network) backPropError(proc int) {
-	defer TimeTrack(time.Now())
-	//var wgBP sync.WaitGroup
-
+// Predict returns the output of the network for the (unprocessed) input x. Predict does not
+// use the containers used in training, and is safe for concurrent use. Inputs can be checked
+// with CheckInput first
+func (n *Network) Predict(x []float64) []float64 {
+	if n.pipeline != nil {
+		x = n.pipeline.Transform(x)
+	}
 
-	for k := 2; k < n.l+1; k++ {
-		//wgBP.Add(1)
-		//go func (k int) {
-		//defer wgBP.Done()
+	return n.forwardFeed(mat64.NewVector(len(x), x), nil, inference).RawVector().Data
+}
 
-			n.lol(k, proc)
+// PredictBatch returns the outputs of the network for the (unprocessed) inputs,
+// with the inputs split between nCores goroutines
+func (n *Network) PredictBatch(inputs [][]float64, nCores int) [][]float64 {
+	if nCores < 1 {
+		nCores = 1
+	}
 
-			n.delta[proc][n.l-k].MulVec(n.weights[n.l+1-k], n.delta[proc][n.l+1-k])
-			n.delta[proc][n.l-k].MulElemVec(n.delta[proc][n.l-k], n.sp[proc][n.l-k])
-			n.deltaNablaB[proc][n.l-k].CloneVec(n.delta[proc][n.l-k])
-			n.deltaNablaW[proc][n.l-k].Mul(n.activations[proc][n.l-k], n.delta[proc][n.l-k].T())
+	outputs := make([][]float64, len(inputs))
+	splitAcrossCores(len(inputs), nCores, func(core, idx int) {
+		outputs[idx] = n.Predict(inputs[idx])
+	})
+	return outputs
+}
 
+// outputError computes the error at the output neurons,
+// and adds the cost of the output to the training cost
+func (n *Network) outputError(a, y *mat64.Vector, proc int) {
+	defer TimeTrack(time.Now())
+	n.outputErrorFunc(n.delta[proc], a, y)
 
-		//}(k)
+	if n.lossKnown {
+		c, _ := outputCost(n.layers[n.l-1], a.RawVector().Data, y.RawVector().Data)
+		n.loss[proc] += c
 	}
-	//wgBP.Wait()
 }
 
-func (n *Network) lol(k, proc int) {
+// backPropError backpropagates the error through every layer,
+// which adds the gradients of its parameters
+func (n *Network) backPropError(proc int) {
 	defer TimeTrack(time.Now())
-	for j := 0; j < n.Sizes[n.l+1-k]; j++ {
-		n.sp[proc][n.l-k].SetVec(j, n.layers[k].activationFunction.prime(n.z[proc][n.l-k].At(j,0)) )
+
+	delta := n.delta[proc]
+	for k := n.l - 1; k >= n.lowestTrainable(); k-- {
+		delta = n.backwardAtLayer(k, delta, proc)
 	}
 }
 
-// updateGradients adds the delta gradient matrices to the gradient matrices
-func (n *Network) updateGradients(proc int) {
-	defer TimeTrack(time.Now())
-
-	for k := range n.Sizes[1:] {
-		n.nablaW[proc][k].Add(n.nablaW[proc][k], n.deltaNablaW[proc][k])
-		n.nablaB[proc][k].AddVec(n.nablaB[proc][k], n.deltaNablaB[proc][k])
+// backwardAtLayer backpropagates the error through layer k. The output
+// error is passed to BackwardOutput at output layers ending in an activation
+func (n *Network) backwardAtLayer(k int, delta *mat64.Vector, proc int) *mat64.Vector {
+	if output, ok := n.layers[k].(OutputLayer); ok && k == n.l-1 {
+		return output.BackwardOutput(delta, proc)
 	}
+	return n.layers[k].Backward(delta, proc)
 }
 
 // backProp performs one iteration of the backpropagation algorithm
 // for input x and training output y (one batch in a mini batch)
 func (n *Network) BackPropAlgorithm(x, y *mat64.Vector, proc int) {
-	defer TimeTrack(time.Now())
-
+	n.backPropSample(x, nil, y, proc)
+}
 
-	defer wg.Done()
+// backPropSample performs the backpropagation algorithm for input x, or the sparse input s if not nil
+func (n *Network) backPropSample(x *mat64.Vector, s *SparseVector, y *mat64.Vector, proc int) {
+	defer TimeTrack(time.Now())
 
 	// 1. Forward feed
-	n.forwardFeed(x, proc)
+	a := n.forwardFeed(x, s, proc)
 
 	// 2. Computing the output error (delta L).
-	n.outputError(y, proc)
-
-	// 3. Gradients at the output layer
-	n.outputGradients(proc)
+	n.outputError(a, y, proc)
 
-	// 4. Backpropagating the error
+	// 3. Backpropagating the error and adding the gradients
 	n.backPropError(proc)
-
-	// 5. Adding delta gradients to gradients
-	n.updateGradients(proc)
 }
 
-func (n *Network) mergeGradientsAtLayer(k int) {
+// backPropMiniBatch performs the backpropagation algorithm for a whole mini batch, one layer
+// at a time, as needed by batch layers. The containers of sample idx are at proc idx.
+// sparse holds the sparse inputs of the mini batch, if any
+func (n *Network) backPropMiniBatch(miniBatch [][]*mat64.Vector, sparse []*SparseVector) {
 	defer TimeTrack(time.Now())
 
-	for proc := 1; proc < n.nCores; proc++ {
-		n.nablaW[0][k].Add(n.nablaW[0][k], n.nablaW[proc][k])
-		n.nablaB[0][k].AddVec(n.nablaB[0][k], n.nablaB[proc][k])
+	// 1. Forward feed
+	a := make([]*mat64.Vector, len(miniBatch))
+	for idx := range miniBatch {
+		a[idx] = miniBatch[idx][0]
+	}
+	_, batchInput := n.layers[0].(BatchLayer)
+	for idx, s := range sparse {
+		if s != nil && batchInput {
+			a[idx] = s.vector()
+		}
 	}
-}
 
+	for k, layer := range n.layers {
+		if batch, ok := layer.(BatchLayer); ok {
+			copy(a, batch.ForwardBatch(a, n.nCores))
+			for idx := range a {
+				n.checkActivations(k, a[idx], idx)
+			}
+			continue
+		}
+		splitAcrossCores(len(a), n.nCores, func(core, idx int) {
+			if k == 0 {
+				a[idx] = n.forwardInput(a[idx], sparseAt(sparse, idx), idx)
+			} else {
+				a[idx] = layer.Forward(a[idx], idx)
+			}
+			n.checkActivations(k, a[idx], idx)
+		})
+	}
 
-// updateWeightsAtLayer updates the weights at a given layer of the network
-func (n *Network) updateWeightAtLayer(k int) {
+	// 2. Computing the output errors
+	delta := make([]*mat64.Vector, len(miniBatch))
+	splitAcrossCores(len(a), n.nCores, func(core, idx int) {
+		n.outputError(a[idx], miniBatch[idx][1], idx)
+		delta[idx] = n.delta[idx]
+	})
+
+	// 3. Backpropagating the errors and adding the gradients
+	for k := n.l - 1; k >= n.lowestTrainable(); k-- {
+		if batch, ok := n.layers[k].(BatchLayer); ok {
+			copy(delta, batch.BackwardBatch(delta, n.nCores))
+			continue
+		}
+		splitAcrossCores(len(delta), n.nCores, func(core, idx int) {
+			delta[idx] = n.backwardAtLayer(k, delta[idx], idx)
+		})
+	}
+}
+
+// mergeGradientsAtLayer adds the gradients at every core to the gradients at core 0.
+// Only the rows with gradients are added for sparse layers
+func (n *Network) mergeGradientsAtLayer(k int) {
 	defer TimeTrack(time.Now())
 
-	n.weights[k].Scale(1-n.hp.eta*(n.hp.lambda/n.data.n), n.weights[k])
-	n.nablaW[0][k].Scale(n.hp.eta/n.data.miniBatchSize, n.nablaW[0][k])
-	n.weights[k].Sub(n.weights[k], n.nablaW[0][k])
+	sparse, isSparse := n.layers[k].(SparseLayer)
+	grads := n.layers[k].Grads(0)
+	for proc := 1; proc < n.procs; proc++ {
+		for i, grad := range n.layers[k].Grads(proc) {
+			if isSparse {
+				if rows, ok := sparse.SparseRows(i, proc); ok {
+					addRows(grads[i], grad, rows, 1)
+					continue
+				}
+			}
+			grads[i].Add(grads[i], grad)
+		}
+	}
 }
 
-// updateWeightsAtLayer updates the biases at a given layer of the network
-func (n *Network) updateBiasesAtLayer(k int) {
+// updateParamsAtLayer updates the parameters at a given layer of the network
+func (n *Network) updateParamsAtLayer(k int) {
 	defer TimeTrack(time.Now())
 
-	n.nablaB[0][k].ScaleVec(n.hp.eta/n.data.miniBatchSize, n.nablaB[0][k])
-	n.biases[k].SubVec(n.biases[k], n.nablaB[0][k])
+	grads := n.layers[k].Grads(0)
+	for i, param := range n.layers[k].Params() {
+		eta := n.hp.eta
+		if param.LearningRate > 0 {
+			eta = param.LearningRate
+		}
+
+		if param.Regularize {
+			param.Value.Scale(1-eta*(n.hp.lambda/n.data.n), param.Value)
+		}
+		if rows, ok := n.sparseRows(k, i); ok {
+			addRows(param.Value, grads[i], rows, -eta/n.data.miniBatchSize)
+			continue
+		}
+		grads[i].Scale(eta/n.data.miniBatchSize, grads[i])
+		param.Value.Sub(param.Value, grads[i])
+	}
 }
 
-// clearGradientsAtLayer sets the weight and bias gradients to zero
+// clearGradientsAtLayer sets the gradients to zero. For sparse layers, only the rows with
+// gradients are cleared. Core 0 holds the merged gradients of every core, and must be
+// cleared before the other cores
 func (n *Network) clearGradientsAtLayer(k, proc int) {
 	defer TimeTrack(time.Now())
 
-	n.nablaW[proc][k].Scale(0, n.nablaW[proc][k])
-	n.nablaB[proc][k].ScaleVec(0, n.nablaB[proc][k])
+	sparse, isSparse := n.layers[k].(SparseLayer)
+	for i, grad := range n.layers[k].Grads(proc) {
+		if isSparse {
+			rows, ok := sparse.SparseRows(i, proc)
+			if proc == 0 {
+				rows, ok = n.sparseRows(k, i)
+			}
+			if ok {
+				zeroRows(grad, rows)
+				continue
+			}
+		}
+		zeroDense(grad)
+	}
+
+	if isSparse {
+		sparse.ClearSparseRows(proc)
+	}
 }
 
-// updateWeightsAndBiases updates the weights and biases
-// at every layer of the network
-func (n *Network) updateWeightsAndBiases() {
+// updateWeightsAndBiases updates the parameters at every trainable layer of the network,
+// with the merged gradients clipped. The parameters are not updated if NaN or Inf values are
+// found, and the gradients are always cleared, including the gradients of frozen layers
+// above the lowest trainable layer
+func (n *Network) updateWeightsAndBiases() *NonFiniteError {
 	defer TimeTrack(time.Now())
 
-	for k := range n.Sizes[1:] {
-		n.mergeGradientsAtLayer(k)
-		n.updateWeightAtLayer(k)
-		n.updateBiasesAtLayer(k)
-		for proc := 0; proc < n.nCores; proc++ {
+	first := n.lowestTrainable()
+	for k := first; k < n.l; k++ {
+		if !n.frozen[k] {
+			n.mergeGradientsAtLayer(k)
+		}
+	}
+
+	err := n.checkGradients()
+	if err == nil {
+		n.addGradientNorms()
+		n.clipGradients()
+		n.backupParams()
+		for k := first; k < n.l; k++ {
+			if !n.frozen[k] {
+				n.updateParamsAtLayer(k)
+			}
+		}
+		err = n.checkParams()
+	}
+
+	for k := first; k < n.l; k++ {
+		for proc := 0; proc < n.procs; proc++ {
 			n.clearGradientsAtLayer(k, proc)
 		}
 	}
+
+	return err
+}
+
+// splitAcrossCores calls f for the samples 0, ..., nSamples-1, split
+// between nCores goroutines. Sample idx is handled by core idx % nCores
+func splitAcrossCores(nSamples, nCores int, f func(core, idx int)) {
+	var wg sync.WaitGroup
+	for core := 0; core < nCores; core++ {
+		wg.Add(1)
+		go func(core int) {
+			defer wg.Done()
+			for idx := core; idx < nSamples; idx += nCores {
+				f(core, idx)
+			}
+		}(core)
+	}
+	wg.Wait()
 }
 
 // updateMiniBatches runs the stochastic gradient descent
-// algorithm for a set of mini batches (e.g one epoch)
-func (n *Network) updateMiniBatches() {
+// algorithm for a set of mini batches (e.g one epoch).
+// The samples of a mini batch are split between the cores.
+// ctx is checked before every mini batch, and its error returned when done
+func (n *Network) updateMiniBatches(ctx context.Context, epoch int) error {
 	defer TimeTrack(time.Now())
 
+	if n.monitor != nil {
+		n.monitor.startEpoch(epoch, len(n.data.miniBatches))
+	}
+
+	batchLayers := n.hasBatchLayers()
 	for i := range n.data.miniBatches {
-		for idx, dataSet := range n.data.miniBatches[i] {
-			wg.Add(1)
-			go n.BackPropAlgorithm(dataSet[0], dataSet[1], int(math.Mod(float64(idx), float64(n.nCores))))
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		wg.Wait()
-		n.updateWeightsAndBiases()
+		miniBatch := n.data.miniBatches[i]
+		var sparse []*SparseVector
+		if n.miniBatchSparse != nil {
+			sparse = n.miniBatchSparse[i]
+		}
+		if batchLayers {
+			n.backPropMiniBatch(miniBatch, sparse)
+		} else {
+			splitAcrossCores(len(miniBatch), n.nCores, func(proc, idx int) {
+				n.backPropSample(miniBatch[idx][0], sparseAt(sparse, idx), miniBatch[idx][1], proc)
+			})
+		}
+
+		if err := n.updateWeightsAndBiases(); err != nil {
+			if err := n.respondNonFinite(err, epoch, i); err != nil {
+				return err
+			}
+		}
+		if n.monitor != nil {
+			n.monitor.batchDone(len(miniBatch))
+		}
 	}
 
+	return nil
 }
 
-// trainNetwork trains the network with the parameters given as arguments
+// trainNetwork trains the network with the parameters given as arguments. The samples of
+// every mini batch are split between nCores goroutines, leaving GOMAXPROCS as is so that
+// networks can be trained concurrently. Errors are fatal, see TrainContext
 func (n *Network) TrainNetwork(epochs int, miniBatchSize int, eta, lambda float64, shuffle, validate bool, nCores int) {
+	if _, err := n.TrainContext(context.Background(), epochs, miniBatchSize, eta, lambda, shuffle, validate, nCores); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	runtime.GOMAXPROCS(nCores)
+// TrainContext trains the network as TrainNetwork, and returns the results of the finished
+// epochs. ctx is checked between the mini batches, so that the network is left with the
+// weights of the last update when ctx is done, and the results of the finished epochs
+// are returned with the error of ctx. Errors are returned instead of being fatal
+func (n *Network) TrainContext(ctx context.Context, epochs int, miniBatchSize int, eta, lambda float64, shuffle, validate bool, nCores int) ([]EpochResult, error) {
+
+	if n.l == 0 {
+		return nil, errors.New("Network has no layers")
+	}
 
 	if len(n.trainingInput) == 0 || len(n.trainingOutput) == 0 {
-		log.Fatal("Insufficient training data submitted")
+		return nil, errors.New("Insufficient training data submitted")
+	}
+
+	if miniBatchSize < 1 || miniBatchSize > len(n.trainingInput) {
+		return nil, fmt.Errorf("Invalid mini batch size %d for %d training samples", miniBatchSize, len(n.trainingInput))
 	}
 
 	if validate {
 		if len(n.validationInput) == 0 || len(n.validationOutput) == 0 {
-			log.Fatal("Insufficient validation data submitted")
+			return nil, errors.New("Insufficient validation data submitted")
+		}
+	}
+
+	if _, ok := n.layers[0].(InputLayer); ok {
+		for name, inputs := range map[string][]*mat64.Vector{
+			"training":   expandSparse(n.trainingInput, n.trainingSparse),
+			"validation": expandSparse(n.validationInput, n.validationSparse),
+		} {
+			for idx, x := range inputs {
+				if err := n.checkLayerInput(x.RawVector().Data); err != nil {
+					return nil, fmt.Errorf("%s sample %d: %v", name, idx, err)
+				}
+			}
 		}
 	}
 
-	n.initDataContainers(nCores)
+	n.initDataContainers(nCores, miniBatchSize)
 	n.hp.InitHyperParameters(eta, lambda)
+	n.stopped = false
 
-	for i := 0; i < epochs; i++ {
-		fmt.Println("Epoch", i, ":")
+	var history []EpochResult
+	for i := 0; i < epochs && !n.stopped; i++ {
+		if !n.quiet {
+			fmt.Println("Epoch", i, ":")
+		}
+		start := time.Now()
 
 		n.data.miniBatchGenerator(miniBatchSize, shuffle)
-		n.updateMiniBatches()
+		if err := n.updateMiniBatches(ctx, i); err != nil {
+			// the training cost and gradient norms of the unfinished epoch are dropped
+			n.epochLoss()
+			n.epochGradientNorms()
+			return history, err
+		}
+		result := EpochResult{Epoch: i, Loss: n.epochLoss(), GradientNorms: n.epochGradientNorms()}
 
 		if validate {
-			n.validationMethod(n, n.data.validationInput, n.data.validationOutput)
+			history := len(n.validationHistory)
+			n.validationMethod(n, expandSparse(n.validationInput, n.validationSparse), n.data.validationOutput)
+			if len(n.validationHistory) > history {
+				result.Validation = n.validationHistory[len(n.validationHistory)-1]
+			}
+		}
+
+		if !n.quiet {
+			if n.lossKnown {
+				fmt.Println("Avg cost:", result.Loss)
+			}
+			fmt.Println("")
 		}
 
-		//fmt.Println("Avg cost:", nf.totalCost(nf.data.validationInput[:dataCap], nf.data.validationInput[:dataCap]))
-		fmt.Println("")
+		result.Duration = time.Since(start)
+		if n.monitor != nil {
+			n.monitor.endEpoch(result)
+		}
+		history = append(history, result)
+		for _, callback := range n.epochCallbacks {
+			callback(n, result)
+		}
 	}
+
+	return history, nil
 }
 
+// LogTimings turns the verbose timing logs of TimeTrack on, off by default
+var LogTimings = false
+
+// TimeTrack logs the time since start of the calling function if LogTimings is set,
+// and records it as the time of the phase of the function if RecordTimings is set
 func TimeTrack(start time.Time) {
+	if !LogTimings && !RecordTimings {
+		return
+	}
+
 	elapsed := time.Since(start)
 
 	// Skip this function, and fetch the PC and file for its parent.
 	pc, _, _, _ := runtime.Caller(1)
 
+	if RecordTimings {
+		recordPhase(pc, elapsed)
+	}
+	if !LogTimings {
+		return
+	}
+
 	// Retrieve a function object this functions parent.
 	funcObj := runtime.FuncForPC(pc)
 
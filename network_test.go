@@ -1,6 +1,9 @@
 package network
 
 import (
+	"bytes"
+	"context"
+	"math/rand"
 	"testing"
 
 	plr "github.com/gmkvaal/pythonlistreader"
@@ -19,9 +22,9 @@ func TestForwardFeed(t *testing.T) {
 	n.AddLayer(2, Sigmoid, SigmoidPrime)
 	n.AddLayer(3, Sigmoid, SigmoidPrime)
 	n.AddLayer(1, Sigmoid, SigmoidPrime)
-	n.initDataContainers()
+	n.initDataContainers(1, 1)
 
-	w1 := mat64.NewDense(2,3, nil)
+	w1 := n.layers[0].Params()[0].Value
 	w1.Set(0, 0, -0.95766323)
 	w1.Set(1, 0, -2.83527046)
 	w1.Set(0, 1, -4.68051798)
@@ -29,32 +32,28 @@ func TestForwardFeed(t *testing.T) {
 	w1.Set(0, 2, -3.42136137)
 	w1.Set(1, 2, -3.66026809)
 
-	w2 := mat64.NewDense(3,1, nil)
+	w2 := n.layers[1].Params()[0].Value
 	w2.Set(0, 0,  3.23952935)
 	w2.Set(1, 0,  9.16831414)
 	w2.Set(2, 0,  7.20927857)
 
-	n.weights = []*mat64.Dense{w1, w2}
-
-	b1 := mat64.NewDense(3, 1, nil)
+	b1 := n.layers[0].Params()[1].Value
 	b1.Set(0, 0, 1.47931576)
 	b1.Set(1, 0, 5.76116679)
 	b1.Set(2, 0, 4.77665241)
 
-	b2 := mat64.NewDense(1,1,nil)
+	b2 := n.layers[1].Params()[1].Value
 	b2.Set(0,0,-7.41086319)
 
-	n.biases = []*mat64.Dense{b1, b2}
-
-	var y *mat64.Dense
-	y = n.forwardFeed(mat64.NewDense(2,1, []float64{0,0}))
-	assert.Equal(t, y.RawMatrix().Data[0], 0.9999900331454943)
-	y = n.forwardFeed(mat64.NewDense(2,1, []float64{1,0}))
-	assert.Equal(t, y.RawMatrix().Data[0], 0.9992529245275563)
-	y = n.forwardFeed(mat64.NewDense(2,1, []float64{0,1}))
-	assert.Equal(t, y.RawMatrix().Data[0], 0.998931751778988)
-	y = n.forwardFeed(mat64.NewDense(2,1, []float64{1,1}))
-	assert.Equal(t, y.RawMatrix().Data[0], 0.002937291674019087)
+	var y *mat64.Vector
+	y = n.forwardFeed(mat64.NewVector(2, []float64{0,0}), nil, 0)
+	assert.Equal(t, y.At(0, 0), 0.9999900331454943)
+	y = n.forwardFeed(mat64.NewVector(2, []float64{1,0}), nil, 0)
+	assert.Equal(t, y.At(0, 0), 0.9992529245275563)
+	y = n.forwardFeed(mat64.NewVector(2, []float64{0,1}), nil, 0)
+	assert.Equal(t, y.At(0, 0), 0.998931751778988)
+	y = n.forwardFeed(mat64.NewVector(2, []float64{1,1}), nil, inference)
+	assert.Equal(t, y.At(0, 0), 0.002937291674019087)
 }
 
 
@@ -71,67 +70,37 @@ func TestBackProp(t *testing.T) {
 	n.AddLayer(784, Sigmoid, SigmoidPrime)
 	n.AddLayer(30, Sigmoid, SigmoidPrime)
 	n.AddLayer(10, Sigmoid, SigmoidPrime)
-	n.InitNetworkMethods(OutputErrorXEntropy)
-
-	n.setSizes()
-	n.weights 		= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[:], n.Sizes[1:], oneFunc())
-	n.biases 		= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[1:], 1, oneFunc())
-	n.nablaW 		= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[:], n.Sizes[1:], zeroFunc())
-	n.nablaB 		= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[1:], 1, zeroFunc())
-	n.deltaNablaW	= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[:], n.Sizes[1:], zeroFunc())
-	n.deltaNablaB 	= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[1:], 1, zeroFunc())
-	n.delta 		= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[1:], 1, zeroFunc())
-	n.z 			= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[1:], 1, zeroFunc())
-	n.activations 	= sliceWithGonumDense(len(n.Sizes[:]),  n.Sizes[:], 1, zeroFunc())
-	n.sp 			= sliceWithGonumDense(len(n.Sizes[1:]), n.Sizes[1:], 1, zeroFunc())
-	n.l 			= len(n.Sizes) - 1
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	n.initDataContainers(1, 1)
+
+	for _, layer := range n.layers {
+		for _, param := range layer.Params() {
+			param.Value.Apply(func(i, j int, v float64) float64 { return 1 }, param.Value)
+		}
+	}
 
 	n.miniBatchSize = 2
 	n.n = 4
 	n.hp.eta = 1
 	n.hp.lambda = 5.0
 
-	x := make([]float64, 784, 784)
-	x[1] = 1
-	x1 := mat64.NewDense(784, 1, x)
-	y := make([]float64, 10, 10)
-	y[0] = 1
-	y1 := mat64.NewDense(10,1, y)
-
-	b1 := []*mat64.Dense{x1, y1}
-
-	x = make([]float64, 784, 784)
-	x[2] = 1
-	x2 := mat64.NewDense(784, 1, x)
-	y = make([]float64, 10, 10)
-	y[1] = 1
-	y2 := mat64.NewDense(10,1, y)
-
-	b2 := []*mat64.Dense{x2, y2}
-
-	x = make([]float64, 784, 784)
-	x[3] = 1
-	x3 := mat64.NewDense(784, 1, x)
-	y = make([]float64, 10, 10)
-	y[2] = 1
-	y3 := mat64.NewDense(10,1, y)
-
-	b3 := []*mat64.Dense{x3, y3}
-
-	x = make([]float64, 784, 784)
-	x[4] = 1
-	x4 := mat64.NewDense(784, 1, x)
-	y = make([]float64, 10, 10)
-	y[3] = 1
-	y4 := mat64.NewDense(10,1, y)
-
-	b4 := []*mat64.Dense{x4, y4}
-
-	miniBatchA := [][]*mat64.Dense{b1, b2}
-	miniBatchB := [][]*mat64.Dense{b3, b4}
-	miniBatches := [][][]*mat64.Dense{miniBatchA, miniBatchB}
+	var miniBatch [][]*mat64.Vector
+	var miniBatches [][][]*mat64.Vector
+	for idx := 0; idx < 4; idx++ {
+		x := make([]float64, 784, 784)
+		x[idx+1] = 1
+		y := make([]float64, 10, 10)
+		y[idx] = 1
+
+		miniBatch = append(miniBatch, []*mat64.Vector{mat64.NewVector(784, x), mat64.NewVector(10, y)})
+		if len(miniBatch) == 2 {
+			miniBatches = append(miniBatches, miniBatch)
+			miniBatch = nil
+		}
+	}
+
 	n.data.miniBatches = miniBatches
-	n.updateMiniBatches()
+	assert.NoError(t, n.updateMiniBatches(context.Background(), 0))
 
 	fmt.Println()
 
@@ -167,38 +136,41 @@ func TestBackProp(t *testing.T) {
 	weights0FromPy := plr.PythonNestedFloatListParser(testData)
 
 
+	weights := []*mat64.Dense{n.layers[0].Params()[0].Value, n.layers[1].Params()[0].Value}
+	biases := []*mat64.Dense{n.layers[0].Params()[1].Value, n.layers[1].Params()[1].Value}
+
 	errorMatrix := mat64.NewDense(len(bias1FromPy), 1, nil)
 
 	bias1FromPyDense := mat64.NewDense(len(bias1FromPy), 1, bias1FromPy)
-	errorMatrix.Sub(bias1FromPyDense, n.biases[1])
+	errorMatrix.Sub(bias1FromPyDense, biases[1])
 
-	if mat64.Norm(errorMatrix, 2) > 1e-20 {
+	if mat64.Norm(errorMatrix, 2) > 1e-12 {
 		t.Errorf("Error norm exceeding threshold")
 	}
 
 	errorMatrix = mat64.NewDense(len(bias0FromPy), 1, nil)
 	bias0FromPyDense := mat64.NewDense(len(bias0FromPy), 1, bias0FromPy)
-	errorMatrix.Sub(bias0FromPyDense, n.biases[0])
+	errorMatrix.Sub(bias0FromPyDense, biases[0])
 
-	if mat64.Norm(errorMatrix, 2) > 1e-20 {
+	if mat64.Norm(errorMatrix, 2) > 1e-12 {
 		t.Errorf("Error norm exceeding threshold")
 	}
 
-	var weights []float64
+	var col []float64
 	for idx1 := range weights1FromPy {
-		weights = mat64.Col(nil, idx1, n.weights[1])
+		col = mat64.Col(nil, idx1, weights[1])
 		for idx2 := range weights1FromPy[idx1] {
-			if math.Abs(weights[idx2] - weights1FromPy[idx1][idx2]) > 1e-8 {
-				t.Errorf("Not equal enough:", weights[idx2], weights1FromPy[idx1][idx2])
+			if math.Abs(col[idx2] - weights1FromPy[idx1][idx2]) > 1e-8 {
+				t.Errorf("Not equal enough: %v %v", col[idx2], weights1FromPy[idx1][idx2])
 			}
 		}
 	}
 
 	for idx1 := range weights0FromPy {
-		weights = mat64.Col(nil, idx1, n.weights[0])
+		col = mat64.Col(nil, idx1, weights[0])
 		for idx2 := range weights0FromPy[idx1] {
-			if math.Abs(weights[idx2] - weights0FromPy[idx1][idx2]) > 1e-8 {
-				t.Errorf("Not equal enough:", weights[idx2], weights0FromPy[idx1][idx2])
+			if math.Abs(col[idx2] - weights0FromPy[idx1][idx2]) > 1e-8 {
+				t.Errorf("Not equal enough: %v %v", col[idx2], weights0FromPy[idx1][idx2])
 			}
 		}
 	}
@@ -213,6 +185,75 @@ func TestBackProp(t *testing.T) {
 
 
 
+func TestFineTune(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(4, Sigmoid, SigmoidPrime)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+
+	// New labels with a new output layer, training only the output layer
+	assert.Error(t, loaded.ReplaceOutputLayer(&Dense{}))
+	assert.Equal(t, []int{2, 4, 2}, loaded.Sizes)
+	assert.NoError(t, loaded.ReplaceOutputLayer(NewDense(3, Sigmoid, SigmoidPrime)))
+	assert.Equal(t, []int{2, 4, 3}, loaded.Sizes)
+	assert.NoError(t, loaded.SetTrainable(0, false))
+	assert.Error(t, loaded.SetTrainable(2, false))
+
+	var input, output [][]float64
+	for idx := 0; idx < 12; idx++ {
+		input = append(input, []float64{rand.Float64(), rand.Float64()})
+		y := make([]float64, 3)
+		y[idx%3] = 1
+		output = append(output, y)
+	}
+	hidden := mat64.DenseCopyOf(loaded.Layers()[0].Params()[0].Value)
+	out := mat64.DenseCopyOf(loaded.Layers()[1].Params()[0].Value)
+
+	loaded.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	loaded.LoadTrainingData(input, output)
+	loaded.TrainNetwork(2, 4, 1, 0, true, false, 2)
+	assert.True(t, mat64.Equal(hidden, loaded.Layers()[0].Params()[0].Value))
+	assert.False(t, mat64.Equal(out, loaded.Layers()[1].Params()[0].Value))
+
+	buf.Reset()
+	assert.NoError(t, loaded.Save(&buf))
+	reloaded, err := Load(&buf)
+	assert.NoError(t, err)
+	assert.False(t, reloaded.Trainable(0))
+	assert.True(t, reloaded.Trainable(1))
+
+	// Learning rates of parameter groups are used instead of the learning rate of the network
+	assert.NoError(t, loaded.SetTrainable(0, true))
+	assert.NoError(t, loaded.SetLearningRate(1, 1))
+	hidden = mat64.DenseCopyOf(loaded.Layers()[0].Params()[0].Value)
+	out = mat64.DenseCopyOf(loaded.Layers()[1].Params()[0].Value)
+	loaded.TrainNetwork(1, 4, 0, 0, true, false, 1)
+	assert.True(t, mat64.Equal(hidden, loaded.Layers()[0].Params()[0].Value))
+	assert.False(t, mat64.Equal(out, loaded.Layers()[1].Params()[0].Value))
+}
+
+func TestPredictBatch(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(3, nil, nil)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+
+	var inputs [][]float64
+	for idx := 0; idx < 7; idx++ {
+		inputs = append(inputs, []float64{rand.Float64(), rand.Float64(), rand.Float64()})
+	}
+	outputs := n.PredictBatch(inputs, 3)
+	assert.Equal(t, 7, len(outputs))
+	for idx, x := range inputs {
+		assert.Equal(t, n.Predict(x), outputs[idx])
+	}
+}
+
 func vizNumber(s []float64) {
 	for idx := range s {
 		if s[idx] > 0 {
@@ -2,12 +2,14 @@ package network
 
 import (
 	"math"
+	"reflect"
 	"github.com/gonum/matrix/mat64"
 )
 
 
 // OutputErrorXEntropy computes `delta` at the output layer
-// for output activations `a` and output matrix `y`
+// for output activations `a` and output matrix `y`. With sigmoid outputs this is
+// the binary cross entropy of every output, and is used for multi-label outputs as well
 func OutputErrorXEntropy(delta, a, y *mat64.Vector) {
 	delta.SubVec(a, y)
 }
@@ -29,3 +31,63 @@ func Sigmoid(z float64) float64 {
 func SigmoidPrime(z float64) float64 {
 	return Sigmoid(z) * (1 - Sigmoid(z))
 }
+
+// Identity returns z, for linear (e.g regression) outputs. Combined with OutputErrorXEntropy
+// at the output layer, this gives the gradient of the quadratic cost
+func Identity(z float64) float64 {
+	return z
+}
+
+// IdentityPrime returns the differentiated identity function
+func IdentityPrime(z float64) float64 {
+	return 1
+}
+
+// Tanh returns the hyperbolic tangent of z
+func Tanh(z float64) float64 {
+	return math.Tanh(z)
+}
+
+// TanhPrime returns the differentiated hyperbolic tangent
+func TanhPrime(z float64) float64 {
+	t := math.Tanh(z)
+	return 1 - t*t
+}
+
+// ReLU returns z if z is positive, and zero otherwise
+func ReLU(z float64) float64 {
+	return math.Max(z, 0)
+}
+
+// ReLUPrime returns the differentiated ReLU function
+func ReLUPrime(z float64) float64 {
+	if z > 0 {
+		return 1
+	}
+	return 0
+}
+
+// activationFunctions maps names to activation functions and their derivatives,
+// used when saving and loading networks
+var activationFunctions = map[string]activationFunction{
+	"sigmoid":  {Sigmoid, SigmoidPrime},
+	"identity": {Identity, IdentityPrime},
+	"tanh":     {Tanh, TanhPrime},
+	"relu":     {ReLU, ReLUPrime},
+}
+
+// RegisterActivation makes a custom activation function available when saving and loading networks
+func RegisterActivation(name string, function, prime func(v float64) float64) {
+	activationFunctions[name] = activationFunction{function, prime}
+}
+
+// activationName returns the name under which the activation function is registered
+func activationName(af activationFunction) (string, bool) {
+	for name, registered := range activationFunctions {
+		if reflect.ValueOf(registered.function).Pointer() == reflect.ValueOf(af.function).Pointer() &&
+			reflect.ValueOf(registered.prime).Pointer() == reflect.ValueOf(af.prime).Pointer() {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,374 @@
+package network
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// BatchNorm normalizes every input to zero mean and unit variance over the mini batch, and
+// scales and shifts the result with the learnable gamma and beta. Running averages of the
+// batch means and variances are kept (and saved with the network), and are used instead of
+// the batch statistics outside of training
+type BatchNorm struct {
+	Momentum    float64
+	Epsilon     float64
+	RunningMean []float64
+	RunningVar  []float64
+	size        int
+	gamma       *mat64.Vector
+	beta        *mat64.Vector
+	params      []*Param
+	nablaGamma  []*mat64.Vector
+	nablaBeta   []*mat64.Vector
+	grads       [][]*mat64.Dense
+	invStd      *mat64.Vector
+	xHat        []*mat64.Vector
+	a           []*mat64.Vector
+	deltaIn     []*mat64.Vector
+}
+
+// NewBatchNorm returns a batch normalization layer with the default
+// momentum (0.9) of the running averages and epsilon (1e-5)
+func NewBatchNorm() *BatchNorm {
+	return &BatchNorm{}
+}
+
+func (b *BatchNorm) Name() string { return "batchNorm" }
+
+// Init sets gamma to one and beta to zero. The running averages are
+// kept if they match the input size, e.g when loading a saved network
+func (b *BatchNorm) Init(inputSize int) (int, error) {
+	if b.Momentum == 0 {
+		b.Momentum = 0.9
+	}
+	if b.Epsilon == 0 {
+		b.Epsilon = 1e-5
+	}
+	if b.Momentum < 0 || b.Momentum >= 1 || b.Epsilon < 0 {
+		return 0, fmt.Errorf("invalid momentum %v or epsilon %v", b.Momentum, b.Epsilon)
+	}
+
+	if len(b.RunningMean) != inputSize || len(b.RunningVar) != inputSize {
+		b.RunningMean = make([]float64, inputSize)
+		b.RunningVar = make([]float64, inputSize)
+		for j := range b.RunningVar {
+			b.RunningVar[j] = 1
+		}
+	}
+
+	b.size = inputSize
+	b.gamma = sliceWithGonumVector(1, []int{inputSize}, oneFunc())[0]
+	b.beta = sliceWithGonumVector(1, []int{inputSize}, zeroFunc())[0]
+	b.params = []*Param{{Value: vectorAsDense(b.gamma)}, {Value: vectorAsDense(b.beta)}}
+
+	return inputSize, nil
+}
+
+// Alloc allocates the containers and gradients for every core
+func (b *BatchNorm) Alloc(nCores int) {
+	sizes := repeat(b.size, nCores)
+
+	b.nablaGamma = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	b.nablaBeta = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	b.xHat = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	b.a = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	b.deltaIn = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	b.invStd = mat64.NewVector(b.size, nil)
+
+	b.grads = make([][]*mat64.Dense, nCores)
+	for proc := range b.grads {
+		b.grads[proc] = []*mat64.Dense{vectorAsDense(b.nablaGamma[proc]), vectorAsDense(b.nablaBeta[proc])}
+	}
+}
+
+// sumAcrossCores returns the sum of the vectors added by f for the samples
+// 0, ..., nSamples-1. Every core adds its samples to a partial sum, and
+// the partial sums are merged when all the cores are done
+func sumAcrossCores(size, nSamples, nCores int, f func(partial []float64, idx int)) []float64 {
+	partials := make([][]float64, nCores)
+	for core := range partials {
+		partials[core] = make([]float64, size)
+	}
+
+	splitAcrossCores(nSamples, nCores, func(core, idx int) {
+		f(partials[core], idx)
+	})
+
+	for _, partial := range partials[1:] {
+		for j, v := range partial {
+			partials[0][j] += v
+		}
+	}
+
+	return partials[0]
+}
+
+// ForwardBatch normalizes the samples with the mean and variance of the mini batch,
+// and updates the running averages. The statistics are computed in two passes,
+// each split across the cores
+func (b *BatchNorm) ForwardBatch(x []*mat64.Vector, nCores int) []*mat64.Vector {
+	m := float64(len(x))
+
+	mean := sumAcrossCores(b.size, len(x), nCores, func(partial []float64, idx int) {
+		for j, v := range x[idx].RawVector().Data {
+			partial[j] += v
+		}
+	})
+	for j := range mean {
+		mean[j] /= m
+	}
+
+	variance := sumAcrossCores(b.size, len(x), nCores, func(partial []float64, idx int) {
+		for j, v := range x[idx].RawVector().Data {
+			partial[j] += (v - mean[j]) * (v - mean[j])
+		}
+	})
+	for j := range variance {
+		variance[j] /= m
+		b.invStd.SetVec(j, 1/math.Sqrt(variance[j]+b.Epsilon))
+
+		unbiased := variance[j]
+		if m > 1 {
+			unbiased *= m / (m - 1)
+		}
+		b.RunningMean[j] = b.Momentum*b.RunningMean[j] + (1-b.Momentum)*mean[j]
+		b.RunningVar[j] = b.Momentum*b.RunningVar[j] + (1-b.Momentum)*unbiased
+	}
+
+	splitAcrossCores(len(x), nCores, func(core, idx int) {
+		xData, xHat, a := x[idx].RawVector().Data, b.xHat[idx].RawVector().Data, b.a[idx].RawVector().Data
+		for j, v := range xData {
+			xHat[j] = (v - mean[j]) * b.invStd.At(j, 0)
+			a[j] = b.gamma.At(j, 0)*xHat[j] + b.beta.At(j, 0)
+		}
+	})
+
+	return b.a[:len(x)]
+}
+
+// BackwardBatch adds the gamma and beta gradients of the mini batch to the gradients
+// at proc 0, and returns the errors at the inputs, which depend on the whole mini batch
+// through the batch statistics
+func (b *BatchNorm) BackwardBatch(delta []*mat64.Vector, nCores int) []*mat64.Vector {
+	m := float64(len(delta))
+
+	sumDelta := sumAcrossCores(b.size, len(delta), nCores, func(partial []float64, idx int) {
+		for j, v := range delta[idx].RawVector().Data {
+			partial[j] += v
+		}
+	})
+	sumDeltaXHat := sumAcrossCores(b.size, len(delta), nCores, func(partial []float64, idx int) {
+		xHat := b.xHat[idx].RawVector().Data
+		for j, v := range delta[idx].RawVector().Data {
+			partial[j] += v * xHat[j]
+		}
+	})
+
+	nablaGamma, nablaBeta := b.nablaGamma[0].RawVector().Data, b.nablaBeta[0].RawVector().Data
+	for j := 0; j < b.size; j++ {
+		nablaGamma[j] += sumDeltaXHat[j]
+		nablaBeta[j] += sumDelta[j]
+	}
+
+	splitAcrossCores(len(delta), nCores, func(core, idx int) {
+		dData, xHat, dx := delta[idx].RawVector().Data, b.xHat[idx].RawVector().Data, b.deltaIn[idx].RawVector().Data
+		for j, v := range dData {
+			scale := b.gamma.At(j, 0) * b.invStd.At(j, 0) / m
+			dx[j] = scale * (m*v - sumDelta[j] - xHat[j]*sumDeltaXHat[j])
+		}
+	})
+
+	return b.deltaIn[:len(delta)]
+}
+
+// Forward normalizes a single sample with the running averages
+func (b *BatchNorm) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var a, xHat *mat64.Vector
+	if proc == inference {
+		a = mat64.NewVector(b.size, nil)
+		xHat = mat64.NewVector(b.size, nil)
+	} else {
+		a, xHat = b.a[proc], b.xHat[proc]
+	}
+
+	for j := 0; j < b.size; j++ {
+		xHat.SetVec(j, (x.At(j, 0)-b.RunningMean[j])/math.Sqrt(b.RunningVar[j]+b.Epsilon))
+		a.SetVec(j, b.gamma.At(j, 0)*xHat.At(j, 0)+b.beta.At(j, 0))
+	}
+
+	return a
+}
+
+// Backward adds the gradients of a single sample normalized with the running averages
+func (b *BatchNorm) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	for j := 0; j < b.size; j++ {
+		v := delta.At(j, 0)
+		b.nablaGamma[proc].SetVec(j, b.nablaGamma[proc].At(j, 0)+v*b.xHat[proc].At(j, 0))
+		b.nablaBeta[proc].SetVec(j, b.nablaBeta[proc].At(j, 0)+v)
+		b.deltaIn[proc].SetVec(j, v*b.gamma.At(j, 0)/math.Sqrt(b.RunningVar[j]+b.Epsilon))
+	}
+
+	return b.deltaIn[proc]
+}
+
+// Params returns gamma and beta (as column matrices)
+func (b *BatchNorm) Params() []*Param {
+	return b.params
+}
+
+// Grads returns the gamma and beta gradients at proc
+func (b *BatchNorm) Grads(proc int) []*mat64.Dense {
+	return b.grads[proc]
+}
+
+// LayerNorm normalizes every sample to zero mean and unit variance over its inputs,
+// and scales and shifts the result with the learnable gamma and beta. Unlike BatchNorm,
+// the normalization is the same in training and inference. For sequences of Steps
+// vectors, every step is normalized separately, with gamma and beta shared by the steps
+type LayerNorm struct {
+	Epsilon    float64
+	Steps      int
+	size       int
+	dim        int
+	gamma      *mat64.Vector
+	beta       *mat64.Vector
+	params     []*Param
+	nablaGamma []*mat64.Vector
+	nablaBeta  []*mat64.Vector
+	grads      [][]*mat64.Dense
+	invStd     [][]float64
+	xHat       []*mat64.Vector
+	a          []*mat64.Vector
+	deltaIn    []*mat64.Vector
+}
+
+// NewLayerNorm returns a layer normalization layer with the default epsilon (1e-5)
+func NewLayerNorm() *LayerNorm {
+	return &LayerNorm{}
+}
+
+func (l *LayerNorm) Name() string { return "layerNorm" }
+
+// Init sets gamma to one and beta to zero
+func (l *LayerNorm) Init(inputSize int) (int, error) {
+	if l.Epsilon == 0 {
+		l.Epsilon = 1e-5
+	}
+	if l.Steps == 0 {
+		l.Steps = 1
+	}
+	if l.Epsilon < 0 || l.Steps < 0 || inputSize%l.Steps != 0 {
+		return 0, fmt.Errorf("invalid epsilon %v or steps %d for input size %d", l.Epsilon, l.Steps, inputSize)
+	}
+
+	l.size = inputSize
+	l.dim = inputSize / l.Steps
+	l.gamma = sliceWithGonumVector(1, []int{l.dim}, oneFunc())[0]
+	l.beta = sliceWithGonumVector(1, []int{l.dim}, zeroFunc())[0]
+	l.params = []*Param{{Value: vectorAsDense(l.gamma)}, {Value: vectorAsDense(l.beta)}}
+
+	return inputSize, nil
+}
+
+// Alloc allocates the containers and gradients for every core
+func (l *LayerNorm) Alloc(nCores int) {
+	sizes := repeat(l.size, nCores)
+
+	l.nablaGamma = sliceWithGonumVector(nCores, repeat(l.dim, nCores), zeroFunc())
+	l.nablaBeta = sliceWithGonumVector(nCores, repeat(l.dim, nCores), zeroFunc())
+	l.xHat = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	l.a = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	l.deltaIn = sliceWithGonumVector(nCores, sizes, zeroFunc())
+	l.invStd = make([][]float64, nCores)
+
+	l.grads = make([][]*mat64.Dense, nCores)
+	for proc := range l.grads {
+		l.invStd[proc] = make([]float64, l.Steps)
+		l.grads[proc] = []*mat64.Dense{vectorAsDense(l.nablaGamma[proc]), vectorAsDense(l.nablaBeta[proc])}
+	}
+}
+
+// normalize writes the normalized x into xHat and the output into a, and returns 1/std of x
+func (l *LayerNorm) normalize(x, xHat, a []float64) float64 {
+	var mean, variance float64
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(l.dim)
+	for _, v := range x {
+		variance += (v - mean) * (v - mean)
+	}
+	invStd := 1 / math.Sqrt(variance/float64(l.dim)+l.Epsilon)
+
+	for j, v := range x {
+		xHat[j] = (v - mean) * invStd
+		a[j] = l.gamma.At(j, 0)*xHat[j] + l.beta.At(j, 0)
+	}
+
+	return invStd
+}
+
+// Forward normalizes every step of the sample x
+func (l *LayerNorm) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var a, xHat []float64
+	if proc == inference {
+		a, xHat = make([]float64, l.size), make([]float64, l.size)
+	} else {
+		a, xHat = l.a[proc].RawVector().Data, l.xHat[proc].RawVector().Data
+	}
+
+	xData := x.RawVector().Data
+	for t := 0; t < l.Steps; t++ {
+		from, to := t*l.dim, (t+1)*l.dim
+		invStd := l.normalize(xData[from:to], xHat[from:to], a[from:to])
+		if proc != inference {
+			l.invStd[proc][t] = invStd
+		}
+	}
+
+	if proc == inference {
+		return mat64.NewVector(l.size, a)
+	}
+	return l.a[proc]
+}
+
+// Backward adds the gamma and beta gradients, and returns the error at the input,
+// which depends on every input of a step through its mean and variance
+func (l *LayerNorm) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	xHat, dx := l.xHat[proc].RawVector().Data, l.deltaIn[proc].RawVector().Data
+	nablaGamma, nablaBeta := l.nablaGamma[proc].RawVector().Data, l.nablaBeta[proc].RawVector().Data
+	dim := float64(l.dim)
+
+	for t := 0; t < l.Steps; t++ {
+		var sumG, sumGXHat float64
+		for j := 0; j < l.dim; j++ {
+			idx := t*l.dim + j
+			v := delta.At(idx, 0)
+			nablaGamma[j] += v * xHat[idx]
+			nablaBeta[j] += v
+
+			g := v * l.gamma.At(j, 0)
+			dx[idx] = g
+			sumG += g
+			sumGXHat += g * xHat[idx]
+		}
+
+		for idx := t * l.dim; idx < (t+1)*l.dim; idx++ {
+			dx[idx] = l.invStd[proc][t] / dim * (dim*dx[idx] - sumG - xHat[idx]*sumGXHat)
+		}
+	}
+
+	return l.deltaIn[proc]
+}
+
+// Params returns gamma and beta (as column matrices)
+func (l *LayerNorm) Params() []*Param {
+	return l.params
+}
+
+// Grads returns the gamma and beta gradients at proc
+func (l *LayerNorm) Grads(proc int) []*mat64.Dense {
+	return l.grads[proc]
+}
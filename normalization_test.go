@@ -0,0 +1,172 @@
+package network
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func randomVectors(n, size int) []*mat64.Vector {
+	vs := make([]*mat64.Vector, n)
+	for idx := range vs {
+		vs[idx] = mat64.NewVector(size, nil)
+		for j := 0; j < size; j++ {
+			vs[idx].SetVec(j, rand.NormFloat64())
+		}
+	}
+	return vs
+}
+
+func TestBatchNormStatistics(t *testing.T) {
+	b := NewBatchNorm()
+	_, err := b.Init(3)
+	assert.NoError(t, err)
+	b.Alloc(7)
+
+	x := randomVectors(7, 3)
+	single := make([]float64, 0)
+	for _, a := range b.ForwardBatch(x, 1) {
+		single = append(single, a.RawVector().Data...)
+	}
+
+	// The statistics do not depend on how the batch is split across cores
+	for _, nCores := range []int{2, 3, 7} {
+		split := make([]float64, 0)
+		for _, a := range b.ForwardBatch(x, nCores) {
+			split = append(split, a.RawVector().Data...)
+		}
+		assert.InDeltaSlice(t, single, split, 1e-12)
+	}
+
+	// The outputs have zero mean and the variance v / (v + epsilon) of normalized inputs of variance v
+	variance := func(v []float64) (mean, variance float64) {
+		for _, x := range v {
+			mean += x / float64(len(v))
+		}
+		for _, x := range v {
+			variance += (x - mean) * (x - mean) / float64(len(v))
+		}
+		return mean, variance
+	}
+	for j := 0; j < 3; j++ {
+		var in, out []float64
+		for idx := 0; idx < 7; idx++ {
+			in = append(in, x[idx].At(j, 0))
+			out = append(out, single[idx*3+j])
+		}
+		_, v := variance(in)
+		mean, outVariance := variance(out)
+		assert.InDelta(t, 0, mean, 1e-12)
+		assert.InDelta(t, v/(v+b.Epsilon), outVariance, 1e-12)
+	}
+}
+
+func TestBatchNormGradients(t *testing.T) {
+	// Single samples are normalized with the running averages
+	checkLayerGradients(t, &BatchNorm{RunningMean: []float64{0.5, -1, 0, 2}, RunningVar: []float64{1, 0.5, 2, 3}}, 4)
+
+	b := NewBatchNorm()
+	_, err := b.Init(4)
+	assert.NoError(t, err)
+	b.Alloc(6)
+	for j := 0; j < 4; j++ {
+		b.gamma.SetVec(j, rand.NormFloat64())
+		b.beta.SetVec(j, rand.NormFloat64())
+	}
+
+	x := randomVectors(6, 4)
+	r := randomVectors(6, 4)
+	cost := func() float64 {
+		var c float64
+		for idx, a := range b.ForwardBatch(x, 2) {
+			c += mat64.Dot(r[idx], a)
+		}
+		return c
+	}
+
+	cost()
+	dx := make([]*mat64.Vector, 6)
+	for idx, d := range b.BackwardBatch(r, 2) {
+		dx[idx] = mat64.NewVector(4, nil)
+		dx[idx].CloneVec(d)
+	}
+
+	const eps = 1e-6
+	for idx := range x {
+		for j := 0; j < 4; j++ {
+			v := x[idx].At(j, 0)
+			x[idx].SetVec(j, v+eps)
+			plus := cost()
+			x[idx].SetVec(j, v-eps)
+			minus := cost()
+			x[idx].SetVec(j, v)
+			assert.InDelta(t, (plus-minus)/(2*eps), dx[idx].At(j, 0), 1e-6, "input %d, %d", idx, j)
+		}
+	}
+
+	for p, param := range b.Params() {
+		for j := 0; j < 4; j++ {
+			v := param.Value.At(j, 0)
+			param.Value.Set(j, 0, v+eps)
+			plus := cost()
+			param.Value.Set(j, 0, v-eps)
+			minus := cost()
+			param.Value.Set(j, 0, v)
+			assert.InDelta(t, (plus-minus)/(2*eps), b.Grads(0)[p].At(j, 0), 1e-6, "param %d, %d", p, j)
+		}
+	}
+}
+
+func TestLayerNorm(t *testing.T) {
+	l := NewLayerNorm()
+	_, err := l.Init(4)
+	assert.NoError(t, err)
+
+	a := l.Forward(mat64.NewVector(4, []float64{1, 2, 3, 4}), inference).RawVector().Data
+	assert.InDeltaSlice(t, []float64{-1.3416, -0.4472, 0.4472, 1.3416}, a, 1e-4)
+
+	checkLayerGradients(t, NewLayerNorm(), 5)
+	checkLayerGradients(t, &LayerNorm{Steps: 3}, 12)
+}
+
+func TestBatchNormNetwork(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(6, Sigmoid, SigmoidPrime)
+	assert.NoError(t, n.Add(NewBatchNorm()))
+	assert.NoError(t, n.Add(NewLayerNorm()))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+
+	var input, output [][]float64
+	for idx := 0; idx < 40; idx++ {
+		x := []float64{rand.Float64(), rand.Float64()}
+		input = append(input, x)
+		if x[0] > x[1] {
+			output = append(output, []float64{1, 0})
+		} else {
+			output = append(output, []float64{0, 1})
+		}
+	}
+	n.LoadTrainingData(input, output)
+	n.TrainNetwork(60, 8, 0.5, 0, true, false, 3)
+
+	correct := 0
+	for idx, x := range input {
+		a := n.Predict(x)
+		if (a[0] > a[1]) == (output[idx][0] == 1) {
+			correct++
+		}
+	}
+	assert.True(t, correct >= 30, "%d of 40 correct", correct)
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, n.layers[1].(*BatchNorm).RunningVar, loaded.layers[1].(*BatchNorm).RunningVar)
+	assert.Equal(t, n.Predict(input[0]), loaded.Predict(input[0]))
+}
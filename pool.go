@@ -0,0 +1,185 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// pool contains the configuration and containers shared by the pooling layers. Every channel is
+// pooled separately over windows of Size x Size pixels, moved Stride (default Size) pixels at a time
+type pool struct {
+	Input   Shape
+	Size    int
+	Stride  int
+	output  Shape
+	a       []*mat64.Vector
+	deltaIn []*mat64.Vector
+}
+
+func (p *pool) InputShape() Shape { return p.Input }
+
+func (p *pool) SetInputShape(s Shape) { p.Input = s }
+
+func (p *pool) OutputShape() Shape { return p.output }
+
+func (p *pool) Init(inputSize int) (int, error) {
+	if err := checkInputShape(p.Input, inputSize); err != nil {
+		return 0, err
+	}
+
+	if p.Stride == 0 {
+		p.Stride = p.Size
+	}
+
+	if p.Size <= 0 || p.Stride <= 0 || p.Size > p.Input.Height || p.Size > p.Input.Width {
+		return 0, fmt.Errorf("invalid pool size %d or stride %d for input %v", p.Size, p.Stride, p.Input)
+	}
+
+	p.output = Shape{
+		Channels: p.Input.Channels,
+		Height:   (p.Input.Height-p.Size)/p.Stride + 1,
+		Width:    (p.Input.Width-p.Size)/p.Stride + 1,
+	}
+
+	return p.output.Size(), nil
+}
+
+func (p *pool) Alloc(nCores int) {
+	p.a = sliceWithGonumVector(nCores, repeat(p.output.Size(), nCores), zeroFunc())
+	p.deltaIn = sliceWithGonumVector(nCores, repeat(p.Input.Size(), nCores), zeroFunc())
+}
+
+// window calls f with the output index and the input indices of every pooling window
+func (p *pool) window(f func(out int, in []int)) {
+	in := make([]int, 0, p.Size*p.Size)
+	for ch := 0; ch < p.Input.Channels; ch++ {
+		for oy := 0; oy < p.output.Height; oy++ {
+			for ox := 0; ox < p.output.Width; ox++ {
+				in = in[:0]
+				for ki := 0; ki < p.Size; ki++ {
+					for kj := 0; kj < p.Size; kj++ {
+						in = append(in, (ch*p.Input.Height+oy*p.Stride+ki)*p.Input.Width+ox*p.Stride+kj)
+					}
+				}
+				f((ch*p.output.Height+oy)*p.output.Width+ox, in)
+			}
+		}
+	}
+}
+
+// outputVector returns the output container at proc, or a new vector for inference
+func (p *pool) outputVector(proc int) *mat64.Vector {
+	if proc == inference {
+		return mat64.NewVector(p.output.Size(), nil)
+	}
+	return p.a[proc]
+}
+
+func (p *pool) Params() []*Param { return nil }
+
+func (p *pool) Grads(proc int) []*mat64.Dense { return nil }
+
+// MaxPool2D passes on the largest pixel in every pooling window
+type MaxPool2D struct {
+	pool
+	argMax [][]int
+}
+
+// NewMaxPool2D returns a max pooling layer with the given window size and stride (default size).
+// The input shape is taken from the previous layer if not set
+func NewMaxPool2D(size, stride int) *MaxPool2D {
+	return &MaxPool2D{pool: pool{Size: size, Stride: stride}}
+}
+
+func (m *MaxPool2D) Name() string { return "maxPool2d" }
+
+func (m *MaxPool2D) Alloc(nCores int) {
+	m.pool.Alloc(nCores)
+	m.argMax = make([][]int, nCores)
+	for proc := range m.argMax {
+		m.argMax[proc] = make([]int, m.output.Size())
+	}
+}
+
+// Forward passes on the largest pixel of every window, and stores its position
+func (m *MaxPool2D) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	a := m.outputVector(proc)
+	xData, aData := x.RawVector().Data, a.RawVector().Data
+
+	m.window(func(out int, in []int) {
+		largest := in[0]
+		for _, idx := range in[1:] {
+			if xData[idx] > xData[largest] {
+				largest = idx
+			}
+		}
+		aData[out] = xData[largest]
+		if proc != inference {
+			m.argMax[proc][out] = largest
+		}
+	})
+
+	return a
+}
+
+// Backward passes the error of every window on to its largest pixel
+func (m *MaxPool2D) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	dx := m.deltaIn[proc].RawVector().Data
+	for idx := range dx {
+		dx[idx] = 0
+	}
+
+	for out, idx := range m.argMax[proc] {
+		dx[idx] += delta.At(out, 0)
+	}
+
+	return m.deltaIn[proc]
+}
+
+// AvgPool2D passes on the average of the pixels in every pooling window
+type AvgPool2D struct {
+	pool
+}
+
+// NewAvgPool2D returns an average pooling layer with the given window size and stride (default size).
+// The input shape is taken from the previous layer if not set
+func NewAvgPool2D(size, stride int) *AvgPool2D {
+	return &AvgPool2D{pool: pool{Size: size, Stride: stride}}
+}
+
+func (a *AvgPool2D) Name() string { return "avgPool2d" }
+
+// Forward passes on the average pixel of every window
+func (a *AvgPool2D) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	y := a.outputVector(proc)
+	xData, yData := x.RawVector().Data, y.RawVector().Data
+	scale := 1 / float64(a.Size*a.Size)
+
+	a.window(func(out int, in []int) {
+		var sum float64
+		for _, idx := range in {
+			sum += xData[idx]
+		}
+		yData[out] = sum * scale
+	})
+
+	return y
+}
+
+// Backward spreads the error of every window evenly over its pixels
+func (a *AvgPool2D) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	dx := a.deltaIn[proc].RawVector().Data
+	for idx := range dx {
+		dx[idx] = 0
+	}
+	scale := 1 / float64(a.Size*a.Size)
+
+	a.window(func(out int, in []int) {
+		for _, idx := range in {
+			dx[idx] += delta.At(out, 0) * scale
+		}
+	})
+
+	return a.deltaIn[proc]
+}
@@ -0,0 +1,209 @@
+// The prediction service of saved parGoNN networks, served by grpcserver.
+//
+// Regenerate the Go code with
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	    --go-grpc_out=. --go-grpc_opt=paths=source_relative predict.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: predict.proto
+
+package predictpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PredictionService_Predict_FullMethodName       = "/pargonn.v1.PredictionService/Predict"
+	PredictionService_PredictStream_FullMethodName = "/pargonn.v1.PredictionService/PredictStream"
+	PredictionService_ModelMetadata_FullMethodName = "/pargonn.v1.PredictionService/ModelMetadata"
+)
+
+// PredictionServiceClient is the client API for PredictionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PredictionService predicts with the networks of a network.Server
+type PredictionServiceClient interface {
+	// Predict predicts the instances of a request
+	Predict(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (*PredictResponse, error)
+	// PredictStream responds with the predictions of every request on the stream, in order
+	PredictStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[PredictRequest, PredictResponse], error)
+	// ModelMetadata returns the layer sizes and model file of a network
+	ModelMetadata(ctx context.Context, in *ModelMetadataRequest, opts ...grpc.CallOption) (*ModelMetadataResponse, error)
+}
+
+type predictionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPredictionServiceClient(cc grpc.ClientConnInterface) PredictionServiceClient {
+	return &predictionServiceClient{cc}
+}
+
+func (c *predictionServiceClient) Predict(ctx context.Context, in *PredictRequest, opts ...grpc.CallOption) (*PredictResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PredictResponse)
+	err := c.cc.Invoke(ctx, PredictionService_Predict_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *predictionServiceClient) PredictStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[PredictRequest, PredictResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PredictionService_ServiceDesc.Streams[0], PredictionService_PredictStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PredictRequest, PredictResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PredictionService_PredictStreamClient = grpc.BidiStreamingClient[PredictRequest, PredictResponse]
+
+func (c *predictionServiceClient) ModelMetadata(ctx context.Context, in *ModelMetadataRequest, opts ...grpc.CallOption) (*ModelMetadataResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ModelMetadataResponse)
+	err := c.cc.Invoke(ctx, PredictionService_ModelMetadata_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PredictionServiceServer is the server API for PredictionService service.
+// All implementations must embed UnimplementedPredictionServiceServer
+// for forward compatibility.
+//
+// PredictionService predicts with the networks of a network.Server
+type PredictionServiceServer interface {
+	// Predict predicts the instances of a request
+	Predict(context.Context, *PredictRequest) (*PredictResponse, error)
+	// PredictStream responds with the predictions of every request on the stream, in order
+	PredictStream(grpc.BidiStreamingServer[PredictRequest, PredictResponse]) error
+	// ModelMetadata returns the layer sizes and model file of a network
+	ModelMetadata(context.Context, *ModelMetadataRequest) (*ModelMetadataResponse, error)
+	mustEmbedUnimplementedPredictionServiceServer()
+}
+
+// UnimplementedPredictionServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPredictionServiceServer struct{}
+
+func (UnimplementedPredictionServiceServer) Predict(context.Context, *PredictRequest) (*PredictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Predict not implemented")
+}
+func (UnimplementedPredictionServiceServer) PredictStream(grpc.BidiStreamingServer[PredictRequest, PredictResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PredictStream not implemented")
+}
+func (UnimplementedPredictionServiceServer) ModelMetadata(context.Context, *ModelMetadataRequest) (*ModelMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ModelMetadata not implemented")
+}
+func (UnimplementedPredictionServiceServer) mustEmbedUnimplementedPredictionServiceServer() {}
+func (UnimplementedPredictionServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafePredictionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PredictionServiceServer will
+// result in compilation errors.
+type UnsafePredictionServiceServer interface {
+	mustEmbedUnimplementedPredictionServiceServer()
+}
+
+func RegisterPredictionServiceServer(s grpc.ServiceRegistrar, srv PredictionServiceServer) {
+	// If the following call pancis, it indicates UnimplementedPredictionServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PredictionService_ServiceDesc, srv)
+}
+
+func _PredictionService_Predict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PredictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PredictionServiceServer).Predict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PredictionService_Predict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PredictionServiceServer).Predict(ctx, req.(*PredictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PredictionService_PredictStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PredictionServiceServer).PredictStream(&grpc.GenericServerStream[PredictRequest, PredictResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PredictionService_PredictStreamServer = grpc.BidiStreamingServer[PredictRequest, PredictResponse]
+
+func _PredictionService_ModelMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModelMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PredictionServiceServer).ModelMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PredictionService_ModelMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PredictionServiceServer).ModelMetadata(ctx, req.(*ModelMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PredictionService_ServiceDesc is the grpc.ServiceDesc for PredictionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PredictionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pargonn.v1.PredictionService",
+	HandlerType: (*PredictionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Predict",
+			Handler:    _PredictionService_Predict_Handler,
+		},
+		{
+			MethodName: "ModelMetadata",
+			Handler:    _PredictionService_ModelMetadata_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PredictStream",
+			Handler:       _PredictionService_PredictStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "predict.proto",
+}
@@ -0,0 +1,329 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// Preprocessor is a transformation of the input data that is fitted on the training data
+// and then applied to every input before it is fed to the network
+type Preprocessor interface {
+	Name() string
+	Fit(data [][]float64) error
+	Transform(x []float64) []float64
+}
+
+// preprocessorTypes maps preprocessor names to constructors, used when loading saved networks
+var preprocessorTypes = map[string]func() Preprocessor{
+	"standardScaler": func() Preprocessor { return &StandardScaler{} },
+	"minMaxScaler":   func() Preprocessor { return &MinMaxScaler{} },
+	"pcaWhitening":   func() Preprocessor { return &PCAWhitening{} },
+	"oneHotEncoder":  func() Preprocessor { return &OneHotEncoder{} },
+	"imputer":        func() Preprocessor { return &Imputer{} },
+}
+
+// RegisterPreprocessor makes a custom preprocessor available when loading saved networks
+func RegisterPreprocessor(name string, newPreprocessor func() Preprocessor) {
+	preprocessorTypes[name] = newPreprocessor
+}
+
+// Pipeline is a chain of preprocessors. Every step is fitted on the output of the previous steps
+type Pipeline struct {
+	Steps  []Preprocessor
+	Fitted bool
+}
+
+// NewPipeline returns an unfitted pipeline containing the given steps
+func NewPipeline(steps ...Preprocessor) *Pipeline {
+	return &Pipeline{Steps: steps}
+}
+
+// Fit fits every step of the pipeline to the data
+func (p *Pipeline) Fit(data [][]float64) error {
+	if len(data) == 0 {
+		return fmt.Errorf("cannot fit pipeline to empty data")
+	}
+
+	for _, step := range p.Steps {
+		if err := step.Fit(data); err != nil {
+			return fmt.Errorf("fitting %s: %v", step.Name(), err)
+		}
+		transformed := make([][]float64, len(data))
+		for idx := range data {
+			transformed[idx] = step.Transform(data[idx])
+		}
+		data = transformed
+	}
+
+	p.Fitted = true
+	return nil
+}
+
+// Transform applies every step of the pipeline to x
+func (p *Pipeline) Transform(x []float64) []float64 {
+	for _, step := range p.Steps {
+		x = step.Transform(x)
+	}
+	return x
+}
+
+// TransformAll applies the pipeline to every entry in data
+func (p *Pipeline) TransformAll(data [][]float64) [][]float64 {
+	transformed := make([][]float64, len(data))
+	for idx := range data {
+		transformed[idx] = p.Transform(data[idx])
+	}
+	return transformed
+}
+
+// columnStats calls f with the non-missing (non-NaN) values of every column in data
+func columnStats(data [][]float64, f func(col int, values []float64)) {
+	values := make([]float64, 0, len(data))
+	for col := range data[0] {
+		values = values[:0]
+		for idx := range data {
+			if !math.IsNaN(data[idx][col]) {
+				values = append(values, data[idx][col])
+			}
+		}
+		f(col, values)
+	}
+}
+
+// StandardScaler scales every feature to zero mean and unit variance
+type StandardScaler struct {
+	Mean []float64
+	Std  []float64
+}
+
+func (s *StandardScaler) Name() string { return "standardScaler" }
+
+func (s *StandardScaler) Fit(data [][]float64) error {
+	s.Mean = make([]float64, len(data[0]))
+	s.Std = make([]float64, len(data[0]))
+	columnStats(data, func(col int, values []float64) {
+		s.Mean[col], s.Std[col] = 0, 1
+		if len(values) > 0 {
+			s.Mean[col], s.Std[col] = meanAndStd(values)
+		}
+		if s.Std[col] == 0 {
+			s.Std[col] = 1
+		}
+	})
+	return nil
+}
+
+func (s *StandardScaler) Transform(x []float64) []float64 {
+	y := make([]float64, len(x))
+	for idx := range x {
+		y[idx] = (x[idx] - s.Mean[idx]) / s.Std[idx]
+	}
+	return y
+}
+
+// MinMaxScaler scales every feature to the range [0, 1]
+type MinMaxScaler struct {
+	Min []float64
+	Max []float64
+}
+
+func (s *MinMaxScaler) Name() string { return "minMaxScaler" }
+
+func (s *MinMaxScaler) Fit(data [][]float64) error {
+	s.Min = make([]float64, len(data[0]))
+	s.Max = make([]float64, len(data[0]))
+	columnStats(data, func(col int, values []float64) {
+		s.Min[col], s.Max[col] = math.Inf(1), math.Inf(-1)
+		for _, v := range values {
+			s.Min[col] = math.Min(s.Min[col], v)
+			s.Max[col] = math.Max(s.Max[col], v)
+		}
+		if len(values) == 0 {
+			s.Min[col], s.Max[col] = 0, 1
+		}
+	})
+	return nil
+}
+
+func (s *MinMaxScaler) Transform(x []float64) []float64 {
+	y := make([]float64, len(x))
+	for idx := range x {
+		if s.Max[idx] == s.Min[idx] {
+			y[idx] = 0
+			continue
+		}
+		y[idx] = (x[idx] - s.Min[idx]) / (s.Max[idx] - s.Min[idx])
+	}
+	return y
+}
+
+// PCAWhitening projects the data onto its NComponents principal components (all if zero),
+// and scales every component to unit variance. Epsilon is added to the variances for stability
+type PCAWhitening struct {
+	NComponents int
+	Epsilon     float64
+	Mean        []float64
+	Components  [][]float64
+}
+
+func (p *PCAWhitening) Name() string { return "pcaWhitening" }
+
+func (p *PCAWhitening) Fit(data [][]float64) error {
+	rows, cols := len(data), len(data[0])
+	if rows < 2 {
+		return fmt.Errorf("need at least two samples, got %d", rows)
+	}
+
+	nComponents := p.NComponents
+	if nComponents <= 0 || nComponents > cols {
+		nComponents = cols
+	}
+
+	p.Mean = make([]float64, cols)
+	for idx := range data {
+		for col := range data[idx] {
+			p.Mean[col] += data[idx][col] / float64(rows)
+		}
+	}
+
+	centered := mat64.NewDense(rows, cols, nil)
+	for idx := range data {
+		for col := range data[idx] {
+			centered.Set(idx, col, data[idx][col]-p.Mean[col])
+		}
+	}
+
+	covariance := mat64.NewSymDense(cols, nil)
+	covariance.SymOuterK(1/float64(rows-1), centered.T())
+
+	var eigen mat64.EigenSym
+	if !eigen.Factorize(covariance, true) {
+		return fmt.Errorf("eigen decomposition of the covariance matrix failed")
+	}
+	values := eigen.Values(nil)
+	vectors := mat64.NewDense(cols, cols, nil)
+	vectors.EigenvectorsSym(&eigen)
+
+	// Eigenvalues are returned in ascending order
+	order := make([]int, cols)
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.Slice(order, func(i, j int) bool { return values[order[i]] > values[order[j]] })
+
+	p.Components = make([][]float64, nComponents)
+	for k := range p.Components {
+		scale := 1 / math.Sqrt(math.Max(values[order[k]], 0)+p.Epsilon)
+		p.Components[k] = mat64.Col(nil, order[k], vectors)
+		for col := range p.Components[k] {
+			p.Components[k][col] *= scale
+		}
+	}
+
+	return nil
+}
+
+func (p *PCAWhitening) Transform(x []float64) []float64 {
+	y := make([]float64, len(p.Components))
+	for k := range p.Components {
+		for col := range x {
+			y[k] += p.Components[k][col] * (x[col] - p.Mean[col])
+		}
+	}
+	return y
+}
+
+// OneHotEncoder replaces each of the categorical Columns with a one-hot encoding
+// of the categories seen during fitting. Unseen categories are encoded as all zeros
+type OneHotEncoder struct {
+	Columns    []int
+	Categories [][]float64
+}
+
+func (e *OneHotEncoder) Name() string { return "oneHotEncoder" }
+
+func (e *OneHotEncoder) Fit(data [][]float64) error {
+	e.Categories = make([][]float64, len(e.Columns))
+	for k, col := range e.Columns {
+		if col < 0 || col >= len(data[0]) {
+			return fmt.Errorf("column %d out of range", col)
+		}
+
+		seen := make(map[float64]bool)
+		for idx := range data {
+			if !seen[data[idx][col]] && !math.IsNaN(data[idx][col]) {
+				seen[data[idx][col]] = true
+				e.Categories[k] = append(e.Categories[k], data[idx][col])
+			}
+		}
+		sort.Float64s(e.Categories[k])
+	}
+	return nil
+}
+
+func (e *OneHotEncoder) Transform(x []float64) []float64 {
+	categorical := make(map[int]int)
+	for k, col := range e.Columns {
+		categorical[col] = k
+	}
+
+	var y []float64
+	for col := range x {
+		k, ok := categorical[col]
+		if !ok {
+			y = append(y, x[col])
+			continue
+		}
+
+		oneHot := make([]float64, len(e.Categories[k]))
+		if idx := sort.SearchFloat64s(e.Categories[k], x[col]); idx < len(oneHot) && e.Categories[k][idx] == x[col] {
+			oneHot[idx] = 1
+		}
+		y = append(y, oneHot...)
+	}
+	return y
+}
+
+// Imputer replaces missing values (NaN) with the mean or median of the feature,
+// given by Strategy ("mean" if empty)
+type Imputer struct {
+	Strategy string
+	Values   []float64
+}
+
+func (im *Imputer) Name() string { return "imputer" }
+
+func (im *Imputer) Fit(data [][]float64) error {
+	if im.Strategy != "" && im.Strategy != "mean" && im.Strategy != "median" {
+		return fmt.Errorf("unknown strategy %q", im.Strategy)
+	}
+
+	im.Values = make([]float64, len(data[0]))
+	columnStats(data, func(col int, values []float64) {
+		if len(values) == 0 {
+			return
+		}
+		if im.Strategy == "median" {
+			sorted := append([]float64(nil), values...)
+			sort.Float64s(sorted)
+			im.Values[col] = (sorted[(len(sorted)-1)/2] + sorted[len(sorted)/2]) / 2
+			return
+		}
+		im.Values[col], _ = meanAndStd(values)
+	})
+	return nil
+}
+
+func (im *Imputer) Transform(x []float64) []float64 {
+	y := make([]float64, len(x))
+	for idx := range x {
+		y[idx] = x[idx]
+		if math.IsNaN(x[idx]) {
+			y[idx] = im.Values[idx]
+		}
+	}
+	return y
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandardScaler(t *testing.T) {
+	s := &StandardScaler{}
+	assert.NoError(t, s.Fit([][]float64{{1, 5}, {3, 5}}))
+	assert.Equal(t, []float64{-1, 0}, s.Transform([]float64{1, 5}))
+	assert.Equal(t, []float64{1, 0}, s.Transform([]float64{3, 5}))
+}
+
+func TestMinMaxScaler(t *testing.T) {
+	s := &MinMaxScaler{}
+	assert.NoError(t, s.Fit([][]float64{{0, 2}, {4, 2}, {2, 2}}))
+	assert.Equal(t, []float64{0.5, 0}, s.Transform([]float64{2, 2}))
+}
+
+func TestPCAWhitening(t *testing.T) {
+	data := [][]float64{{1, 2}, {2, 4.5}, {3, 5.5}, {4, 8.5}, {5, 9.5}, {6, 12}}
+	p := &PCAWhitening{}
+	assert.NoError(t, p.Fit(data))
+
+	// The whitened data has the identity as covariance matrix
+	transformed := make([][]float64, len(data))
+	for idx := range data {
+		transformed[idx] = p.Transform(data[idx])
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			var cov float64
+			for idx := range transformed {
+				cov += transformed[idx][i] * transformed[idx][j] / float64(len(data)-1)
+			}
+			if i == j {
+				assert.InDelta(t, 1, cov, 1e-9)
+			} else {
+				assert.InDelta(t, 0, cov, 1e-9)
+			}
+		}
+	}
+
+	p = &PCAWhitening{NComponents: 1}
+	assert.NoError(t, p.Fit(data))
+	assert.Equal(t, 1, len(p.Transform(data[0])))
+}
+
+func TestOneHotEncoder(t *testing.T) {
+	e := &OneHotEncoder{Columns: []int{1}}
+	assert.NoError(t, e.Fit([][]float64{{0.5, 2}, {0.1, 7}, {0.3, 2}}))
+	assert.Equal(t, []float64{0.5, 1, 0, 9}, e.Transform([]float64{0.5, 2, 9}))
+	assert.Equal(t, []float64{0.5, 0, 1, 9}, e.Transform([]float64{0.5, 7, 9}))
+	assert.Equal(t, []float64{0.5, 0, 0, 9}, e.Transform([]float64{0.5, 3, 9}))
+}
+
+func TestImputer(t *testing.T) {
+	data := [][]float64{{1, math.NaN()}, {math.NaN(), 4}, {5, 1}, {6, 2}}
+
+	im := &Imputer{}
+	assert.NoError(t, im.Fit(data))
+	assert.Equal(t, []float64{4, 2.5}, im.Transform([]float64{math.NaN(), 2.5}))
+	assert.Equal(t, []float64{3, 7.0 / 3}, im.Transform([]float64{3, math.NaN()}))
+
+	im = &Imputer{Strategy: "median"}
+	assert.NoError(t, im.Fit(data))
+	assert.Equal(t, []float64{5, 2}, im.Transform([]float64{math.NaN(), math.NaN()}))
+}
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline(&Imputer{}, &StandardScaler{})
+	assert.NoError(t, p.Fit([][]float64{{1}, {math.NaN()}, {3}}))
+	assert.True(t, p.Fitted)
+	assert.Equal(t, []float64{0}, p.Transform([]float64{math.NaN()}))
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Pruner decides from the score of a trial at the end of an epoch whether the trial
+// should be stopped. Prune is called concurrently by the trials of a tuner
+type Pruner interface {
+	Prune(trial, epoch int, score float64) bool
+}
+
+// SuccessiveHalving is asynchronous successive halving. Rungs are placed after MinEpochs epochs,
+// and at every Reduction times as many epochs after that. A trial reaching a rung is pruned
+// unless its score is among the best 1/Reduction of the scores reported at the rung so far.
+// MinEpochs defaults to 1 and Reduction to 3
+type SuccessiveHalving struct {
+	MinEpochs int
+	Reduction int
+
+	mu    sync.Mutex
+	rungs map[int][]float64
+}
+
+// reduction returns the reduction factor, or the default of 3
+func (sh *SuccessiveHalving) reduction() int {
+	if sh.Reduction < 2 {
+		return 3
+	}
+	return sh.Reduction
+}
+
+// isRung returns true if a rung is placed after the given number of epochs
+func (sh *SuccessiveHalving) isRung(epochs int) bool {
+	rung := sh.MinEpochs
+	if rung < 1 {
+		rung = 1
+	}
+	for rung < epochs {
+		rung *= sh.reduction()
+	}
+	return rung == epochs
+}
+
+// Prune records the score of a trial reaching a rung, and returns true if it is
+// not among the best scores of the rung. NaN scores are always pruned
+func (sh *SuccessiveHalving) Prune(trial, epoch int, score float64) bool {
+	epochs := epoch + 1
+	if !sh.isRung(epochs) {
+		return false
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.rungs == nil {
+		sh.rungs = make(map[int][]float64)
+	}
+	if math.IsNaN(score) {
+		return true
+	}
+	sh.rungs[epochs] = append(sh.rungs[epochs], score)
+
+	scores := make([]float64, len(sh.rungs[epochs]))
+	copy(scores, sh.rungs[epochs])
+	sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+	keep := len(scores) / sh.reduction()
+	if keep < 1 {
+		keep = 1
+	}
+	return score < scores[keep-1]
+}
+
+// Hyperband runs brackets of successive halving with rungs starting after MinEpochs,
+// MinEpochs*Reduction, ... epochs up to MaxEpochs, so that configurations that start slowly
+// are not all pruned after a few epochs. The trials are assigned to the brackets in turn
+type Hyperband struct {
+	MinEpochs int
+	MaxEpochs int
+	Reduction int
+
+	once     sync.Once
+	brackets []*SuccessiveHalving
+}
+
+// init creates the brackets of successive halving
+func (hb *Hyperband) init() {
+	sh := &SuccessiveHalving{MinEpochs: hb.MinEpochs, Reduction: hb.Reduction}
+	if sh.MinEpochs < 1 {
+		sh.MinEpochs = 1
+	}
+	for min := sh.MinEpochs; min <= hb.MaxEpochs || len(hb.brackets) == 0; min *= sh.reduction() {
+		hb.brackets = append(hb.brackets, &SuccessiveHalving{MinEpochs: min, Reduction: sh.reduction()})
+	}
+}
+
+// Prune prunes the trial by the successive halving of its bracket
+func (hb *Hyperband) Prune(trial, epoch int, score float64) bool {
+	hb.once.Do(hb.init)
+	return hb.brackets[trial%len(hb.brackets)].Prune(trial, epoch, score)
+}
@@ -2,16 +2,28 @@ package network
 
 import (
 	"math/rand"
-	"time"
 	"math"
 )
 
+// weightSource is the source of the random initial parameters of a layer, set by SetRand
+type weightSource struct {
+	rng *rand.Rand
+}
+
+// SetRand sets the source of the random initial parameters of the layer
+func (w *weightSource) SetRand(rng *rand.Rand) {
+	w.rng = rng
+}
+
 // randomFunc returns a func that
-// generates a random number
-func randomFunc() func(int) float64 {
-	rand.Seed(time.Now().UnixNano())
+// generates a random number, with rng if not nil
+func randomFunc(rng *rand.Rand) func(int) float64 {
+	normal := rand.NormFloat64
+	if rng != nil {
+		normal = rng.NormFloat64
+	}
 	return func(size int) float64 {
-		return float64(rand.NormFloat64()) / math.Sqrt(float64(size))
+		return float64(normal()) / math.Sqrt(float64(size))
 	}
 }
 
@@ -0,0 +1,351 @@
+package network
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// recurrentStep contains the values of a recurrent layer at a single step of a sequence
+type recurrentStep struct {
+	x  []float64 // input at the step
+	zh []float64 // hidden state part of the gate z-s
+	g  []float64 // gate values
+	h  []float64 // hidden state
+	c  []float64 // cell state (LSTM)
+}
+
+// cell computes the steps of a recurrent layer. The gate z-s are
+// zx + zh, with zx = Wx^T x + b and zh = Wh^T hPrev
+type cell interface {
+	// forward computes the gates and the hidden (and cell) state of step s
+	forward(s *recurrentStep, zx, hPrev, cPrev []float64)
+	// backward computes the errors at the gate z-s given the errors dh and dc at the hidden
+	// and cell states of step s, separately for zx (dzx) and zh (dzh), as well as the errors
+	// passed on directly (not through Wh) to the previous hidden and cell states
+	backward(s *recurrentStep, dh, dc, hPrev, cPrev, dzx, dzh, dhPrev, dcPrev []float64)
+}
+
+// recurrent contains the configuration and containers shared by the recurrent layers.
+// The input is a sequence of Steps vectors, stored as a single vector step by step. With
+// ReturnSequences (many-to-many) the hidden states of every step are returned the same way,
+// otherwise (many-to-one) only the last hidden state is returned. With Truncate > 0,
+// errors are backpropagated through time within chunks of Truncate steps, counted from
+// the last step
+type recurrent struct {
+	Units           int
+	Steps           int
+	ReturnSequences bool
+	Truncate        int
+	cell            cell
+	gates           int
+	features        int
+	wx              *mat64.Dense
+	wh              *mat64.Dense
+	biases          *mat64.Vector
+	params          []*Param
+	nablaWx         []*mat64.Dense
+	nablaWh         []*mat64.Dense
+	nablaB          []*mat64.Vector
+	grads           [][]*mat64.Dense
+	steps           [][]recurrentStep
+	a               []*mat64.Vector
+	deltaIn         []*mat64.Vector
+	zeros           []float64
+	weightSource
+}
+
+// init initiates the weights and biases of a layer with the given cell and number of gates
+func (r *recurrent) init(inputSize int, c cell, gates int) (int, error) {
+	if r.Units <= 0 || r.Steps <= 0 || r.Truncate < 0 {
+		return 0, fmt.Errorf("invalid units %d, steps %d or truncate %d", r.Units, r.Steps, r.Truncate)
+	}
+	if inputSize%r.Steps != 0 {
+		return 0, fmt.Errorf("input size %d is not a multiple of %d steps", inputSize, r.Steps)
+	}
+
+	r.cell = c
+	r.gates = gates
+	r.features = inputSize / r.Steps
+	r.zeros = make([]float64, r.Units)
+
+	r.wx = sliceWithGonumDense(1, []int{r.features}, []int{gates * r.Units}, randomFunc(r.rng))[0]
+	r.wh = sliceWithGonumDense(1, []int{r.Units}, []int{gates * r.Units}, randomFunc(r.rng))[0]
+	r.biases = sliceWithGonumVector(1, []int{gates * r.Units}, randomFunc(r.rng))[0]
+	r.params = []*Param{{Value: r.wx, Regularize: true}, {Value: r.wh, Regularize: true}, {Value: vectorAsDense(r.biases)}}
+
+	if r.ReturnSequences {
+		return r.Steps * r.Units, nil
+	}
+	return r.Units, nil
+}
+
+// newSteps allocates the values of every step of a sequence. The hidden
+// states are stored in the output vector, which is returned as well
+func (r *recurrent) newSteps() ([]recurrentStep, *mat64.Vector) {
+	h := make([]float64, r.Steps*r.Units)
+	steps := make([]recurrentStep, r.Steps)
+	for t := range steps {
+		steps[t] = recurrentStep{
+			zh: make([]float64, r.gates*r.Units),
+			g:  make([]float64, r.gates*r.Units),
+			h:  h[t*r.Units : (t+1)*r.Units],
+			c:  make([]float64, r.Units),
+		}
+	}
+
+	if r.ReturnSequences {
+		return steps, mat64.NewVector(len(h), h)
+	}
+	return steps, mat64.NewVector(r.Units, steps[r.Steps-1].h)
+}
+
+// Alloc allocates the containers and gradients for every core
+func (r *recurrent) Alloc(nCores int) {
+	r.nablaWx = sliceWithGonumDense(nCores, repeat(r.features, nCores), repeat(r.gates*r.Units, nCores), zeroFunc())
+	r.nablaWh = sliceWithGonumDense(nCores, repeat(r.Units, nCores), repeat(r.gates*r.Units, nCores), zeroFunc())
+	r.nablaB = sliceWithGonumVector(nCores, repeat(r.gates*r.Units, nCores), zeroFunc())
+	r.deltaIn = sliceWithGonumVector(nCores, repeat(r.Steps*r.features, nCores), zeroFunc())
+
+	r.steps = make([][]recurrentStep, nCores)
+	r.a = make([]*mat64.Vector, nCores)
+	r.grads = make([][]*mat64.Dense, nCores)
+	for proc := range r.grads {
+		r.steps[proc], r.a[proc] = r.newSteps()
+		r.grads[proc] = []*mat64.Dense{r.nablaWx[proc], r.nablaWh[proc], vectorAsDense(r.nablaB[proc])}
+	}
+}
+
+// Forward feeds the sequence x through the layer, one step at a time
+func (r *recurrent) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var steps []recurrentStep
+	var a *mat64.Vector
+	if proc == inference {
+		steps, a = r.newSteps()
+	} else {
+		steps, a = r.steps[proc], r.a[proc]
+	}
+
+	zx := mat64.NewVector(r.gates*r.Units, nil)
+	hPrev, cPrev := r.zeros, r.zeros
+	for t := range steps {
+		s := &steps[t]
+		s.x = x.RawVector().Data[t*r.features : (t+1)*r.features]
+
+		zx.MulVec(r.wx.T(), mat64.NewVector(r.features, s.x))
+		zx.AddVec(zx, r.biases)
+		mat64.NewVector(len(s.zh), s.zh).MulVec(r.wh.T(), mat64.NewVector(r.Units, hPrev))
+
+		r.cell.forward(s, zx.RawVector().Data, hPrev, cPrev)
+		hPrev, cPrev = s.h, s.c
+	}
+
+	return a
+}
+
+// Backward backpropagates the error through time, adds the gradients
+// of every step, and returns the error at every step of the input
+func (r *recurrent) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	steps := r.steps[proc]
+	dh := mat64.NewVector(r.Units, nil)
+	dc := make([]float64, r.Units)
+	dzx := mat64.NewVector(r.gates*r.Units, nil)
+	dzh := mat64.NewVector(r.gates*r.Units, nil)
+	dhPrev, dcPrev := make([]float64, r.Units), make([]float64, r.Units)
+	deltaIn := r.deltaIn[proc].RawVector().Data
+
+	for t := r.Steps - 1; t >= 0; t-- {
+		s := &steps[t]
+		hPrev, cPrev := r.zeros, r.zeros
+		if t > 0 {
+			hPrev, cPrev = steps[t-1].h, steps[t-1].c
+		}
+
+		if r.ReturnSequences {
+			dh.AddVec(dh, delta.ViewVec(t*r.Units, r.Units))
+		} else if t == r.Steps-1 {
+			dh.AddVec(dh, delta)
+		}
+
+		r.cell.backward(s, dh.RawVector().Data, dc, hPrev, cPrev,
+			dzx.RawVector().Data, dzh.RawVector().Data, dhPrev, dcPrev)
+
+		r.nablaB[proc].AddVec(r.nablaB[proc], dzx)
+		r.nablaWx[proc].RankOne(r.nablaWx[proc], 1, mat64.NewVector(r.features, s.x), dzx)
+		r.nablaWh[proc].RankOne(r.nablaWh[proc], 1, mat64.NewVector(r.Units, hPrev), dzh)
+		mat64.NewVector(r.features, deltaIn[t*r.features:(t+1)*r.features]).MulVec(r.wx, dzx)
+
+		if r.Truncate > 0 && (r.Steps-t)%r.Truncate == 0 {
+			zeroVec(dh)
+			for j := range dc {
+				dc[j] = 0
+			}
+			continue
+		}
+
+		dh.MulVec(r.wh, dzh)
+		dh.AddVec(dh, mat64.NewVector(r.Units, dhPrev))
+		copy(dc, dcPrev)
+	}
+
+	return r.deltaIn[proc]
+}
+
+// Params returns the input weights, the hidden state weights and the biases (as a column
+// matrix). The weights of the gates are stored next to each other, Units columns per gate
+func (r *recurrent) Params() []*Param {
+	return r.params
+}
+
+// Grads returns the weight and bias gradients at proc
+func (r *recurrent) Grads(proc int) []*mat64.Dense {
+	return r.grads[proc]
+}
+
+// SequenceSteps returns the number of steps of the input sequences
+func (r *recurrent) SequenceSteps() int {
+	return r.Steps
+}
+
+// RNN is a simple recurrent layer, h = f(Wx^T x + Wh^T hPrev + b)
+// with the activation function f (default tanh)
+type RNN struct {
+	recurrent
+	Activation string
+	activationFunction
+}
+
+// NewRNN returns a simple recurrent layer with tanh activation
+func NewRNN(units, steps int, returnSequences bool) *RNN {
+	return &RNN{recurrent: recurrent{Units: units, Steps: steps, ReturnSequences: returnSequences}}
+}
+
+func (l *RNN) Name() string { return "rnn" }
+
+// Init initiates the weights and biases with random numbers
+func (l *RNN) Init(inputSize int) (int, error) {
+	if l.Activation == "" {
+		l.Activation = "tanh"
+	}
+	af, ok := activationFunctions[l.Activation]
+	if !ok {
+		return 0, fmt.Errorf("unknown activation function %q", l.Activation)
+	}
+	l.activationFunction = af
+
+	return l.init(inputSize, l, 1)
+}
+
+func (l *RNN) forward(s *recurrentStep, zx, hPrev, cPrev []float64) {
+	for j := range s.h {
+		s.g[j] = zx[j] + s.zh[j]
+		s.h[j] = l.function(s.g[j])
+	}
+}
+
+func (l *RNN) backward(s *recurrentStep, dh, dc, hPrev, cPrev, dzx, dzh, dhPrev, dcPrev []float64) {
+	for j := range dh {
+		dzx[j] = dh[j] * l.prime(s.g[j])
+		dzh[j] = dzx[j]
+		dhPrev[j] = 0
+		dcPrev[j] = 0
+	}
+}
+
+// LSTM is a long short-term memory layer with input, forget and output gates
+type LSTM struct {
+	recurrent
+}
+
+// NewLSTM returns a long short-term memory layer
+func NewLSTM(units, steps int, returnSequences bool) *LSTM {
+	return &LSTM{recurrent{Units: units, Steps: steps, ReturnSequences: returnSequences}}
+}
+
+func (l *LSTM) Name() string { return "lstm" }
+
+// Init initiates the weights and biases of the input, forget
+// and output gates and the cell input with random numbers
+func (l *LSTM) Init(inputSize int) (int, error) {
+	return l.init(inputSize, l, 4)
+}
+
+func (l *LSTM) forward(s *recurrentStep, zx, hPrev, cPrev []float64) {
+	u := l.Units
+	for j := 0; j < u; j++ {
+		i := Sigmoid(zx[j] + s.zh[j])
+		f := Sigmoid(zx[u+j] + s.zh[u+j])
+		o := Sigmoid(zx[2*u+j] + s.zh[2*u+j])
+		g := math.Tanh(zx[3*u+j] + s.zh[3*u+j])
+		s.g[j], s.g[u+j], s.g[2*u+j], s.g[3*u+j] = i, f, o, g
+
+		s.c[j] = f*cPrev[j] + i*g
+		s.h[j] = o * math.Tanh(s.c[j])
+	}
+}
+
+func (l *LSTM) backward(s *recurrentStep, dh, dc, hPrev, cPrev, dzx, dzh, dhPrev, dcPrev []float64) {
+	u := l.Units
+	for j := 0; j < u; j++ {
+		i, f, o, g := s.g[j], s.g[u+j], s.g[2*u+j], s.g[3*u+j]
+		tc := math.Tanh(s.c[j])
+		dcTotal := dc[j] + dh[j]*o*(1-tc*tc)
+
+		dzx[j] = dcTotal * g * i * (1 - i)
+		dzx[u+j] = dcTotal * cPrev[j] * f * (1 - f)
+		dzx[2*u+j] = dh[j] * tc * o * (1 - o)
+		dzx[3*u+j] = dcTotal * i * (1 - g*g)
+
+		dhPrev[j] = 0
+		dcPrev[j] = dcTotal * f
+	}
+	copy(dzh, dzx)
+}
+
+// GRU is a gated recurrent unit layer with reset and update gates
+type GRU struct {
+	recurrent
+}
+
+// NewGRU returns a gated recurrent unit layer
+func NewGRU(units, steps int, returnSequences bool) *GRU {
+	return &GRU{recurrent{Units: units, Steps: steps, ReturnSequences: returnSequences}}
+}
+
+func (l *GRU) Name() string { return "gru" }
+
+// Init initiates the weights and biases of the reset and
+// update gates and the candidate state with random numbers
+func (l *GRU) Init(inputSize int) (int, error) {
+	return l.init(inputSize, l, 3)
+}
+
+func (l *GRU) forward(s *recurrentStep, zx, hPrev, cPrev []float64) {
+	u := l.Units
+	for j := 0; j < u; j++ {
+		r := Sigmoid(zx[j] + s.zh[j])
+		z := Sigmoid(zx[u+j] + s.zh[u+j])
+		n := math.Tanh(zx[2*u+j] + r*s.zh[2*u+j])
+		s.g[j], s.g[u+j], s.g[2*u+j] = r, z, n
+
+		s.h[j] = (1-z)*n + z*hPrev[j]
+	}
+}
+
+func (l *GRU) backward(s *recurrentStep, dh, dc, hPrev, cPrev, dzx, dzh, dhPrev, dcPrev []float64) {
+	u := l.Units
+	for j := 0; j < u; j++ {
+		r, z, n := s.g[j], s.g[u+j], s.g[2*u+j]
+
+		dn := dh[j] * (1 - z) * (1 - n*n)
+		dzx[j] = dn * s.zh[2*u+j] * r * (1 - r)
+		dzx[u+j] = dh[j] * (hPrev[j] - n) * z * (1 - z)
+		dzx[2*u+j] = dn
+
+		dzh[j], dzh[u+j], dzh[2*u+j] = dzx[j], dzx[u+j], dn*r
+
+		dhPrev[j] = dh[j] * z
+		dcPrev[j] = 0
+	}
+}
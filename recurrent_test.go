@@ -0,0 +1,95 @@
+package network
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurrentGradients(t *testing.T) {
+	for _, returnSequences := range []bool{false, true} {
+		checkLayerGradients(t, NewRNN(3, 4, returnSequences), 8)
+		checkLayerGradients(t, NewLSTM(3, 4, returnSequences), 8)
+		checkLayerGradients(t, NewGRU(3, 4, returnSequences), 8)
+	}
+}
+
+func TestTruncatedBPTT(t *testing.T) {
+	l := NewLSTM(3, 5, false)
+	l.Truncate = 2
+	_, err := l.Init(10)
+	assert.NoError(t, err)
+	l.Alloc(1)
+
+	x := randomVectors(1, 10)[0]
+	l.Forward(x, 0)
+	dx := l.Backward(mat64.NewVector(3, []float64{1, -1, 0.5}), 0)
+
+	// Only the last two steps (of two features each) get errors
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, 0.0, dx.At(i, 0))
+	}
+	assert.NotEqual(t, 0.0, mat64.Norm(dx.ViewVec(6, 4), 2))
+}
+
+func TestFlattenSequence(t *testing.T) {
+	x, err := FlattenSequence([][]float64{{1, 2}, {3, 4}}, 3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0, 0, 1, 2, 3, 4}, x)
+
+	x, err = FlattenSequence([][]float64{{1, 2}, {3, 4}, {5, 6}}, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{3, 4, 5, 6}, x)
+
+	_, err = FlattenSequence([][]float64{{1, 2}, {3}}, 2, 2)
+	assert.Error(t, err)
+
+	windows := SlidingWindows([][]float64{{1}, {2}, {3}, {4}, {5}}, 3, 2)
+	assert.Equal(t, [][][]float64{{{1}, {2}, {3}}, {{3}, {4}, {5}}}, windows)
+}
+
+func TestRecurrentNetwork(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(6, nil, nil)
+	assert.NoError(t, n.Add(NewGRU(4, 6, true)))
+	assert.NoError(t, n.Add(NewLSTM(4, 6, false)))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	assert.Equal(t, []int{6, 24, 4, 2}, n.Sizes)
+
+	// Is the first step of the sequence positive
+	var input [][][]float64
+	var output [][]float64
+	for idx := 0; idx < 40; idx++ {
+		seq := make([][]float64, 2+idx%5)
+		for t := range seq {
+			seq[t] = []float64{rand.NormFloat64()}
+		}
+		input = append(input, seq)
+		if seq[0][0] > 0 {
+			output = append(output, []float64{1, 0})
+		} else {
+			output = append(output, []float64{0, 1})
+		}
+	}
+
+	assert.NoError(t, n.LoadSequenceTrainingData(input, output))
+	n.TrainNetwork(2, 4, 0.5, 0, true, false, 2)
+
+	a, err := n.PredictSequence(input[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(a))
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	b, err := loaded.PredictSequence(input[0])
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	assert.Error(t, (&Network{Sizes: []int{2}}).LoadSequenceTrainingData(input, output))
+}
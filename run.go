@@ -0,0 +1,250 @@
+package network
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Run is a directory holding the files of a training run:
+//
+//	config.*            snapshot of the configuration of the run
+//	metrics.csv         loss, duration and validation metrics of every epoch
+//	metrics.jsonl       the same metrics, as one JSON object per epoch
+//	checkpoints/        the network after every CheckpointEvery epochs
+//	model.json          the final network, or the checkpoint of the unfinished epoch
+//	                    for interrupted and failed runs
+//	summary.json        the RunSummary of the run
+//
+// A run is started with Start, which adds the epoch callback writing the metrics
+// and checkpoints, and is ended with Finish
+type Run struct {
+	Dir             string
+	CheckpointEvery int
+	Summary         RunSummary
+
+	csv     *os.File
+	jsonl   *os.File
+	columns []string
+	err     error
+}
+
+// RunSummary contains the metadata and results of a run. Final contains the
+// loss and validation metrics of the last epoch, and is left out when not finite.
+// Interrupted is set for runs stopped before their last epoch, e.g by TrainContext,
+// and Error is the error of runs where training failed
+type RunSummary struct {
+	Start             time.Time          `json:"start"`
+	End               time.Time          `json:"end"`
+	Duration          float64            `json:"durationSeconds"`
+	Host              string             `json:"host"`
+	GoVersion         string             `json:"goVersion"`
+	Cores             int                `json:"cores"`
+	Seed              int64              `json:"seed"`
+	Sizes             []int              `json:"sizes"`
+	TrainingSamples   int                `json:"trainingSamples"`
+	ValidationSamples int                `json:"validationSamples"`
+	Epochs            int                `json:"epochs"`
+	BestEpoch         int                `json:"bestEpoch"`
+	BestScore         float64            `json:"bestScore"`
+	Final             map[string]float64 `json:"final"`
+	Interrupted       bool               `json:"interrupted,omitempty"`
+	Error             string             `json:"error,omitempty"`
+}
+
+// NewRun creates the run directory dir, which must not exist or be empty
+func NewRun(dir string) (*Run, error) {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("run directory %s is not empty", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "checkpoints"), 0755); err != nil {
+		return nil, err
+	}
+	return &Run{Dir: dir}, nil
+}
+
+// SaveConfig saves a snapshot of the configuration of the run to config.<ext>
+func (r *Run) SaveConfig(ext string, data []byte) error {
+	return ioutil.WriteFile(filepath.Join(r.Dir, "config."+ext), data, 0644)
+}
+
+// Start records the metadata of the run, with the training and validation data loaded
+// in the network, and adds the epoch callback of the run to the network. The seed is
+// recorded, and given to SetSeed if it is not zero. The initial weights are not seeded by
+// Start, since the layers are initiated when added, see Network.SeedWeights
+func (r *Run) Start(n *Network, cores int, seed int64) error {
+	var err error
+	if r.csv, err = os.Create(filepath.Join(r.Dir, "metrics.csv")); err != nil {
+		return err
+	}
+	if r.jsonl, err = os.Create(filepath.Join(r.Dir, "metrics.jsonl")); err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	r.Summary = RunSummary{
+		Start:             time.Now(),
+		Host:              host,
+		GoVersion:         runtime.Version(),
+		Cores:             cores,
+		Seed:              seed,
+		Sizes:             n.Sizes,
+		TrainingSamples:   len(n.trainingInput),
+		ValidationSamples: len(n.validationInput),
+		BestScore:         math.NaN(),
+	}
+	if seed != 0 {
+		n.SetSeed(seed)
+	}
+
+	n.AddEpochCallback(r.Epoch)
+	return nil
+}
+
+// epochMetrics returns the loss, duration and validation metrics of the epoch by name
+func epochMetrics(result EpochResult) map[string]float64 {
+	m := map[string]float64{
+		"loss":     result.Loss,
+		"duration": result.Duration.Seconds(),
+	}
+	for name, v := range validationMetrics(result.Validation) {
+		m[name] = v
+	}
+	return m
+}
+
+// Epoch writes the metrics of the epoch and the checkpoint, if any. The columns of the
+// CSV file are given by the first epoch. Errors stop the writing, and are returned by Finish
+func (r *Run) Epoch(n *Network, result EpochResult) {
+	if r.err != nil {
+		return
+	}
+
+	m := epochMetrics(result)
+	if r.columns == nil {
+		r.columns = []string{"epoch"}
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		r.columns = append(r.columns, names...)
+		if r.err = writeCSVRow(r.csv, r.columns); r.err != nil {
+			return
+		}
+	}
+
+	row := []string{strconv.Itoa(result.Epoch)}
+	line := map[string]interface{}{"epoch": result.Epoch}
+	for _, name := range r.columns[1:] {
+		v, ok := m[name]
+		if !ok {
+			v = math.NaN()
+		}
+		row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+		line[name] = jsonFloat(v)
+	}
+	if r.err = writeCSVRow(r.csv, row); r.err != nil {
+		return
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, r.err = fmt.Fprintf(r.jsonl, "%s\n", data); r.err != nil {
+		return
+	}
+
+	r.Summary.Epochs = result.Epoch + 1
+	r.Summary.Final = make(map[string]float64)
+	for name, v := range m {
+		if name != "duration" && isFinite([]float64{v}) {
+			r.Summary.Final[name] = v
+		}
+	}
+	if result.Validation != nil {
+		if score := result.Validation.Score(); math.IsNaN(r.Summary.BestScore) || score > r.Summary.BestScore {
+			r.Summary.BestScore, r.Summary.BestEpoch = score, result.Epoch
+		}
+	}
+
+	if r.CheckpointEvery > 0 && (result.Epoch+1)%r.CheckpointEvery == 0 {
+		r.err = n.SaveFile(r.CheckpointPath(result.Epoch))
+	}
+}
+
+// CheckpointPath returns the path of the checkpoint saved after the epoch
+func (r *Run) CheckpointPath(epoch int) string {
+	return filepath.Join(r.Dir, "checkpoints", fmt.Sprintf("epoch-%04d.json", epoch))
+}
+
+// writeCSVRow writes a row to the CSV file
+func writeCSVRow(f *os.File, row []string) error {
+	w := csv.NewWriter(f)
+	w.Write(row)
+	w.Flush()
+	return w.Error()
+}
+
+// Finish closes the metrics files, saves the summary to summary.json and the final network
+// to model.json, and returns the first error of the run, if any. The network of interrupted
+// and failed runs is saved to the checkpoint of the unfinished epoch instead of model.json
+func (r *Run) Finish(n *Network) error {
+	for _, f := range []*os.File{r.csv, r.jsonl} {
+		if f == nil {
+			continue
+		}
+		if err := f.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	r.Summary.End = time.Now()
+	r.Summary.Duration = r.Summary.End.Sub(r.Summary.Start).Seconds()
+	summary := r.Summary
+	if math.IsNaN(summary.BestScore) {
+		summary.BestScore, summary.BestEpoch = 0, -1
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.Dir, "summary.json"), data, 0644); err != nil {
+		return err
+	}
+
+	return n.SaveFile(r.ModelPath())
+}
+
+// ModelPath returns the path Finish saves the network to
+func (r *Run) ModelPath() string {
+	if r.Summary.Interrupted || r.Summary.Error != "" {
+		return r.CheckpointPath(r.Summary.Epochs)
+	}
+	return filepath.Join(r.Dir, "model.json")
+}
+
+// LoadRunSummary reads the summary of the run in dir
+func LoadRunSummary(dir string) (RunSummary, error) {
+	var summary RunSummary
+	data, err := ioutil.ReadFile(filepath.Join(dir, "summary.json"))
+	if err != nil {
+		return summary, err
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return summary, fmt.Errorf("%s: %v", dir, err)
+	}
+	return summary, nil
+}
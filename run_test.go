@@ -0,0 +1,79 @@
+package network
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	run, err := NewRun(dir)
+	assert.NoError(t, err)
+	run.CheckpointEvery = 2
+	assert.NoError(t, run.SaveConfig("json", []byte(`{"epochs": 3}`)))
+
+	n, _ := newTunerNetwork(map[string]float64{"hidden": 3})
+	data := tunerData(20)
+	n.LoadTrainingData(data.Input, data.Output)
+	n.LoadValidationData(data.Input[:8], data.Output[:8])
+	n.SetQuiet(true)
+	assert.NoError(t, run.Start(n, 2, 7))
+	n.TrainNetwork(3, 4, 0.5, 0, true, true, 2)
+	assert.NoError(t, run.Finish(n))
+
+	f, err := os.Open(filepath.Join(dir, "metrics.csv"))
+	assert.NoError(t, err)
+	rows, err := csv.NewReader(f).ReadAll()
+	f.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(rows))
+	assert.Equal(t, []string{"epoch", "accuracy", "duration", "loss", "macroF1"}, rows[0])
+	assert.Equal(t, "2", rows[3][0])
+
+	f, err = os.Open(filepath.Join(dir, "metrics.jsonl"))
+	assert.NoError(t, err)
+	var lines []map[string]float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]float64
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	f.Close()
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, 1.0, lines[1]["epoch"])
+	assert.Contains(t, lines[1], "accuracy")
+
+	for _, name := range []string{"config.json", "model.json", "checkpoints/epoch-0001.json"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err, name)
+	}
+	_, err = os.Stat(run.CheckpointPath(0))
+	assert.True(t, os.IsNotExist(err))
+
+	summary, err := LoadRunSummary(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Cores)
+	assert.Equal(t, int64(7), summary.Seed)
+	assert.Equal(t, []int{2, 3, 2}, summary.Sizes)
+	assert.Equal(t, 20, summary.TrainingSamples)
+	assert.Equal(t, 8, summary.ValidationSamples)
+	assert.Equal(t, 3, summary.Epochs)
+	assert.True(t, summary.BestEpoch >= 0 && summary.BestEpoch < 3)
+	assert.True(t, summary.End.After(summary.Start))
+	assert.Contains(t, summary.Final, "loss")
+	assert.NotContains(t, summary.Final, "duration")
+
+	_, err = NewRun(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,189 @@
+package network
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Sampler samples the hyperparameters of the next trial of a search from the search space,
+// given the trials finished so far and a random source
+type Sampler interface {
+	Sample(space SearchSpace, trials []Trial, r *rand.Rand) map[string]float64
+}
+
+// RandomSampler samples every hyperparameter independently of the finished trials
+type RandomSampler struct{}
+
+// Sample returns hyperparameters sampled uniformly from the search space
+func (RandomSampler) Sample(space SearchSpace, trials []Trial, r *rand.Rand) map[string]float64 {
+	return space.sample(r)
+}
+
+// TPE is the Tree-structured Parzen Estimator. The finished trials are split into the best
+// Gamma fraction and the rest, and the density of every hyperparameter is estimated for both
+// groups. Candidates values are sampled from the density of the best trials, and the value with
+// the highest ratio of the densities of the best and the other trials is chosen. The first
+// Startup trials are sampled randomly. Startup defaults to 10, Gamma to 0.25 and Candidates to 24
+type TPE struct {
+	Startup    int
+	Gamma      float64
+	Candidates int
+}
+
+// Sample returns hyperparameters sampled by the TPE, or randomly
+// if fewer than Startup trials have a finite score
+func (tpe TPE) Sample(space SearchSpace, trials []Trial, r *rand.Rand) map[string]float64 {
+	startup, gamma, candidates := tpe.Startup, tpe.Gamma, tpe.Candidates
+	if startup < 1 {
+		startup = 10
+	}
+	if gamma <= 0 || gamma >= 1 {
+		gamma = 0.25
+	}
+	if candidates < 1 {
+		candidates = 24
+	}
+
+	var scored []Trial
+	for _, trial := range trials {
+		if trial.Err == nil && !math.IsNaN(trial.Score) && !math.IsInf(trial.Score, 0) {
+			scored = append(scored, trial)
+		}
+	}
+	if len(scored) < startup || len(scored) < 2 {
+		return space.sample(r)
+	}
+
+	RankTrials(scored)
+	nGood := int(math.Ceil(gamma * float64(len(scored))))
+	good, bad := scored[:nGood], scored[nGood:]
+
+	params := make(map[string]float64, len(space))
+	for _, hp := range space {
+		if len(hp.Values) > 0 {
+			params[hp.Name] = sampleValues(hp, good, bad, candidates, r)
+		} else {
+			params[hp.Name] = sampleRange(hp, good, bad, candidates, r)
+		}
+	}
+	return params
+}
+
+// sampleValues samples the value of a hyperparameter with discrete values, with the densities
+// of the groups given by the counts of the values in the groups, plus one
+func sampleValues(hp Hyperparameter, good, bad []Trial, candidates int, r *rand.Rand) float64 {
+	count := func(trials []Trial) []float64 {
+		weights := make([]float64, len(hp.Values))
+		for i := range weights {
+			weights[i] = 1
+		}
+		for _, trial := range trials {
+			for i, v := range hp.Values {
+				if trial.Params[hp.Name] == v {
+					weights[i]++
+				}
+			}
+		}
+		return weights
+	}
+	l, g := count(good), count(bad)
+	var lSum, gSum float64
+	for i := range l {
+		lSum += l[i]
+		gSum += g[i]
+	}
+
+	best, bestRatio := 0, math.Inf(-1)
+	for c := 0; c < candidates; c++ {
+		u := r.Float64() * lSum
+		i := 0
+		for ; i < len(l)-1 && u >= l[i]; i++ {
+			u -= l[i]
+		}
+		if ratio := (l[i] / lSum) / (g[i] / gSum); ratio > bestRatio {
+			best, bestRatio = i, ratio
+		}
+	}
+	return hp.Values[best]
+}
+
+// parzen is a mixture of a uniform prior on [lo, hi] and a normal
+// distribution around every observation, in the (log) space of a hyperparameter
+type parzen struct {
+	lo, hi    float64
+	points    []float64
+	bandwidth float64
+}
+
+// newParzen returns the estimator of the values of the hyperparameter in the trials
+func newParzen(hp Hyperparameter, trials []Trial) parzen {
+	p := parzen{lo: hp.Min, hi: hp.Max}
+	if hp.Log {
+		p.lo, p.hi = math.Log(hp.Min), math.Log(hp.Max)
+	}
+	for _, trial := range trials {
+		v := trial.Params[hp.Name]
+		if hp.Log {
+			v = math.Log(v)
+		}
+		p.points = append(p.points, v)
+	}
+
+	// Scott's rule, kept above a hundredth of the range
+	p.bandwidth = (p.hi - p.lo) / 10
+	if len(p.points) > 1 {
+		_, std := meanAndStd(p.points)
+		if bandwidth := 1.06 * std * math.Pow(float64(len(p.points)), -0.2); bandwidth > (p.hi-p.lo)/100 {
+			p.bandwidth = bandwidth
+		}
+	}
+	return p
+}
+
+// sample draws from the prior with probability 1/(points+1), and from a normal
+// distribution around a random observation otherwise, clipped to [lo, hi]
+func (p parzen) sample(r *rand.Rand) float64 {
+	idx := r.Intn(len(p.points) + 1)
+	if idx == len(p.points) {
+		return p.lo + r.Float64()*(p.hi-p.lo)
+	}
+	return math.Max(p.lo, math.Min(p.hi, p.points[idx]+r.NormFloat64()*p.bandwidth))
+}
+
+// density returns the density of the estimator at x
+func (p parzen) density(x float64) float64 {
+	d := 1 / (p.hi - p.lo)
+	for _, point := range p.points {
+		z := (x - point) / p.bandwidth
+		d += math.Exp(-z*z/2) / (p.bandwidth * math.Sqrt(2*math.Pi))
+	}
+	return d / float64(len(p.points)+1)
+}
+
+// sampleRange samples the value of a hyperparameter with a range
+func sampleRange(hp Hyperparameter, good, bad []Trial, candidates int, r *rand.Rand) float64 {
+	if hp.Max == hp.Min {
+		return hp.Min
+	}
+	l, g := newParzen(hp, good), newParzen(hp, bad)
+
+	xs := make([]float64, candidates)
+	for c := range xs {
+		xs[c] = l.sample(r)
+	}
+
+	best, bestRatio := xs[0], math.Inf(-1)
+	for _, x := range xs {
+		if ratio := l.density(x) / g.density(x); ratio > bestRatio {
+			best, bestRatio = x, ratio
+		}
+	}
+
+	if hp.Log {
+		best = math.Exp(best)
+	}
+	if hp.Int {
+		best = math.Round(best)
+	}
+	return math.Max(hp.Min, math.Min(hp.Max, best))
+}
@@ -0,0 +1,105 @@
+package network
+
+import "fmt"
+
+// SequenceLayer is implemented by layers taking sequences as input. Sequences are stored as
+// single vectors, step by step, and every sequence fed to the layer has the same number of steps
+type SequenceLayer interface {
+	SequenceSteps() int
+}
+
+// FlattenSequence stores the sequence seq (one vector of the given number of features per step)
+// as a single vector of the given number of steps. Shorter sequences are padded with zero vectors
+// at the beginning, so that the last step stays last, and longer sequences keep their last steps
+func FlattenSequence(seq [][]float64, steps, features int) ([]float64, error) {
+	x := make([]float64, steps*features)
+	if len(seq) > steps {
+		seq = seq[len(seq)-steps:]
+	}
+
+	offset := (steps - len(seq)) * features
+	for t, v := range seq {
+		if len(v) != features {
+			return nil, fmt.Errorf("step %d has %d features, expected %d", t, len(v), features)
+		}
+		copy(x[offset+t*features:], v)
+	}
+
+	return x, nil
+}
+
+// FlattenSequences flattens every sequence with FlattenSequence
+func FlattenSequences(seqs [][][]float64, steps, features int) ([][]float64, error) {
+	xs := make([][]float64, len(seqs))
+	for idx, seq := range seqs {
+		x, err := FlattenSequence(seq, steps, features)
+		if err != nil {
+			return nil, fmt.Errorf("sequence %d: %v", idx, err)
+		}
+		xs[idx] = x
+	}
+	return xs, nil
+}
+
+// SlidingWindows splits a long sequence into windows of the given number of steps,
+// starting every stride steps. The windows share the vectors of the sequence
+func SlidingWindows(seq [][]float64, steps, stride int) [][][]float64 {
+	var windows [][][]float64
+	for start := 0; start+steps <= len(seq); start += stride {
+		windows = append(windows, seq[start:start+steps])
+	}
+	return windows
+}
+
+// sequenceShape returns the number of steps and features per step of the
+// input sequences of the network, given by the first sequence layer
+func (n *Network) sequenceShape() (int, int, error) {
+	for k, layer := range n.layers {
+		if sequence, ok := layer.(SequenceLayer); ok {
+			steps := sequence.SequenceSteps()
+			return steps, n.Sizes[k] / steps, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("network has no sequence layers")
+}
+
+// flattenSequences flattens the sequences to the input shape of the network
+func (n *Network) flattenSequences(seqs [][][]float64) ([][]float64, error) {
+	steps, features, err := n.sequenceShape()
+	if err != nil {
+		return nil, err
+	}
+	return FlattenSequences(seqs, steps, features)
+}
+
+// LoadSequenceTrainingData flattens the input sequences to the number of steps of the first
+// sequence layer, and loads them as training data. For many-to-many outputs, the output
+// sequences should be flattened with FlattenSequence. The flattened sequences are shuffled
+// and split into mini batches like any other data, and trained on every core
+func (n *Network) LoadSequenceTrainingData(input [][][]float64, output [][]float64) error {
+	x, err := n.flattenSequences(input)
+	if err != nil {
+		return err
+	}
+	n.LoadTrainingData(x, output)
+	return nil
+}
+
+// LoadSequenceValidationData flattens the input sequences and loads them as validation data
+func (n *Network) LoadSequenceValidationData(input [][][]float64, output [][]float64) error {
+	x, err := n.flattenSequences(input)
+	if err != nil {
+		return err
+	}
+	n.LoadValidationData(x, output)
+	return nil
+}
+
+// PredictSequence returns the output of the network for the sequence seq
+func (n *Network) PredictSequence(seq [][]float64) ([]float64, error) {
+	x, err := n.flattenSequences([][][]float64{seq})
+	if err != nil {
+		return nil, err
+	}
+	return n.Predict(x[0]), nil
+}
@@ -0,0 +1,495 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server serves the predictions of saved networks over HTTP:
+//
+//	POST /v1/models/{name}:predict  {"instances": [[...], ...]} gives {"predictions": [[...], ...]}
+//	GET  /v1/models/{name}          the sizes and model file of the network
+//	GET  /healthz                   200 while the server is running
+//	GET  /readyz                    200 when every model is loaded and reloaded, 503 otherwise
+//	GET  /metrics                   the metrics of Monitor, if set
+//
+// Concurrent requests to a model are predicted together in batches of at most MaxBatch
+// instances, where the first request of a batch waits at most BatchDelay for other requests.
+// Batches are predicted in parallel on Cores cores. Models are reloaded by Reload when their
+// files change, and requests are served by the old network until the new one is loaded, or
+// while the new one fails to load, in which case the server is not ready.
+// The instances of a batch are checked with CheckInput of the network predicting the batch.
+// The latencies of the predictions are recorded by Monitor, if set
+type Server struct {
+	MaxBatch   int
+	BatchDelay time.Duration
+	Cores      int
+	Monitor    *Monitor
+
+	mu     sync.RWMutex
+	models map[string]*servedModel
+	done   chan struct{}
+	once   sync.Once
+}
+
+// servedModel is a network served by a server, and the model file it was loaded from
+type servedModel struct {
+	name     string
+	path     string
+	mu       sync.RWMutex
+	n        *Network
+	modTime  time.Time
+	size     int64
+	loadErr  error
+	requests chan *predictRequest
+}
+
+// predictRequest contains the instances of a request, and receives the predictions
+type predictRequest struct {
+	instances [][]float64
+	result    chan predictResult
+}
+
+// predictResult is the predictions of a request, or the error of the request
+type predictResult struct {
+	predictions [][]float64
+	err         error
+}
+
+// ErrServerClosed is returned by Predict when the server is closed
+var ErrServerClosed = errors.New("server is closed")
+
+// PredictionError is returned by Predict when the batch of the request could not be predicted,
+// e.g when the network panicked. The other errors of Predict are invalid requests
+type PredictionError struct {
+	Model string
+	Err   error
+}
+
+func (e *PredictionError) Error() string {
+	return fmt.Sprintf("model %q failed to predict: %v", e.Model, e.Err)
+}
+
+// predictBody is the body of predict requests
+type predictBody struct {
+	Instances [][]float64 `json:"instances"`
+}
+
+// predictResponse is the body of predict responses
+type predictResponse struct {
+	Predictions [][]float64 `json:"predictions"`
+}
+
+// ModelMetadata is the name, model file and layer sizes of a served network
+type ModelMetadata struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Sizes []int  `json:"sizes"`
+}
+
+// NewServer returns a server without models, batching up to 64 instances
+// waiting at most 2ms, and predicting on GOMAXPROCS cores
+func NewServer() *Server {
+	return &Server{
+		MaxBatch:   64,
+		BatchDelay: 2 * time.Millisecond,
+		Cores:      runtime.GOMAXPROCS(0),
+		models:     make(map[string]*servedModel),
+		done:       make(chan struct{}),
+	}
+}
+
+// Load loads the model file at path and serves it under name
+func (s *Server) Load(name, path string) error {
+	if name == "" || strings.ContainsAny(name, "/:") {
+		return fmt.Errorf("invalid model name %q", name)
+	}
+
+	m := &servedModel{name: name, path: path, requests: make(chan *predictRequest)}
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.models[name]; ok {
+		return fmt.Errorf("model %q is already served", name)
+	}
+	s.models[name] = m
+	go s.batch(m)
+
+	return nil
+}
+
+// load loads the model file if it changed since it was last loaded, and records the error
+func (m *servedModel) load() error {
+	err := m.loadFile()
+	m.mu.Lock()
+	m.loadErr = err
+	m.mu.Unlock()
+	return err
+}
+
+// loadFile loads the model file if it changed since it was last loaded
+func (m *servedModel) loadFile() error {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	unchanged := m.n != nil && info.ModTime().Equal(m.modTime) && info.Size() == m.size
+	m.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	n, err := LoadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("model %q: %v", m.name, err)
+	}
+
+	m.mu.Lock()
+	m.n, m.modTime, m.size = n, info.ModTime(), info.Size()
+	m.mu.Unlock()
+	return nil
+}
+
+// loadError returns the error of the last load of the model file
+func (m *servedModel) loadError() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.loadErr
+}
+
+// network returns the network currently served
+func (m *servedModel) network() *Network {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.n
+}
+
+// Reload reloads the models whose files changed. Models that fail to load keep
+// serving the old network, and the first error is returned
+func (s *Server) Reload() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var first error
+	for _, m := range s.models {
+		if err := m.load(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// WatchModels calls Reload at every interval until the server is closed, logging the errors
+func (s *Server) WatchModels(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Reload(); err != nil {
+					log.Println("reloading models:", err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the batching of requests and the watching of model files
+func (s *Server) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// batch collects the requests to the model into batches and predicts them together
+func (s *Server) batch(m *servedModel) {
+	for {
+		var first *predictRequest
+		select {
+		case first = <-m.requests:
+		case <-s.done:
+			return
+		}
+
+		requests := []*predictRequest{first}
+		size := len(first.instances)
+		timer := time.NewTimer(s.BatchDelay)
+	collect:
+		for size < s.MaxBatch {
+			select {
+			case r := <-m.requests:
+				requests = append(requests, r)
+				size += len(r.instances)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		s.predictRequests(m, requests)
+	}
+}
+
+// predictRequests checks the instances of the requests with the network currently served, and
+// predicts the valid requests together. Every request receives its predictions or an error
+func (s *Server) predictRequests(m *servedModel, requests []*predictRequest) {
+	n := m.network()
+	var valid []*predictRequest
+	var instances [][]float64
+	for _, r := range requests {
+		if err := checkInstances(n, m.name, r.instances); err != nil {
+			r.result <- predictResult{err: err}
+			continue
+		}
+		valid = append(valid, r)
+		instances = append(instances, r.instances...)
+	}
+	if len(valid) == 0 {
+		return
+	}
+
+	predictions, err := predictBatch(n, instances, s.Cores)
+	for _, r := range valid {
+		if err != nil {
+			r.result <- predictResult{err: &PredictionError{Model: m.name, Err: err}}
+			continue
+		}
+		r.result <- predictResult{predictions: predictions[:len(r.instances)]}
+		predictions = predictions[len(r.instances):]
+	}
+}
+
+// checkInstances checks the instances of a request to the named model with CheckInput of n
+func checkInstances(n *Network, name string, instances [][]float64) error {
+	for idx, x := range instances {
+		if err := n.CheckInput(x); err != nil {
+			return fmt.Errorf("instance %d of model %q: %v", idx, name, err)
+		}
+	}
+	return nil
+}
+
+// predictBatch predicts the instances as PredictBatch, and returns an error
+// instead of panicking if the prediction of any instance panics
+func predictBatch(n *Network, instances [][]float64, cores int) ([][]float64, error) {
+	if cores < 1 {
+		cores = 1
+	}
+
+	var mu sync.Mutex
+	var first error
+	predictions := make([][]float64, len(instances))
+	splitAcrossCores(len(instances), cores, func(core, idx int) {
+		defer func() {
+			if r := recover(); r != nil {
+				mu.Lock()
+				if first == nil {
+					first = fmt.Errorf("instance %d: %v", idx, r)
+				}
+				mu.Unlock()
+			}
+		}()
+		predictions[idx] = n.Predict(instances[idx])
+	})
+	return predictions, first
+}
+
+// model returns the model served under name
+func (s *Server) model(name string) (*servedModel, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.models[name]
+	return m, ok
+}
+
+// ServeHTTP routes the requests to the predict, metadata, health, readiness and metrics endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/healthz":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case r.URL.Path == "/readyz":
+		s.ready(w)
+	case r.URL.Path == "/metrics" && s.Monitor != nil:
+		s.Monitor.ServeHTTP(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/models/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/models/")
+		if strings.HasSuffix(name, ":predict") {
+			s.predict(w, r, strings.TrimSuffix(name, ":predict"))
+			return
+		}
+		s.metadata(w, r, name)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no endpoint %s", r.URL.Path))
+	}
+}
+
+// ready responds whether every model is loaded, and the last reload of every model succeeded
+func (s *Server) ready(w http.ResponseWriter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	select {
+	case <-s.done:
+		writeError(w, http.StatusServiceUnavailable, ErrServerClosed)
+		return
+	default:
+	}
+	if len(s.models) == 0 {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no models are loaded"))
+		return
+	}
+	names := make([]string, 0, len(s.models))
+	for name := range s.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.models[name].loadError(); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// metadata responds with the sizes and model file of a model
+func (s *Server) metadata(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	metadata, err := s.Metadata(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metadata)
+}
+
+// Metadata returns the metadata of the named model
+func (s *Server) Metadata(name string) (ModelMetadata, error) {
+	m, ok := s.model(name)
+	if !ok {
+		return ModelMetadata{}, fmt.Errorf("model %q not found", name)
+	}
+	return ModelMetadata{Name: name, Path: m.path, Sizes: m.network().Sizes}, nil
+}
+
+// predict validates the instances of a predict request, and responds with the predictions
+func (s *Server) predict(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if _, ok := s.model(name); !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("model %q not found", name))
+		return
+	}
+
+	var body predictBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	predictions, err := s.PredictContext(r.Context(), name, body.Instances)
+	if err != nil {
+		writeError(w, predictStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, predictResponse{Predictions: predictions})
+}
+
+// predictStatus returns the HTTP status of an error of Predict
+func predictStatus(err error) int {
+	if err == ErrServerClosed || err == context.Canceled {
+		return http.StatusServiceUnavailable
+	}
+	if err == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout
+	}
+	if _, ok := err.(*PredictionError); ok {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// Predict predicts the instances batched with the other requests to the named model. The
+// instances are checked with CheckInput of the network predicting the batch. Returns
+// ErrServerClosed when the server is closed, and a PredictionError when the batch fails
+func (s *Server) Predict(name string, instances [][]float64) ([][]float64, error) {
+	return s.PredictContext(context.Background(), name, instances)
+}
+
+// PredictContext is Predict, returning the error of ctx if ctx is done before
+// the request is batched or before its predictions are ready
+func (s *Server) PredictContext(ctx context.Context, name string, instances [][]float64) ([][]float64, error) {
+	m, ok := s.model(name)
+	if !ok {
+		return nil, fmt.Errorf("model %q not found", name)
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no instances given")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	request := &predictRequest{instances: instances, result: make(chan predictResult, 1)}
+	select {
+	case m.requests <- request:
+	case <-s.done:
+		return nil, ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var result predictResult
+	select {
+	case result = <-request.result:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	predictions := result.predictions
+	if s.Monitor != nil {
+		s.Monitor.ObservePrediction(name, time.Since(start))
+	}
+	return predictions, nil
+}
+
+// writeJSON writes v as the JSON body of a response with the given status. Responds
+// with status 500 and the error if v can not be encoded, e.g if it contains NaN
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("encoding the response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// writeError writes err as the JSON body {"error": ...} of a response with the given status
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,255 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+// postPredict posts the instances to the predict endpoint of the model, and returns
+// the status and the decoded body
+func postPredict(t *testing.T, url, name string, instances [][]float64) (int, map[string]interface{}) {
+	data, err := json.Marshal(predictBody{Instances: instances})
+	assert.NoError(t, err)
+	resp, err := http.Post(url+"/v1/models/"+name+":predict", "application/json", bytes.NewReader(data))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+// predictions converts the predictions of a decoded body to [][]float64
+func predictions(body map[string]interface{}) [][]float64 {
+	var ys [][]float64
+	for _, row := range body["predictions"].([]interface{}) {
+		var y []float64
+		for _, v := range row.([]interface{}) {
+			y = append(y, v.(float64))
+		}
+		ys = append(ys, y)
+	}
+	return ys
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(3, Tanh, TanhPrime)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	path := filepath.Join(dir, "model.json")
+	assert.NoError(t, n.SaveFile(path))
+
+	s := NewServer()
+	s.BatchDelay = 10 * time.Millisecond
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	assert.NoError(t, s.Load("xor", path))
+	assert.Error(t, s.Load("xor", path))
+	assert.Error(t, s.Load("bad:name", path))
+	assert.Error(t, s.Load("missing", filepath.Join(dir, "missing.json")))
+
+	for _, endpoint := range []string{"/healthz", "/readyz", "/v1/models/xor"} {
+		resp, err := http.Get(ts.URL + endpoint)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, endpoint)
+	}
+
+	// concurrent requests are batched, and every request gets its own predictions
+	var wg sync.WaitGroup
+	for idx := 0; idx < 20; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			instances := [][]float64{{float64(idx), 1}, {-1, float64(idx) / 10}}
+			status, body := postPredict(t, ts.URL, "xor", instances)
+			assert.Equal(t, http.StatusOK, status)
+			ys := predictions(body)
+			assert.Equal(t, 2, len(ys))
+			for i, x := range instances {
+				assert.InDeltaSlice(t, n.Predict(x), ys[i], 1e-12)
+			}
+		}(idx)
+	}
+	wg.Wait()
+
+	status, body := postPredict(t, ts.URL, "xor", [][]float64{{1, 2}, {1, 2, 3}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body["error"], `instance 1 of model "xor": input has 3 entries, network expects 2`)
+	status, _ = postPredict(t, ts.URL, "xor", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = postPredict(t, ts.URL, "other", [][]float64{{1, 2}})
+	assert.Equal(t, http.StatusNotFound, status)
+	resp, err = http.Get(ts.URL + "/v1/models/xor:predict")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// replacing the model file reloads the model
+	m := &Network{}
+	m.AddLayer(2, nil, nil)
+	m.AddLayer(1, Sigmoid, SigmoidPrime)
+	assert.NoError(t, m.SaveFile(path))
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.NoError(t, s.Reload())
+
+	status, body = postPredict(t, ts.URL, "xor", [][]float64{{0.5, 0.5}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.InDeltaSlice(t, m.Predict([]float64{0.5, 0.5}), predictions(body)[0], 1e-12)
+
+	// a broken model file keeps the old model, but the server is not ready until it is fixed
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	assert.Error(t, s.Reload())
+	status, _ = postPredict(t, ts.URL, "xor", [][]float64{{0.5, 0.5}})
+	assert.Equal(t, http.StatusOK, status)
+	resp, err = http.Get(ts.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NoError(t, m.SaveFile(path))
+	assert.NoError(t, s.Reload())
+	resp, err = http.Get(ts.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	s.Close()
+	resp, err = http.Get(ts.URL + "/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestServerInvalidInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	assert.NoError(t, n.Add(NewEmbedding(6, 3)))
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	path := filepath.Join(dir, "embedding.json")
+	assert.NoError(t, n.SaveFile(path))
+
+	s := NewServer()
+	defer s.Close()
+	assert.NoError(t, s.Load("e", path))
+
+	// invalid ids are rejected before they are predicted
+	_, err = s.Predict("e", [][]float64{{1, 2}, {1, 99}})
+	assert.EqualError(t, err, `instance 1 of model "e": embedding: invalid id 99 at entry 1, expected an integer in [0, 6)`)
+	_, err = s.Predict("e", [][]float64{{1.5, 2}})
+	assert.Error(t, err)
+	predictions, err := s.Predict("e", [][]float64{{1, 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, n.Predict([]float64{1, 2}), predictions[0])
+}
+
+func TestServerBatchErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	path := filepath.Join(dir, "model.json")
+	assert.NoError(t, n.SaveFile(path))
+
+	s := NewServer()
+	defer s.Close()
+	assert.NoError(t, s.Load("model", path))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// the instances are checked with the network predicting the batch
+	m := &Network{}
+	m.AddLayer(3, nil, nil)
+	m.AddLayer(2, Sigmoid, SigmoidPrime)
+	served, _ := s.model("model")
+	served.mu.Lock()
+	served.n = m
+	served.mu.Unlock()
+	_, err = s.Predict("model", [][]float64{{1, 2}})
+	assert.EqualError(t, err, `instance 0 of model "model": input has 2 entries, network expects 3`)
+	_, err = s.Predict("model", [][]float64{{1, 2, 3}})
+	assert.NoError(t, err)
+
+	// predictions that can not be encoded as JSON give an error instead of an empty body
+	m.layers[0].(*Dense).weights = mat64.NewDense(3, 2, []float64{math.NaN(), 0, 0, 0, 0, 0})
+	status, body := postPredict(t, ts.URL, "model", [][]float64{{1, 2, 3}})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Contains(t, body["error"], "encoding the response")
+
+	// a network panicking in the batch gives an error to every request of the batch
+	m.layers[0].(*Dense).weights = mat64.NewDense(2, 2, nil)
+	var wg sync.WaitGroup
+	for idx := 0; idx < 3; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, body := postPredict(t, ts.URL, "model", [][]float64{{1, 2, 3}})
+			assert.Equal(t, http.StatusInternalServerError, status)
+			assert.Contains(t, body["error"], `model "model" failed to predict`)
+		}()
+	}
+	wg.Wait()
+	_, err = s.Predict("model", [][]float64{{1, 2, 3}})
+	assert.IsType(t, &PredictionError{}, err)
+
+	s.Close()
+	_, err = s.Predict("model", [][]float64{{1, 2, 3}})
+	assert.Equal(t, ErrServerClosed, err)
+	status, _ = postPredict(t, ts.URL, "model", [][]float64{{1, 2, 3}})
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestServerPredictContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	path := filepath.Join(dir, "model.json")
+	assert.NoError(t, n.SaveFile(path))
+
+	// the first request of a batch waits for other requests longer than the deadlines
+	s := NewServer()
+	s.MaxBatch, s.BatchDelay = 1000, time.Minute
+	defer s.Close()
+	assert.NoError(t, s.Load("model", path))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.PredictContext(ctx, "model", [][]float64{{1, 2}})
+	assert.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.PredictContext(ctx, "model", [][]float64{{1, 2}})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, http.StatusGatewayTimeout, predictStatus(err))
+}
@@ -0,0 +1,265 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// SparseVector is a vector given by its non-zero entries, such as one-hot and bag-of-words
+// inputs. When the first layer of the network is a SparseInputLayer, sparse inputs skip the
+// zero entries in the forward feed, and only the weights of the non-zero entries are updated
+type SparseVector struct {
+	Size    int
+	Indices []int
+	Values  []float64
+}
+
+// NewSparseVector returns the non-zero entries of x as a sparse vector
+func NewSparseVector(x []float64) *SparseVector {
+	s := &SparseVector{Size: len(x)}
+	for idx, v := range x {
+		if v != 0 {
+			s.Indices = append(s.Indices, idx)
+			s.Values = append(s.Values, v)
+		}
+	}
+	return s
+}
+
+// Dense returns the sparse vector with all its entries
+func (s *SparseVector) Dense() []float64 {
+	x := make([]float64, s.Size)
+	for idx, i := range s.Indices {
+		x[i] = s.Values[idx]
+	}
+	return x
+}
+
+// vector returns the sparse vector as a dense vector
+func (s *SparseVector) vector() *mat64.Vector {
+	return mat64.NewVector(s.Size, s.Dense())
+}
+
+// SparseInputLayer is implemented by layers that can skip the zero entries of their input.
+// ForwardSparse is called instead of Forward at the first layer for sparse inputs
+type SparseInputLayer interface {
+	// ForwardSparse computes the output of the layer for the sparse input x
+	ForwardSparse(x *SparseVector, proc int) *mat64.Vector
+}
+
+// SparseLayer is implemented by layers where a sample only adds gradients to a few rows of a
+// parameter, such as embeddings and dense layers with sparse inputs. Only these rows are
+// merged, updated and cleared after every mini batch
+type SparseLayer interface {
+	// SparseRows returns the rows of parameter i with gradients at proc, or false
+	// if any row of the parameter can have gradients
+	SparseRows(i, proc int) ([]int, bool)
+	// ClearSparseRows forgets the rows with gradients at proc
+	ClearSparseRows(proc int)
+}
+
+// rowSet keeps track of the rows with gradients
+type rowSet struct {
+	added []bool
+	rows  []int
+}
+
+func newRowSet(size int) rowSet {
+	return rowSet{added: make([]bool, size)}
+}
+
+func (s *rowSet) add(row int) {
+	if !s.added[row] {
+		s.added[row] = true
+		s.rows = append(s.rows, row)
+	}
+}
+
+func (s *rowSet) clear() {
+	for _, row := range s.rows {
+		s.added[row] = false
+	}
+	s.rows = s.rows[:0]
+}
+
+// sparseRows returns the rows of parameter i of layer k with gradients at any
+// core, or false if the layer is not sparse or any row can have gradients
+func (n *Network) sparseRows(k, i int) ([]int, bool) {
+	sparse, ok := n.layers[k].(SparseLayer)
+	if !ok {
+		return nil, false
+	}
+
+	var union []int
+	seen := make(map[int]bool)
+	for proc := 0; proc < n.procs; proc++ {
+		rows, ok := sparse.SparseRows(i, proc)
+		if !ok {
+			return nil, false
+		}
+		for _, row := range rows {
+			if !seen[row] {
+				seen[row] = true
+				union = append(union, row)
+			}
+		}
+	}
+
+	return union, true
+}
+
+// addRows adds the given rows of src to dst, scaled by alpha
+func addRows(dst, src *mat64.Dense, rows []int, alpha float64) {
+	for _, row := range rows {
+		d, s := dst.RawRowView(row), src.RawRowView(row)
+		for j := range d {
+			d[j] += alpha * s[j]
+		}
+	}
+}
+
+// zeroRows sets the given rows of m to zero
+func zeroRows(m *mat64.Dense, rows []int) {
+	for _, row := range rows {
+		r := m.RawRowView(row)
+		for j := range r {
+			r[j] = 0
+		}
+	}
+}
+
+// forwardInput feeds the input through the first layer. Sparse inputs s skip the zero entries
+// at a SparseInputLayer, and are expanded for the other layers
+func (n *Network) forwardInput(x *mat64.Vector, s *SparseVector, proc int) *mat64.Vector {
+	if s != nil {
+		if sparse, ok := n.layers[0].(SparseInputLayer); ok {
+			return sparse.ForwardSparse(s, proc)
+		}
+		x = s.vector()
+	}
+	return n.layers[0].Forward(x, proc)
+}
+
+// check checks that the indices and values of the sparse vector match, and that the indices are in range
+func (s *SparseVector) check() error {
+	if len(s.Indices) != len(s.Values) {
+		return fmt.Errorf("%d indices and %d values", len(s.Indices), len(s.Values))
+	}
+	for _, i := range s.Indices {
+		if i < 0 || i >= s.Size {
+			return fmt.Errorf("index %d out of range %d", i, s.Size)
+		}
+	}
+	return nil
+}
+
+// checkSparse checks the sparse vector, and that its size is the input size of the network
+func (n *Network) checkSparse(s *SparseVector) error {
+	if n.l == 0 {
+		return fmt.Errorf("network has no layers")
+	}
+	if s.Size != n.Sizes[0] {
+		return fmt.Errorf("size %d, network expects %d", s.Size, n.Sizes[0])
+	}
+	return s.check()
+}
+
+// loadSparse appends the sparse vectors to the sparse inputs, with nil inputs in their place
+// in the inputs, and returns the new inputs and sparse inputs. Sparse inputs are not preprocessed
+func (n *Network) loadSparse(input []*SparseVector, inputs []*mat64.Vector, sparse []*SparseVector) ([]*mat64.Vector, []*SparseVector, error) {
+	if n.pipeline != nil {
+		return nil, nil, fmt.Errorf("sparse inputs can not be used with a preprocessing pipeline")
+	}
+
+	for idx, s := range input {
+		if err := n.checkSparse(s); err != nil {
+			return nil, nil, fmt.Errorf("sparse vector %d: %v", idx, err)
+		}
+	}
+
+	// the dense samples loaded before have no sparse inputs
+	sparse = append(sparse, make([]*SparseVector, len(inputs)-len(sparse))...)
+	return append(inputs, make([]*mat64.Vector, len(input))...), append(sparse, input...), nil
+}
+
+// loadOutputs returns the outputs appended to vectors
+func loadOutputs(vectors []*mat64.Vector, outputs [][]float64) []*mat64.Vector {
+	for _, y := range outputs {
+		vectors = append(vectors, mat64.NewVector(len(y), y))
+	}
+	return vectors
+}
+
+// LoadSparseTrainingData loads sparse training inputs
+func (n *Network) LoadSparseTrainingData(trainingInput []*SparseVector, trainingOutput [][]float64) error {
+	inputs, sparse, err := n.loadSparse(trainingInput, n.trainingInput, n.trainingSparse)
+	if err != nil {
+		return err
+	}
+	n.trainingInput, n.trainingSparse = inputs, sparse
+	n.trainingOutput = loadOutputs(n.trainingOutput, trainingOutput)
+	return nil
+}
+
+// LoadSparseValidationData loads sparse validation inputs
+func (n *Network) LoadSparseValidationData(validationInput []*SparseVector, validationOutput [][]float64) error {
+	inputs, sparse, err := n.loadSparse(validationInput, n.validationInput, n.validationSparse)
+	if err != nil {
+		return err
+	}
+	n.validationInput, n.validationSparse = inputs, sparse
+	n.validationOutput = loadOutputs(n.validationOutput, validationOutput)
+	return nil
+}
+
+// expandSparse returns the inputs with the sparse inputs expanded in place of the nil
+// inputs, e.g for the validation method. The expanded inputs are not kept
+func expandSparse(inputs []*mat64.Vector, sparse []*SparseVector) []*mat64.Vector {
+	if sparse == nil {
+		return inputs
+	}
+
+	expanded := make([]*mat64.Vector, len(inputs))
+	for idx, x := range inputs {
+		if s := sparse[idx]; s != nil {
+			x = s.vector()
+		}
+		expanded[idx] = x
+	}
+	return expanded
+}
+
+// sparseAt returns the sparse input of sample idx, or nil if there are no sparse inputs
+func sparseAt(sparse []*SparseVector, idx int) *SparseVector {
+	if sparse == nil {
+		return nil
+	}
+	return sparse[idx]
+}
+
+// PredictSparse returns the output of the network for the sparse input x, which is
+// checked first. Inputs of networks with a preprocessing pipeline are checked and
+// predicted as dense inputs
+func (n *Network) PredictSparse(x *SparseVector) ([]float64, error) {
+	if n.pipeline != nil {
+		if err := x.check(); err != nil {
+			return nil, err
+		}
+		dense := x.Dense()
+		if err := n.CheckInput(dense); err != nil {
+			return nil, err
+		}
+		return n.Predict(dense), nil
+	}
+
+	if err := n.checkSparse(x); err != nil {
+		return nil, err
+	}
+	if _, ok := n.layers[0].(InputLayer); ok {
+		if err := n.checkLayerInput(x.Dense()); err != nil {
+			return nil, err
+		}
+	}
+	return n.forwardFeed(nil, x, inference).RawVector().Data, nil
+}
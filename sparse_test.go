@@ -0,0 +1,105 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparseVector(t *testing.T) {
+	s := NewSparseVector([]float64{0, 2, 0, 0, -1})
+	assert.Equal(t, &SparseVector{Size: 5, Indices: []int{1, 4}, Values: []float64{2, -1}}, s)
+	assert.Equal(t, []float64{0, 2, 0, 0, -1}, s.Dense())
+}
+
+func TestDenseForwardSparse(t *testing.T) {
+	d := NewDense(3, Sigmoid, SigmoidPrime)
+	_, err := d.Init(6)
+	assert.NoError(t, err)
+
+	s := NewSparseVector([]float64{0, 1, 0, 0, 3, 0})
+	x := mat64.NewVector(6, s.Dense())
+	assert.InDeltaSlice(t, d.Forward(x, inference).RawVector().Data,
+		d.ForwardSparse(s, inference).RawVector().Data, 1e-12)
+}
+
+func TestSparseTraining(t *testing.T) {
+	n := &Network{}
+	n.AddLayer(6, nil, nil)
+	n.AddLayer(4, Sigmoid, SigmoidPrime)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+
+	var buf bytes.Buffer
+	assert.NoError(t, n.Save(&buf))
+	saved := append([]byte(nil), buf.Bytes()...)
+	sparse, err := Load(&buf)
+	assert.NoError(t, err)
+	sparse.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+
+	input := [][]float64{{1, 0, 0, 0, 0, 0}, {0, 0, 1, 0, 0, 0}, {0, 0, 0, 0, 2, 1}, {0, 1, 0, 0, 0, 0}}
+	output := [][]float64{{1, 0}, {0, 1}, {1, 0}, {0, 1}}
+	var sparseInput []*SparseVector
+	for _, x := range input {
+		sparseInput = append(sparseInput, NewSparseVector(x))
+	}
+
+	n.LoadTrainingData(input, output)
+	n.LoadValidationData(input, output)
+	assert.NoError(t, sparse.LoadSparseTrainingData(sparseInput, output))
+	assert.NoError(t, sparse.LoadSparseValidationData(sparseInput, output))
+	n.SetQuiet(true)
+	sparse.SetQuiet(true)
+	n.TrainNetwork(3, 2, 0.5, 0.1, false, true, 2)
+	sparse.TrainNetwork(3, 2, 0.5, 0.1, false, true, 2)
+
+	// Sparse inputs are kept as sparse vectors, without dense copies
+	assert.Equal(t, make([]*mat64.Vector, 4), sparse.trainingInput)
+	assert.Equal(t, sparseInput, sparse.trainingSparse)
+	assert.Equal(t, make([]*mat64.Vector, 4), sparse.validationInput)
+	assert.Equal(t, sparseInput, sparse.validationSparse)
+
+	// Sparse inputs give the same training as dense inputs
+	for k, layer := range n.layers {
+		for i, param := range layer.Params() {
+			assert.InDeltaSlice(t, param.Value.RawMatrix().Data,
+				sparse.layers[k].Params()[i].Value.RawMatrix().Data, 1e-12)
+		}
+	}
+	predicted, err := sparse.PredictSparse(sparseInput[2])
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, n.Predict(input[2]), predicted, 1e-12)
+	assert.Equal(t, n.ValidationHistory(), sparse.ValidationHistory())
+
+	// Dense and sparse samples can be mixed
+	mixed, err := Load(bytes.NewReader(saved))
+	assert.NoError(t, err)
+	mixed.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	mixed.SetQuiet(true)
+	mixed.LoadTrainingData(input[:1], output[:1])
+	assert.NoError(t, mixed.LoadSparseTrainingData(sparseInput[1:3], output[1:3]))
+	mixed.LoadTrainingData(input[3:], output[3:])
+	assert.Equal(t, []*SparseVector{nil, sparseInput[1], sparseInput[2], nil}, mixed.trainingSparse)
+	mixed.TrainNetwork(3, 2, 0.5, 0.1, false, false, 2)
+	for k, layer := range n.layers {
+		for i, param := range layer.Params() {
+			assert.InDeltaSlice(t, param.Value.RawMatrix().Data,
+				mixed.layers[k].Params()[i].Value.RawMatrix().Data, 1e-12)
+		}
+	}
+
+	// Indices out of range and sizes other than the input size are rejected
+	assert.Error(t, sparse.LoadSparseTrainingData([]*SparseVector{{Size: 6, Indices: []int{6}, Values: []float64{1}}}, output[:1]))
+	assert.EqualError(t, sparse.LoadSparseTrainingData([]*SparseVector{{Size: 8, Indices: []int{7}, Values: []float64{1}}}, output[:1]),
+		"sparse vector 0: size 8, network expects 6")
+	for _, x := range []*SparseVector{
+		{Size: 8, Indices: []int{7}, Values: []float64{1}},
+		{Size: 6, Indices: []int{6}, Values: []float64{1}},
+		{Size: 6, Indices: []int{1, 2}, Values: []float64{1}},
+	} {
+		_, err := sparse.PredictSparse(x)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,193 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// DataSet contains a set of input data and the matching output data
+type DataSet struct {
+	Input  [][]float64
+	Output [][]float64
+}
+
+// Fold contains the training and validation set of one fold in a k-fold cross validation
+type Fold struct {
+	Training   DataSet
+	Validation DataSet
+}
+
+// MetricSummary contains the score of a metric at every fold,
+// along with the mean and standard deviation of the scores
+type MetricSummary struct {
+	Scores []float64
+	Mean   float64
+	Std    float64
+}
+
+// subset returns the data set containing the entries at the indices idx
+func (ds DataSet) subset(idx []int) DataSet {
+	sub := DataSet{
+		Input:  make([][]float64, len(idx)),
+		Output: make([][]float64, len(idx)),
+	}
+	for i, j := range idx {
+		sub.Input[i] = ds.Input[j]
+		sub.Output[i] = ds.Output[j]
+	}
+	return sub
+}
+
+// groupIndices returns the indices of the data shuffled by a source seeded by seed, grouped by
+// the arg max of the output if stratify is true, or as one single group otherwise
+func groupIndices(output [][]float64, stratify bool, seed int64) [][]int {
+	perm := rand.New(rand.NewSource(seed)).Perm(len(output))
+
+	if !stratify {
+		return [][]int{perm}
+	}
+
+	var groups [][]int
+	classIdx := make(map[int]int)
+	for _, idx := range perm {
+		class := argMax(output[idx])
+		if _, ok := classIdx[class]; !ok {
+			classIdx[class] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[classIdx[class]] = append(groups[classIdx[class]], idx)
+	}
+	return groups
+}
+
+// SplitData splits the data into a training, validation and test set. The training and validation sets
+// get the fractions trainRatio and validationRatio of the data, and the test set gets the rest.
+// If stratify is true, every set gets the same distribution of classes (arg max of the output) as the data.
+// The data is shuffled by a random source seeded by seed, so that the same seed gives the same split
+func SplitData(input, output [][]float64, trainRatio, validationRatio float64, stratify bool, seed int64) (train, validation, test DataSet, err error) {
+	if len(input) != len(output) {
+		return train, validation, test, fmt.Errorf("input and output lengths differ: %d != %d", len(input), len(output))
+	}
+
+	if trainRatio < 0 || validationRatio < 0 || trainRatio+validationRatio > 1 {
+		return train, validation, test, fmt.Errorf("invalid split ratios: %v, %v", trainRatio, validationRatio)
+	}
+
+	ds := DataSet{Input: input, Output: output}
+	var trainIdx, validationIdx, testIdx []int
+
+	for _, group := range groupIndices(output, stratify, seed) {
+		nTrain := int(math.Floor(trainRatio*float64(len(group)) + 0.5))
+		nValidation := int(math.Floor(validationRatio*float64(len(group)) + 0.5))
+		if nTrain+nValidation > len(group) {
+			nValidation = len(group) - nTrain
+		}
+
+		trainIdx = append(trainIdx, group[:nTrain]...)
+		validationIdx = append(validationIdx, group[nTrain:nTrain+nValidation]...)
+		testIdx = append(testIdx, group[nTrain+nValidation:]...)
+	}
+
+	return ds.subset(trainIdx), ds.subset(validationIdx), ds.subset(testIdx), nil
+}
+
+// KFold splits the data into k folds. The validation sets of the folds are disjoint
+// and cover the data. If stratify is true, the classes (arg max of the output)
+// are distributed evenly between the folds. The data is shuffled as by SplitData
+func KFold(input, output [][]float64, k int, stratify bool, seed int64) ([]Fold, error) {
+	if len(input) != len(output) {
+		return nil, fmt.Errorf("input and output lengths differ: %d != %d", len(input), len(output))
+	}
+
+	if k < 2 || k > len(input) {
+		return nil, fmt.Errorf("invalid number of folds %d for %d samples", k, len(input))
+	}
+
+	parts := make([][]int, k)
+	counter := 0
+	for _, group := range groupIndices(output, stratify, seed) {
+		for _, idx := range group {
+			parts[counter%k] = append(parts[counter%k], idx)
+			counter++
+		}
+	}
+
+	ds := DataSet{Input: input, Output: output}
+	folds := make([]Fold, k)
+	for i := range folds {
+		var trainIdx []int
+		for j := range parts {
+			if j != i {
+				trainIdx = append(trainIdx, parts[j]...)
+			}
+		}
+		folds[i] = Fold{Training: ds.subset(trainIdx), Validation: ds.subset(parts[i])}
+	}
+
+	return folds, nil
+}
+
+// LoadSplitData splits the data with SplitData, loads the training and validation sets
+// and returns the test set
+func (n *Network) LoadSplitData(input, output [][]float64, trainRatio, validationRatio float64, stratify bool, seed int64) (DataSet, error) {
+	train, validation, test, err := SplitData(input, output, trainRatio, validationRatio, stratify, seed)
+	if err != nil {
+		return test, err
+	}
+
+	n.LoadTrainingData(train.Input, train.Output)
+	n.LoadValidationData(validation.Input, validation.Output)
+
+	return test, nil
+}
+
+// CrossValidate runs k-fold cross validation. For every fold a fresh network is created by newNetwork,
+// the training and validation sets of the fold are loaded, and the network is trained by train.
+// The metrics are then computed on the validation set of the fold, and summarized over all folds.
+// The folds are given by KFold with the seed
+func CrossValidate(k int, input, output [][]float64, stratify bool, seed int64, newNetwork func() *Network,
+	train func(n *Network), metrics map[string]Metric) (map[string]MetricSummary, error) {
+
+	folds, err := KFold(input, output, k, stratify, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]MetricSummary)
+	for _, fold := range folds {
+		n := newNetwork()
+		n.LoadTrainingData(fold.Training.Input, fold.Training.Output)
+		n.LoadValidationData(fold.Validation.Input, fold.Validation.Output)
+		train(n)
+
+		for name, metric := range metrics {
+			summary := summaries[name]
+			summary.Scores = append(summary.Scores, metric(n, n.validationInput, n.validationOutput))
+			summaries[name] = summary
+		}
+	}
+
+	for name, summary := range summaries {
+		summary.Mean, summary.Std = meanAndStd(summary.Scores)
+		summaries[name] = summary
+	}
+
+	return summaries, nil
+}
+
+// meanAndStd returns the mean and the (population) standard deviation of s
+func meanAndStd(s []float64) (float64, float64) {
+	var mean, variance float64
+	for _, v := range s {
+		mean += v
+	}
+	mean /= float64(len(s))
+
+	for _, v := range s {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(s))
+
+	return mean, math.Sqrt(variance)
+}
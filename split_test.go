@@ -0,0 +1,124 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// classData returns n samples per class for the given number of classes,
+// where the input holds the sample index for matching input with output
+func classData(classes, n int) ([][]float64, [][]float64) {
+	var input, output [][]float64
+	for c := 0; c < classes; c++ {
+		for i := 0; i < n; i++ {
+			y := make([]float64, classes)
+			y[c] = 1
+			input = append(input, []float64{float64(len(input))})
+			output = append(output, y)
+		}
+	}
+	return input, output
+}
+
+func countClasses(output [][]float64) map[int]int {
+	count := make(map[int]int)
+	for _, y := range output {
+		count[argMax(y)]++
+	}
+	return count
+}
+
+func TestSplitData(t *testing.T) {
+	input, output := classData(3, 20)
+
+	train, validation, test, err := SplitData(input, output, 0.6, 0.2, true, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 36, len(train.Input))
+	assert.Equal(t, 12, len(validation.Input))
+	assert.Equal(t, 12, len(test.Input))
+
+	// Every set has the same class distribution as the data
+	assert.Equal(t, map[int]int{0: 12, 1: 12, 2: 12}, countClasses(train.Output))
+	assert.Equal(t, map[int]int{0: 4, 1: 4, 2: 4}, countClasses(validation.Output))
+	assert.Equal(t, map[int]int{0: 4, 1: 4, 2: 4}, countClasses(test.Output))
+
+	// Inputs and outputs are still matched, and no sample is used twice
+	seen := make(map[int]bool)
+	for _, ds := range []DataSet{train, validation, test} {
+		for i := range ds.Input {
+			idx := int(ds.Input[i][0])
+			assert.Equal(t, output[idx], ds.Output[i])
+			assert.False(t, seen[idx])
+			seen[idx] = true
+		}
+	}
+	assert.Equal(t, len(input), len(seen))
+
+	// The same seed gives the same split, and another seed another split
+	again, _, _, err := SplitData(input, output, 0.6, 0.2, true, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, train, again)
+	other, _, _, err := SplitData(input, output, 0.6, 0.2, true, 2)
+	assert.NoError(t, err)
+	assert.NotEqual(t, train.Input, other.Input)
+
+	_, _, _, err = SplitData(input, output, 0.8, 0.3, false, 1)
+	assert.Error(t, err)
+}
+
+func TestKFold(t *testing.T) {
+	input, output := classData(2, 10)
+
+	folds, err := KFold(input, output, 5, true, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(folds))
+
+	seen := make(map[int]int)
+	for _, fold := range folds {
+		assert.Equal(t, 16, len(fold.Training.Input))
+		assert.Equal(t, map[int]int{0: 2, 1: 2}, countClasses(fold.Validation.Output))
+		for _, x := range fold.Validation.Input {
+			seen[int(x[0])]++
+		}
+	}
+
+	// The validation sets are disjoint and cover the data
+	assert.Equal(t, len(input), len(seen))
+	for _, count := range seen {
+		assert.Equal(t, 1, count)
+	}
+
+	_, err = KFold(input, output, 1, false, 1)
+	assert.Error(t, err)
+}
+
+func TestMeanAndStd(t *testing.T) {
+	mean, std := meanAndStd([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	assert.Equal(t, 5.0, mean)
+	assert.Equal(t, 2.0, std)
+}
+
+func TestCrossValidate(t *testing.T) {
+	input, output := classData(2, 6)
+
+	newNetwork := func() *Network {
+		n := &Network{}
+		n.AddLayer(1, Sigmoid, SigmoidPrime)
+		n.AddLayer(3, Sigmoid, SigmoidPrime)
+		n.AddLayer(2, Sigmoid, SigmoidPrime)
+		n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+		return n
+	}
+
+	train := func(n *Network) {
+		n.TrainNetwork(2, 2, 0.5, 0, true, false, 1)
+	}
+
+	summaries, err := CrossValidate(3, input, output, true, 1, newNetwork, train, map[string]Metric{"hitrate": HitRate})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(summaries["hitrate"].Scores))
+	for _, score := range summaries["hitrate"].Scores {
+		assert.True(t, score >= 0 && score <= 1)
+	}
+}
@@ -0,0 +1,240 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// NonFiniteResponse is how training responds to NaN or Inf values in the activations,
+// gradients or parameters of the network. The values are not checked by default
+type NonFiniteResponse int
+
+const (
+	// StopOnNonFinite stops training with a NonFiniteError, leaving the parameters of the last finite update
+	StopOnNonFinite NonFiniteResponse = iota + 1
+	// SkipBatchOnNonFinite discards the mini batch and continues training
+	SkipBatchOnNonFinite
+	// LowerEtaOnNonFinite discards the mini batch and halves the learning rates
+	LowerEtaOnNonFinite
+)
+
+// NonFiniteError is returned when training finds NaN or Inf values, and tells
+// which values of which layer were found at which step of the training
+type NonFiniteError struct {
+	Values    string
+	Layer     int
+	Name      string
+	Epoch     int
+	MiniBatch int
+}
+
+func (e *NonFiniteError) Error() string {
+	return fmt.Sprintf("NaN or Inf in the %s of layer %d (%s) at epoch %d, mini batch %d",
+		e.Values, e.Layer, e.Name, e.Epoch, e.MiniBatch)
+}
+
+// stability contains the gradient clipping and the NaN and Inf checks of the network
+type stability struct {
+	clipValue         float64
+	clipNorm          float64
+	nonFiniteResponse NonFiniteResponse
+	nonFinite         []*NonFiniteError
+	backup            [][]*mat64.Dense
+}
+
+// SetGradientClipping clips the mean gradients of every mini batch before the parameters are
+// updated: every entry to [-value, value], and then the gradients of all the layers together
+// to the global (L2) norm given by norm. Zero turns off the clipping
+func (n *Network) SetGradientClipping(value, norm float64) {
+	n.clipValue = value
+	n.clipNorm = norm
+}
+
+// SetNonFiniteResponse turns on the checks for NaN and Inf values in the activations,
+// gradients and parameters during training, and sets the response when they are found
+func (n *Network) SetNonFiniteResponse(response NonFiniteResponse) {
+	n.nonFiniteResponse = response
+}
+
+// isFinite returns true if no value of data is NaN or Inf
+func isFinite(data []float64) bool {
+	for _, v := range data {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFiniteDense returns true if no value of m is NaN or Inf
+func isFiniteDense(m *mat64.Dense) bool {
+	rows, _ := m.Dims()
+	for i := 0; i < rows; i++ {
+		if !isFinite(m.RawRowView(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkActivations records the first layer giving non-finite activations at proc
+func (n *Network) checkActivations(k int, a *mat64.Vector, proc int) {
+	if n.nonFiniteResponse == 0 || proc == inference || n.nonFinite[proc] != nil {
+		return
+	}
+	if !isFinite(a.RawVector().Data) {
+		n.nonFinite[proc] = &NonFiniteError{Values: "activations", Layer: k, Name: n.layers[k].Name()}
+	}
+}
+
+// checkGradients returns an error for the first non-finite activations of the mini batch,
+// or for the first trainable layer with non-finite (merged) gradients
+func (n *Network) checkGradients() *NonFiniteError {
+	if n.nonFiniteResponse == 0 {
+		return nil
+	}
+
+	var err *NonFiniteError
+	for proc, e := range n.nonFinite {
+		if e != nil && (err == nil || e.Layer < err.Layer) {
+			err = e
+		}
+		n.nonFinite[proc] = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for k := n.lowestTrainable(); k < n.l; k++ {
+		if n.frozen[k] {
+			continue
+		}
+		for _, grad := range n.layers[k].Grads(0) {
+			if !isFiniteDense(grad) {
+				return &NonFiniteError{Values: "gradients", Layer: k, Name: n.layers[k].Name()}
+			}
+		}
+	}
+	return nil
+}
+
+// clipGradients clips the merged gradients of the trainable layers. The merged
+// gradients are sums over the mini batch, and are clipped as means
+func (n *Network) clipGradients() {
+	if n.clipValue <= 0 && n.clipNorm <= 0 {
+		return
+	}
+
+	var grads []*mat64.Dense
+	for k := n.lowestTrainable(); k < n.l; k++ {
+		if !n.frozen[k] {
+			grads = append(grads, n.layers[k].Grads(0)...)
+		}
+	}
+
+	if n.clipValue > 0 {
+		limit := n.clipValue * n.data.miniBatchSize
+		for _, grad := range grads {
+			grad.Apply(func(i, j int, v float64) float64 {
+				return math.Max(-limit, math.Min(limit, v))
+			}, grad)
+		}
+	}
+
+	if n.clipNorm > 0 {
+		var squares float64
+		for _, grad := range grads {
+			squares += sumSquares(grad)
+		}
+
+		norm := math.Sqrt(squares) / n.data.miniBatchSize
+		if norm > n.clipNorm {
+			for _, grad := range grads {
+				grad.Scale(n.clipNorm/norm, grad)
+			}
+		}
+	}
+}
+
+// backupParams copies the parameters of the trainable layers before they are updated,
+// so that they can be restored if the update gives non-finite values
+func (n *Network) backupParams() {
+	if n.nonFiniteResponse == 0 {
+		return
+	}
+
+	if len(n.backup) != n.l {
+		n.backup = make([][]*mat64.Dense, n.l)
+	}
+	for k := n.lowestTrainable(); k < n.l; k++ {
+		if n.frozen[k] {
+			continue
+		}
+		params := n.layers[k].Params()
+		if len(n.backup[k]) != len(params) {
+			n.backup[k] = make([]*mat64.Dense, len(params))
+		}
+		for i, param := range params {
+			if n.backup[k][i] == nil {
+				n.backup[k][i] = mat64.DenseCopyOf(param.Value)
+				continue
+			}
+			n.backup[k][i].Copy(param.Value)
+		}
+	}
+}
+
+// checkParams returns an error for the first trainable layer with non-finite parameters,
+// and restores the parameters of the trainable layers copied by backupParams
+func (n *Network) checkParams() *NonFiniteError {
+	if n.nonFiniteResponse == 0 {
+		return nil
+	}
+
+	for k := n.lowestTrainable(); k < n.l; k++ {
+		if n.frozen[k] {
+			continue
+		}
+		for _, param := range n.layers[k].Params() {
+			if isFiniteDense(param.Value) {
+				continue
+			}
+
+			for j := n.lowestTrainable(); j < n.l; j++ {
+				if n.frozen[j] {
+					continue
+				}
+				for i, param := range n.layers[j].Params() {
+					param.Value.Copy(n.backup[j][i])
+				}
+			}
+			return &NonFiniteError{Values: "parameters", Layer: k, Name: n.layers[k].Name()}
+		}
+	}
+	return nil
+}
+
+// respondNonFinite responds to the non-finite values found at the given mini batch, and returns
+// an error if training should stop. The gradients of the mini batch are already discarded
+func (n *Network) respondNonFinite(err *NonFiniteError, epoch, miniBatch int) error {
+	err.Epoch, err.MiniBatch = epoch, miniBatch
+
+	switch n.nonFiniteResponse {
+	case SkipBatchOnNonFinite:
+		log.Println(err, "- skipping mini batch")
+	case LowerEtaOnNonFinite:
+		n.hp.eta /= 2
+		for _, layer := range n.layers {
+			for _, param := range layer.Params() {
+				param.LearningRate /= 2
+			}
+		}
+		log.Println(err, "- skipping mini batch, lowering eta to", n.hp.eta)
+	default:
+		return err
+	}
+	return nil
+}
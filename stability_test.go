@@ -0,0 +1,93 @@
+package network
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/gonum/matrix/mat64"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStabilityNetwork(eta float64) *Network {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(3, Identity, IdentityPrime)
+	n.AddLayer(2, Identity, IdentityPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateArgMaxSlice)
+	n.initDataContainers(2, 2)
+	n.hp.InitHyperParameters(eta, 0)
+	n.miniBatchSize = 2
+	n.n = 4
+	return n
+}
+
+func stabilityMiniBatches(x ...float64) [][][]*mat64.Vector {
+	var miniBatches [][][]*mat64.Vector
+	for idx := 0; idx < len(x); idx += 2 {
+		var miniBatch [][]*mat64.Vector
+		for _, v := range x[idx : idx+2] {
+			miniBatch = append(miniBatch, []*mat64.Vector{mat64.NewVector(2, []float64{v, 1}), mat64.NewVector(2, []float64{1, 0})})
+		}
+		miniBatches = append(miniBatches, miniBatch)
+	}
+	return miniBatches
+}
+
+func TestGradientClipping(t *testing.T) {
+	n := newStabilityNetwork(1)
+	grads := n.layers[0].Grads(0)
+	grads[0].Copy(mat64.NewDense(2, 3, []float64{-5, 0.5, 3, 1, 2, -1}))
+
+	n.SetGradientClipping(1, 0)
+	n.clipGradients()
+	assert.Equal(t, []float64{-2, 0.5, 2, 1, 2, -1}, grads[0].RawMatrix().Data)
+
+	// The global norm of the mean gradients is 1 after clipping
+	n.SetGradientClipping(0, 1)
+	n.clipGradients()
+	var sumSquares float64
+	for _, layer := range n.layers {
+		for _, grad := range layer.Grads(0) {
+			for _, v := range grad.RawMatrix().Data {
+				sumSquares += v * v
+			}
+		}
+	}
+	assert.InDelta(t, 1, math.Sqrt(sumSquares)/2, 1e-12)
+}
+
+func TestNonFiniteResponses(t *testing.T) {
+	// NaN input in the second mini batch
+	n := newStabilityNetwork(1)
+	n.data.miniBatches = stabilityMiniBatches(1, 2, math.NaN(), 3)
+	n.SetNonFiniteResponse(StopOnNonFinite)
+	err := n.updateMiniBatches(context.Background(), 3)
+	assert.Equal(t, &NonFiniteError{Values: "activations", Layer: 0, Name: "dense", Epoch: 3, MiniBatch: 1}, err)
+	assert.EqualError(t, err, "NaN or Inf in the activations of layer 0 (dense) at epoch 3, mini batch 1")
+
+	// Skipped mini batches do not change the parameters
+	n.SetNonFiniteResponse(SkipBatchOnNonFinite)
+	n.data.miniBatches = stabilityMiniBatches(math.NaN(), 2)
+	w := mat64.DenseCopyOf(n.layers[1].Params()[0].Value)
+	assert.NoError(t, n.updateMiniBatches(context.Background(), 0))
+	assert.True(t, mat64.Equal(w, n.layers[1].Params()[0].Value))
+
+	n.SetNonFiniteResponse(LowerEtaOnNonFinite)
+	assert.NoError(t, n.updateMiniBatches(context.Background(), 0))
+	assert.Equal(t, 0.5, n.hp.eta)
+
+	// Updates overflowing the parameters are undone
+	n = newStabilityNetwork(1e250)
+	n.data.miniBatches = stabilityMiniBatches(1e100, 1e100)
+	n.SetNonFiniteResponse(SkipBatchOnNonFinite)
+	w = mat64.DenseCopyOf(n.layers[0].Params()[0].Value)
+	assert.NoError(t, n.updateMiniBatches(context.Background(), 0))
+	assert.True(t, mat64.Equal(w, n.layers[0].Params()[0].Value))
+
+	n.SetNonFiniteResponse(StopOnNonFinite)
+	err = n.updateMiniBatches(context.Background(), 0)
+	assert.Error(t, err)
+	assert.Equal(t, &NonFiniteError{Values: "parameters", Layer: 0, Name: "dense"}, err)
+	assert.True(t, mat64.Equal(w, n.layers[0].Params()[0].Value))
+}
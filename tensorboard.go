@@ -0,0 +1,322 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// TensorBoard writes training results to a TensorBoard event file. Added as an epoch callback
+// with n.AddEpochCallback(tb.Epoch), it writes the architecture of the network as text, and at
+// every epoch the loss, validation score and learning rate as scalars, histograms of the weights
+// and biases of every layer, and the gradient norm of every layer as scalars
+type TensorBoard struct {
+	Path string
+
+	f         *os.File
+	w         *bufio.Writer
+	err       error
+	described bool
+}
+
+// NewTensorBoard creates the directory dir if needed, and an event file in it
+func NewTensorBoard(dir string) (*TensorBoard, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("events.out.tfevents.%d.%s", time.Now().Unix(), host))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tb := &TensorBoard{Path: path, f: f, w: bufio.NewWriter(f)}
+	var event []byte
+	event = appendDouble(event, 1, wallTime())
+	event = appendBytes(event, 3, []byte("brain.Event:2"))
+	if err := tb.writeRecord(event); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return tb, tb.w.Flush()
+}
+
+// Epoch writes the results of the epoch, with the epoch as the step. Errors
+// stop the writing of the event file, and are returned by Close
+func (tb *TensorBoard) Epoch(n *Network, result EpochResult) {
+	if tb.err != nil {
+		return
+	}
+	if !tb.described {
+		tb.described = true
+		if tb.err = tb.AddText("architecture", result.Epoch, architecture(n)); tb.err != nil {
+			return
+		}
+	}
+
+	var values [][]byte
+	if !math.IsNaN(result.Loss) {
+		values = append(values, scalarValue("loss", result.Loss))
+	}
+	validation := validationMetrics(result.Validation)
+	var names []string
+	for name := range validation {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values = append(values, scalarValue("validation/"+name, validation[name]))
+	}
+	values = append(values, scalarValue("eta", n.hp.eta))
+
+	for k, layer := range n.layers {
+		prefix := fmt.Sprintf("layer%d_%s", k, layer.Name())
+		var weights, biases int
+		for _, param := range layer.Params() {
+			tag := fmt.Sprintf("%s/biases_%d", prefix, biases)
+			if param.Regularize {
+				tag = fmt.Sprintf("%s/weights_%d", prefix, weights)
+				weights++
+			} else {
+				biases++
+			}
+			values = append(values, histogramValue(tag, denseData(param.Value)))
+		}
+		if k < len(result.GradientNorms) {
+			values = append(values, scalarValue(prefix+"/gradient_norm", result.GradientNorms[k]))
+		}
+	}
+
+	if tb.err = tb.writeSummary(result.Epoch, values...); tb.err == nil {
+		tb.err = tb.w.Flush()
+	}
+}
+
+// AddScalar writes a scalar value at the given step
+func (tb *TensorBoard) AddScalar(tag string, step int, value float64) error {
+	return tb.writeSummary(step, scalarValue(tag, value))
+}
+
+// AddHistogram writes a histogram of the values at the given step
+func (tb *TensorBoard) AddHistogram(tag string, step int, values []float64) error {
+	return tb.writeSummary(step, histogramValue(tag, values))
+}
+
+// AddText writes a (markdown) text at the given step
+func (tb *TensorBoard) AddText(tag string, step int, text string) error {
+	return tb.writeSummary(step, textValue(tag, text))
+}
+
+// Close flushes and closes the event file, and returns the first error of Epoch, if any
+func (tb *TensorBoard) Close() error {
+	err := tb.w.Flush()
+	if cerr := tb.f.Close(); err == nil {
+		err = cerr
+	}
+	if tb.err != nil {
+		return tb.err
+	}
+	return err
+}
+
+// architecture returns a markdown table of the layers of the network
+func architecture(n *Network) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "| layer | type | output size | parameters | trainable |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| input | | %d | | |\n", n.Sizes[0])
+	for k, layer := range n.layers {
+		params := 0
+		for _, param := range layer.Params() {
+			rows, cols := param.Value.Dims()
+			params += rows * cols
+		}
+		fmt.Fprintf(&b, "| %d | %s | %d | %d | %t |\n", k, layer.Name(), n.Sizes[k+1], params, n.Trainable(k))
+	}
+	return b.String()
+}
+
+// wallTime returns the current time in seconds since the epoch
+func wallTime() float64 {
+	return float64(time.Now().UnixNano()) / 1e9
+}
+
+// writeSummary writes an event with a summary of the values at the given step
+func (tb *TensorBoard) writeSummary(step int, values ...[]byte) error {
+	var summary []byte
+	for _, value := range values {
+		summary = appendBytes(summary, 1, value)
+	}
+
+	var event []byte
+	event = appendDouble(event, 1, wallTime())
+	event = appendVarint(appendTag(event, 2, 0), uint64(step))
+	event = appendBytes(event, 5, summary)
+	return tb.writeRecord(event)
+}
+
+// crcTable is the table of CRC-32C, the checksum of TFRecords
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC returns the masked CRC-32C of data, as stored in TFRecords
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, crcTable)
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// writeRecord writes data as a TFRecord: the length as a little endian uint64,
+// the masked CRC of the length, the data and the masked CRC of the data
+func (tb *TensorBoard) writeRecord(data []byte) error {
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint64(header, uint64(len(data)))
+	binary.LittleEndian.PutUint32(header[8:], maskedCRC(header[:8]))
+
+	footer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footer, maskedCRC(data))
+
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := tb.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scalarValue returns a Summary.Value with the value as simple_value
+func scalarValue(tag string, value float64) []byte {
+	var v []byte
+	v = appendBytes(v, 1, []byte(tag))
+	v = appendTag(v, 2, 5)
+	return binary.LittleEndian.AppendUint32(v, math.Float32bits(float32(value)))
+}
+
+// histogramBuckets is the number of buckets of histograms
+const histogramBuckets = 30
+
+// histogramValue returns a Summary.Value with a HistogramProto of the values in equal buckets.
+// NaN and Inf values are left out
+func histogramValue(tag string, all []float64) []byte {
+	var values []float64
+	for _, v := range all {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			values = append(values, v)
+		}
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	var sum, squares float64
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+		sum += v
+		squares += v * v
+	}
+	if len(values) == 0 {
+		lo, hi = 0, 0
+	}
+
+	buckets := histogramBuckets
+	if hi == lo {
+		buckets = 1
+	}
+	limits := make([]float64, buckets)
+	counts := make([]float64, buckets)
+	width := (hi - lo) / float64(buckets)
+	for i := range limits {
+		limits[i] = lo + float64(i+1)*width
+	}
+	limits[buckets-1] = hi
+	for _, v := range values {
+		i := buckets - 1
+		if width > 0 {
+			i = int(math.Min(float64(buckets-1), (v-lo)/width))
+		}
+		counts[i]++
+	}
+
+	var histo []byte
+	histo = appendDouble(histo, 1, lo)
+	histo = appendDouble(histo, 2, hi)
+	histo = appendDouble(histo, 3, float64(len(values)))
+	histo = appendDouble(histo, 4, sum)
+	histo = appendDouble(histo, 5, squares)
+	histo = appendPackedDoubles(histo, 6, limits)
+	histo = appendPackedDoubles(histo, 7, counts)
+
+	var v []byte
+	v = appendBytes(v, 1, []byte(tag))
+	return appendBytes(v, 5, histo)
+}
+
+// textValue returns a Summary.Value with the text as a string tensor of the text plugin
+func textValue(tag, text string) []byte {
+	pluginData := appendBytes(nil, 1, []byte("text"))
+	metadata := appendBytes(nil, 1, pluginData)
+
+	var tensor []byte
+	tensor = appendVarint(appendTag(tensor, 1, 0), 7) // DT_STRING
+	tensor = appendBytes(tensor, 2, nil)              // scalar shape
+	tensor = appendBytes(tensor, 8, []byte(text))
+
+	var v []byte
+	v = appendBytes(v, 1, []byte(tag))
+	v = appendBytes(v, 8, tensor)
+	return appendBytes(v, 9, metadata)
+}
+
+// denseData returns the entries of m
+func denseData(m *mat64.Dense) []float64 {
+	rows, cols := m.Dims()
+	data := make([]float64, 0, rows*cols)
+	for i := 0; i < rows; i++ {
+		data = append(data, m.RawRowView(i)...)
+	}
+	return data
+}
+
+// appendVarint appends v in the varint encoding of protocol buffers
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendTag appends the key of a protocol buffer field with the given wire type
+func appendTag(b []byte, field, wireType int) []byte {
+	return appendVarint(b, uint64(field<<3|wireType))
+}
+
+// appendDouble appends a double field
+func appendDouble(b []byte, field int, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(appendTag(b, field, 1), math.Float64bits(v))
+}
+
+// appendBytes appends a length delimited field, such as a string or a message
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = appendVarint(appendTag(b, field, 2), uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendPackedDoubles appends a packed repeated double field
+func appendPackedDoubles(b []byte, field int, vs []float64) []byte {
+	data := make([]byte, 0, 8*len(vs))
+	for _, v := range vs {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	}
+	return appendBytes(b, field, data)
+}
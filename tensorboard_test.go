@@ -0,0 +1,149 @@
+package network
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// protoFields decodes a protocol buffer message into the values of every field: uint64 for
+// varints, the bits of fixed64 and fixed32 values, and []byte for length delimited fields
+func protoFields(t *testing.T, data []byte) map[int][]interface{} {
+	fields := make(map[int][]interface{})
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		assert.True(t, n > 0)
+		data = data[n:]
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(data)
+			assert.True(t, n > 0)
+			fields[field] = append(fields[field], v)
+			data = data[n:]
+		case 1:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			assert.True(t, n > 0)
+			fields[field] = append(fields[field], data[n:n+int(size)])
+			data = data[n+int(size):]
+		case 5:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			t.Fatalf("unknown wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// readRecords reads the TFRecords of the file, checking the framing and the CRCs
+func readRecords(t *testing.T, path string) [][]byte {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	unmask := func(masked uint32) uint32 {
+		crc := masked - 0xa282ead8
+		return crc<<15 | crc>>17
+	}
+	table := crc32.MakeTable(crc32.Castagnoli)
+
+	var records [][]byte
+	for len(data) > 0 {
+		assert.True(t, len(data) >= 16)
+		length := binary.LittleEndian.Uint64(data)
+		assert.Equal(t, crc32.Checksum(data[:8], table), unmask(binary.LittleEndian.Uint32(data[8:])))
+		record := data[12 : 12+length]
+		assert.Equal(t, crc32.Checksum(record, table), unmask(binary.LittleEndian.Uint32(data[12+length:])))
+		records = append(records, record)
+		data = data[16+length:]
+	}
+	return records
+}
+
+func TestMaskedCRC(t *testing.T) {
+	// the CRC-32C check value, masked as in TFRecords
+	crc := uint32(0xe3069283)
+	assert.Equal(t, (crc>>15|crc<<17)+0xa282ead8, maskedCRC([]byte("123456789")))
+}
+
+func TestTensorBoard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tensorboard")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tb, err := NewTensorBoard(dir)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(tb.Path, dir+"/events.out.tfevents."))
+
+	n, _ := newTunerNetwork(map[string]float64{"hidden": 3})
+	data := tunerData(20)
+	n.LoadTrainingData(data.Input, data.Output)
+	n.LoadValidationData(data.Input, data.Output)
+	n.SetQuiet(true)
+	n.AddEpochCallback(tb.Epoch)
+	n.TrainNetwork(2, 4, 0.5, 0, true, true, 2)
+	assert.NoError(t, tb.AddHistogram("constant", 5, []float64{1, 1, math.NaN()}))
+	assert.NoError(t, tb.Close())
+
+	records := readRecords(t, tb.Path)
+	assert.Equal(t, 5, len(records))
+
+	event := protoFields(t, records[0])
+	assert.Equal(t, "brain.Event:2", string(event[3][0].([]byte)))
+
+	// values returns the Summary.Values of an event by tag, checking the step
+	values := func(record []byte, step uint64) map[string]map[int][]interface{} {
+		event := protoFields(t, record)
+		assert.True(t, math.Float64frombits(event[1][0].(uint64)) > 0)
+		assert.Equal(t, step, event[2][0])
+		summary := protoFields(t, event[5][0].([]byte))
+		byTag := make(map[string]map[int][]interface{})
+		for _, v := range summary[1] {
+			value := protoFields(t, v.([]byte))
+			byTag[string(value[1][0].([]byte))] = value
+		}
+		return byTag
+	}
+
+	text := values(records[1], 0)["architecture"]
+	metadata := protoFields(t, text[9][0].([]byte))
+	assert.Equal(t, "text", string(protoFields(t, metadata[1][0].([]byte))[1][0].([]byte)))
+	tensor := protoFields(t, text[8][0].([]byte))
+	assert.Equal(t, uint64(7), tensor[1][0])
+	assert.Contains(t, string(tensor[8][0].([]byte)), "| 0 | dense | 3 | 9 | true |")
+
+	for epoch := 0; epoch < 2; epoch++ {
+		byTag := values(records[2+epoch], uint64(epoch))
+		for _, tag := range []string{"loss", "validation/accuracy", "eta", "layer0_dense/gradient_norm", "layer1_dense/gradient_norm"} {
+			assert.Contains(t, byTag, tag)
+		}
+		assert.Equal(t, float32(0.5), math.Float32frombits(byTag["eta"][2][0].(uint32)))
+		assert.True(t, math.Float32frombits(byTag["layer1_dense/gradient_norm"][2][0].(uint32)) > 0)
+
+		histo := protoFields(t, byTag["layer0_dense/weights_0"][5][0].([]byte))
+		assert.Equal(t, 6.0, math.Float64frombits(histo[3][0].(uint64)))
+		limits, counts := histo[6][0].([]byte), histo[7][0].([]byte)
+		assert.Equal(t, 8*histogramBuckets, len(limits))
+		assert.Equal(t, 8*histogramBuckets, len(counts))
+		var total float64
+		for i := 0; i < histogramBuckets; i++ {
+			total += math.Float64frombits(binary.LittleEndian.Uint64(counts[8*i:]))
+		}
+		assert.Equal(t, 6.0, total)
+		assert.Contains(t, byTag, "layer1_dense/biases_0")
+	}
+
+	histo := protoFields(t, values(records[4], 5)["constant"][5][0].([]byte))
+	assert.Equal(t, 2.0, math.Float64frombits(histo[3][0].(uint64)))
+	assert.Equal(t, 8, len(histo[6][0].([]byte)))
+}
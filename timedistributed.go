@@ -0,0 +1,163 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gonum/matrix/mat64"
+)
+
+// TimeDistributed applies the same layer to every step of a sequence of Steps vectors, e.g a
+// dense layer to every position of a Transformer. The layer gets containers for every step
+// at every core, with step t at core proc using the containers at proc*Steps+t
+type TimeDistributed struct {
+	Layer     Layer
+	Steps     int
+	inputDim  int
+	outputDim int
+	grads     [][]*mat64.Dense
+	a         []*mat64.Vector
+	deltaIn   []*mat64.Vector
+	weightSource
+}
+
+// NewTimeDistributed returns a layer applying layer to every step of sequences of the given length
+func NewTimeDistributed(layer Layer, steps int) *TimeDistributed {
+	return &TimeDistributed{Layer: layer, Steps: steps}
+}
+
+func (td *TimeDistributed) Name() string { return "timeDistributed" }
+
+// Init initiates the layer with the size of a single step as input size
+func (td *TimeDistributed) Init(inputSize int) (int, error) {
+	if td.Layer == nil || td.Steps <= 0 || inputSize%td.Steps != 0 {
+		return 0, fmt.Errorf("invalid layer or steps %d for input size %d", td.Steps, inputSize)
+	}
+	if _, ok := td.Layer.(BatchLayer); ok {
+		return 0, fmt.Errorf("batch layers can not be time distributed")
+	}
+
+	td.inputDim = inputSize / td.Steps
+	outputDim, err := initLayer(td.Layer, td.inputDim, td.rng)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", td.Layer.Name(), err)
+	}
+	td.outputDim = outputDim
+
+	return td.Steps * td.outputDim, nil
+}
+
+// Alloc allocates the containers of the layer for every step at every core,
+// and the gradients of all the steps for every core
+func (td *TimeDistributed) Alloc(nCores int) {
+	td.Layer.Alloc(nCores * td.Steps)
+	td.a = sliceWithGonumVector(nCores, repeat(td.Steps*td.outputDim, nCores), zeroFunc())
+	td.deltaIn = sliceWithGonumVector(nCores, repeat(td.Steps*td.inputDim, nCores), zeroFunc())
+
+	td.grads = make([][]*mat64.Dense, nCores)
+	for proc := range td.grads {
+		for _, param := range td.Layer.Params() {
+			rows, cols := param.Value.Dims()
+			td.grads[proc] = append(td.grads[proc], mat64.NewDense(rows, cols, nil))
+		}
+	}
+}
+
+// Forward feeds every step of x through the layer
+func (td *TimeDistributed) Forward(x *mat64.Vector, proc int) *mat64.Vector {
+	var a *mat64.Vector
+	if proc == inference {
+		a = mat64.NewVector(td.Steps*td.outputDim, nil)
+	} else {
+		a = td.a[proc]
+	}
+
+	for t := 0; t < td.Steps; t++ {
+		stepProc := inference
+		if proc != inference {
+			stepProc = proc*td.Steps + t
+		}
+		out := td.Layer.Forward(x.ViewVec(t*td.inputDim, td.inputDim), stepProc)
+		a.ViewVec(t*td.outputDim, td.outputDim).CopyVec(out)
+	}
+
+	return a
+}
+
+// backward backpropagates the error of every step through the layer, and moves
+// the gradients of the steps to the gradients at proc
+func (td *TimeDistributed) backward(delta *mat64.Vector, proc int, output bool) *mat64.Vector {
+	outputLayer, isOutput := td.Layer.(OutputLayer)
+	for t := 0; t < td.Steps; t++ {
+		stepProc := proc*td.Steps + t
+		d := delta.ViewVec(t*td.outputDim, td.outputDim)
+
+		var in *mat64.Vector
+		if output && isOutput {
+			in = outputLayer.BackwardOutput(d, stepProc)
+		} else {
+			in = td.Layer.Backward(d, stepProc)
+		}
+		td.deltaIn[proc].ViewVec(t*td.inputDim, td.inputDim).CopyVec(in)
+
+		for i, grad := range td.Layer.Grads(stepProc) {
+			td.grads[proc][i].Add(td.grads[proc][i], grad)
+			zeroDense(grad)
+		}
+	}
+
+	return td.deltaIn[proc]
+}
+
+// Backward backpropagates the error at every step through the layer
+func (td *TimeDistributed) Backward(delta *mat64.Vector, proc int) *mat64.Vector {
+	return td.backward(delta, proc, false)
+}
+
+// BackwardOutput backpropagates the output error of the network at every step through the
+// layer, using BackwardOutput if the layer ends in an activation function
+func (td *TimeDistributed) BackwardOutput(delta *mat64.Vector, proc int) *mat64.Vector {
+	return td.backward(delta, proc, true)
+}
+
+// Params returns the parameters of the layer
+func (td *TimeDistributed) Params() []*Param {
+	return td.Layer.Params()
+}
+
+// Grads returns the gradients of all the steps at proc
+func (td *TimeDistributed) Grads(proc int) []*mat64.Dense {
+	return td.grads[proc]
+}
+
+// timeDistributedFile is the format in which time distributed layers are saved
+type timeDistributedFile struct {
+	Steps  int             `json:"steps"`
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+}
+
+// MarshalJSON returns the number of steps and the type and configuration of the layer
+func (td *TimeDistributed) MarshalJSON() ([]byte, error) {
+	config, err := json.Marshal(td.Layer)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(timeDistributedFile{Steps: td.Steps, Type: td.Layer.Name(), Config: config})
+}
+
+// UnmarshalJSON rebuilds a time distributed layer saved with MarshalJSON
+func (td *TimeDistributed) UnmarshalJSON(data []byte) error {
+	var tf timeDistributedFile
+	if err := json.Unmarshal(data, &tf); err != nil {
+		return err
+	}
+
+	layer, err := NewLayer(tf.Type, tf.Config)
+	if err != nil {
+		return err
+	}
+
+	*td = TimeDistributed{Layer: layer, Steps: tf.Steps}
+	return nil
+}
@@ -0,0 +1,367 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Hyperparameter is a dimension of a search space. Grid search tries every value of Values.
+// Random search samples Values uniformly, or [Min, Max] if Values is empty, log-uniformly if
+// Log is true. Sampled values are rounded if Int is true
+type Hyperparameter struct {
+	Name   string
+	Values []float64
+	Min    float64
+	Max    float64
+	Log    bool
+	Int    bool
+}
+
+// SearchSpace contains the hyperparameters searched by a tuner
+type SearchSpace []Hyperparameter
+
+// Trial contains the hyperparameters of a trial and the results of training with them.
+// Scores contains the score of every trained epoch, and Score the best of them. Stopped is
+// true if the trial was stopped early, and Pruned if it was stopped by the pruner
+type Trial struct {
+	ID        int
+	Params    map[string]float64
+	Score     float64
+	Scores    []float64
+	BestEpoch int
+	Epochs    int
+	Stopped   bool
+	Pruned    bool
+	Duration  time.Duration
+	Err       error
+}
+
+// Tuner searches for the hyperparameters giving the best validation score. Every trial trains its
+// own network, returned by NewNetwork for the hyperparameters of the trial, which must not share
+// state such as a pipeline with the networks of other trials. The hyperparameters named eta,
+// lambda and batchSize override the training parameters of the tuner, the others are used by
+// NewNetwork, e.g as layer sizes.
+//
+// Concurrency trials are trained in parallel, on CoresPerTrial cores each. The score of an epoch
+// is given by Score, by default the score of the validation result. A trial is stopped early when
+// its score has not improved for Patience epochs, unless Patience is zero, and when the Pruner
+// (if any) prunes it. If StatePath is set, the finished trials are saved to it, and a search
+// with the same tuner resumes from the trials saved by an earlier search
+type Tuner struct {
+	Space      SearchSpace
+	NewNetwork func(params map[string]float64) (*Network, error)
+	Training   DataSet
+	Validation DataSet
+
+	Epochs    int
+	BatchSize int
+	Eta       float64
+	Lambda    float64
+	Shuffle   bool
+
+	Score         func(result EpochResult) float64
+	Patience      int
+	Pruner        Pruner
+	Concurrency   int
+	CoresPerTrial int
+	StatePath     string
+}
+
+// GridSearch trains a trial for every combination of the values of the hyperparameters,
+// and returns the trials ranked by score
+func (t *Tuner) GridSearch() ([]Trial, error) {
+	configs := []map[string]float64{{}}
+	for _, hp := range t.Space {
+		if len(hp.Values) == 0 {
+			return nil, fmt.Errorf("hyperparameter %s has no values to search", hp.Name)
+		}
+		var next []map[string]float64
+		for _, config := range configs {
+			for _, v := range hp.Values {
+				params := copyParams(config)
+				params[hp.Name] = v
+				next = append(next, params)
+			}
+		}
+		configs = next
+	}
+
+	return t.search(len(configs), func(id int, done []Trial) map[string]float64 {
+		return configs[id]
+	})
+}
+
+// RandomSearch trains trials with hyperparameters sampled from the search space by
+// a random source seeded by seed, and returns the trials ranked by score
+func (t *Tuner) RandomSearch(trials int, seed int64) ([]Trial, error) {
+	return t.Search(trials, RandomSampler{}, seed)
+}
+
+// Search trains trials with hyperparameters sampled by the sampler, given the trials finished
+// so far and a random source seeded by seed, and returns the trials ranked by score
+func (t *Tuner) Search(trials int, sampler Sampler, seed int64) ([]Trial, error) {
+	if trials < 1 {
+		return nil, fmt.Errorf("invalid number of trials %d", trials)
+	}
+	if err := t.Space.validate(); err != nil {
+		return nil, err
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	return t.search(trials, func(id int, done []Trial) map[string]float64 {
+		return sampler.Sample(t.Space, done, r)
+	})
+}
+
+// validate checks that every hyperparameter can be sampled
+func (space SearchSpace) validate() error {
+	for _, hp := range space {
+		if len(hp.Values) > 0 {
+			continue
+		}
+		if hp.Max < hp.Min || hp.Log && hp.Min <= 0 {
+			return fmt.Errorf("invalid range [%g, %g] of hyperparameter %s", hp.Min, hp.Max, hp.Name)
+		}
+	}
+	return nil
+}
+
+// sample returns hyperparameters sampled from the search space
+func (space SearchSpace) sample(r *rand.Rand) map[string]float64 {
+	params := make(map[string]float64, len(space))
+	for _, hp := range space {
+		params[hp.Name] = hp.sample(r)
+	}
+	return params
+}
+
+// sample returns a value of the hyperparameter
+func (hp Hyperparameter) sample(r *rand.Rand) float64 {
+	if len(hp.Values) > 0 {
+		return hp.Values[r.Intn(len(hp.Values))]
+	}
+
+	var v float64
+	if hp.Log {
+		v = math.Exp(math.Log(hp.Min) + r.Float64()*(math.Log(hp.Max)-math.Log(hp.Min)))
+	} else {
+		v = hp.Min + r.Float64()*(hp.Max-hp.Min)
+	}
+	if hp.Int {
+		v = math.Round(v)
+	}
+	return v
+}
+
+// copyParams returns a copy of the hyperparameters
+func copyParams(params map[string]float64) map[string]float64 {
+	c := make(map[string]float64, len(params))
+	for name, v := range params {
+		c[name] = v
+	}
+	return c
+}
+
+// search trains the trials 0 to total-1 with the hyperparameters given by next, Concurrency
+// trials at a time, and returns the trials ranked by score. next is called with the trials
+// finished so far, one trial at a time in the order of the trials. The trials saved at
+// StatePath are not trained again, and are reported to the pruner before the search starts
+func (t *Tuner) search(total int, next func(id int, done []Trial) map[string]float64) ([]Trial, error) {
+	if t.NewNetwork == nil {
+		return nil, fmt.Errorf("tuner has no NewNetwork")
+	}
+	if len(t.Training.Input) == 0 || len(t.Validation.Input) == 0 {
+		return nil, fmt.Errorf("tuner needs training and validation data")
+	}
+
+	done, err := t.loadState()
+	if err != nil {
+		return nil, err
+	}
+	finished := make(map[int]bool)
+	for _, trial := range done {
+		finished[trial.ID] = true
+		if t.Pruner != nil {
+			for epoch, score := range trial.Scores {
+				t.Pruner.Prune(trial.ID, epoch, score)
+			}
+		}
+	}
+
+	concurrency := t.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	var saveErr error
+	id := 0
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for id < total && finished[id] {
+					id++
+				}
+				if id >= total {
+					mu.Unlock()
+					return
+				}
+				current := id
+				id++
+				params := next(current, done)
+				mu.Unlock()
+
+				trial := t.trial(current, params, t.Epochs)
+
+				mu.Lock()
+				done = append(done, trial)
+				if err := t.saveState(done); err != nil && saveErr == nil {
+					saveErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	trials := make([]Trial, len(done))
+	copy(trials, done)
+	RankTrials(trials)
+	return trials, saveErr
+}
+
+// param returns the named hyperparameter of the trial, or def if the space does not contain it
+func param(params map[string]float64, name string, def float64) float64 {
+	if v, ok := params[name]; ok {
+		return v
+	}
+	return def
+}
+
+// trial trains a network with the hyperparameters for at most epochs epochs,
+// stopping early if the score stops improving
+func (t *Tuner) trial(id int, params map[string]float64, epochs int) (trial Trial) {
+	trial = Trial{ID: id, Params: params, Score: math.Inf(-1)}
+	start := time.Now()
+	defer func() { trial.Duration = time.Since(start) }()
+
+	n, err := t.NewNetwork(params)
+	if err != nil {
+		trial.Err = err
+		return trial
+	}
+	if n.validationMethod == nil {
+		trial.Err = fmt.Errorf("network has no validation method")
+		return trial
+	}
+	n.SetQuiet(true)
+	n.LoadTrainingData(t.Training.Input, t.Training.Output)
+	n.LoadValidationData(t.Validation.Input, t.Validation.Output)
+
+	score := t.Score
+	if score == nil {
+		score = validationScore
+	}
+	n.AddEpochCallback(func(n *Network, result EpochResult) {
+		s := score(result)
+		trial.Scores = append(trial.Scores, s)
+		trial.Epochs = result.Epoch + 1
+		if s > trial.Score {
+			trial.Score, trial.BestEpoch = s, result.Epoch
+		}
+		if t.Patience > 0 && result.Epoch-trial.BestEpoch >= t.Patience {
+			trial.Stopped = true
+			n.StopTraining()
+		}
+		if t.Pruner != nil && t.Pruner.Prune(id, result.Epoch, s) {
+			trial.Stopped, trial.Pruned = true, true
+			n.StopTraining()
+		}
+	})
+
+	batchSize := int(param(params, "batchSize", float64(t.BatchSize)))
+	if batchSize < 1 || batchSize > len(t.Training.Input) {
+		trial.Err = fmt.Errorf("invalid batch size %d", batchSize)
+		return trial
+	}
+	cores := t.CoresPerTrial
+	if cores < 1 {
+		cores = 1
+	}
+	if _, err := n.TrainContext(context.Background(), epochs, batchSize, param(params, "eta", t.Eta),
+		param(params, "lambda", t.Lambda), t.Shuffle, true, cores); err != nil {
+		trial.Err = err
+	}
+
+	return trial
+}
+
+// validationScore returns the score of the validation result of the epoch,
+// or NaN if there is no validation result
+func validationScore(result EpochResult) float64 {
+	if result.Validation == nil {
+		return math.NaN()
+	}
+	return result.Validation.Score()
+}
+
+// RankTrials sorts the trials by descending score. Failed trials and
+// trials without a finite score are ranked last
+func RankTrials(trials []Trial) {
+	key := func(trial Trial) float64 {
+		if trial.Err != nil || math.IsNaN(trial.Score) {
+			return math.Inf(-1)
+		}
+		return trial.Score
+	}
+	sort.SliceStable(trials, func(i, j int) bool { return key(trials[i]) > key(trials[j]) })
+}
+
+// WriteTrials writes the ranked trials as a table, with a column for every hyperparameter
+func WriteTrials(w io.Writer, trials []Trial) error {
+	var names []string
+	seen := make(map[string]bool)
+	for _, trial := range trials {
+		for name := range trial.Params {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "rank\ttrial\t%s\tscore\tbest epoch\tepochs\tduration\n", strings.Join(names, "\t"))
+	for rank, trial := range trials {
+		fmt.Fprintf(tw, "%d\t%d", rank+1, trial.ID)
+		for _, name := range names {
+			fmt.Fprintf(tw, "\t%.4g", trial.Params[name])
+		}
+		if trial.Err != nil {
+			fmt.Fprintf(tw, "\terror: %v\t\t\t\n", trial.Err)
+			continue
+		}
+		stopped := ""
+		if trial.Pruned {
+			stopped = " (pruned)"
+		} else if trial.Stopped {
+			stopped = " (stopped)"
+		}
+		fmt.Fprintf(tw, "\t%.4f\t%d\t%d%s\t%s\n", trial.Score, trial.BestEpoch, trial.Epochs, stopped,
+			trial.Duration.Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,268 @@
+package network
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tunerData returns a data set where the class is given by the larger of two inputs
+func tunerData(size int) DataSet {
+	var ds DataSet
+	for idx := 0; idx < size; idx++ {
+		x := []float64{rand.Float64(), rand.Float64()}
+		ds.Input = append(ds.Input, x)
+		if x[0] > x[1] {
+			ds.Output = append(ds.Output, []float64{1, 0})
+		} else {
+			ds.Output = append(ds.Output, []float64{0, 1})
+		}
+	}
+	return ds
+}
+
+// newTunerNetwork returns a 2-hidden-2 network, with the hidden size given by the hyperparameters
+func newTunerNetwork(params map[string]float64) (*Network, error) {
+	n := &Network{}
+	n.AddLayer(2, nil, nil)
+	n.AddLayer(int(param(params, "hidden", 4)), Sigmoid, SigmoidPrime)
+	n.AddLayer(2, Sigmoid, SigmoidPrime)
+	n.InitNetworkMethods(OutputErrorXEntropy, ValidateClassification)
+	return n, nil
+}
+
+func TestGridSearch(t *testing.T) {
+	tuner := &Tuner{
+		Space: SearchSpace{
+			{Name: "eta", Values: []float64{0.01, 1}},
+			{Name: "hidden", Values: []float64{2, 4, 8}},
+		},
+		NewNetwork:    newTunerNetwork,
+		Training:      tunerData(40),
+		Validation:    tunerData(20),
+		Epochs:        5,
+		BatchSize:     4,
+		Shuffle:       true,
+		Concurrency:   3,
+		CoresPerTrial: 2,
+	}
+	trials, err := tuner.GridSearch()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(trials))
+
+	ids := make(map[int]bool)
+	for idx, trial := range trials {
+		assert.NoError(t, trial.Err)
+		assert.Equal(t, 5, trial.Epochs)
+		assert.Equal(t, 5, len(trial.Scores))
+		assert.Equal(t, trial.Scores[trial.BestEpoch], trial.Score)
+		assert.True(t, trial.Duration > 0)
+		if idx > 0 {
+			assert.True(t, trials[idx-1].Score >= trial.Score)
+		}
+		ids[trial.ID] = true
+	}
+	assert.Equal(t, 6, len(ids))
+
+	var table bytes.Buffer
+	assert.NoError(t, WriteTrials(&table, trials))
+	assert.Contains(t, table.String(), "rank  trial  eta")
+	assert.Equal(t, 7, bytes.Count(table.Bytes(), []byte("\n")))
+
+	tuner.Space = append(tuner.Space, Hyperparameter{Name: "lambda", Min: 0, Max: 1})
+	_, err = tuner.GridSearch()
+	assert.Error(t, err)
+}
+
+func TestRandomSearch(t *testing.T) {
+	tuner := &Tuner{
+		Space: SearchSpace{
+			{Name: "eta", Min: 0.01, Max: 10, Log: true},
+			{Name: "hidden", Min: 2, Max: 8, Int: true},
+			{Name: "batchSize", Values: []float64{2, 4, 100}},
+		},
+		NewNetwork:  newTunerNetwork,
+		Training:    tunerData(40),
+		Validation:  tunerData(20),
+		Epochs:      10,
+		Concurrency: 2,
+		// The score decreases every epoch, so the trials are stopped after the patience
+		Score:    func(result EpochResult) float64 { return -float64(result.Epoch) },
+		Patience: 2,
+	}
+	trials, err := tuner.RandomSearch(8, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(trials))
+
+	for _, trial := range trials {
+		assert.True(t, trial.Params["eta"] >= 0.01 && trial.Params["eta"] <= 10)
+		assert.Equal(t, float64(int(trial.Params["hidden"])), trial.Params["hidden"])
+		if trial.Params["batchSize"] == 100 {
+			assert.Error(t, trial.Err)
+			continue
+		}
+		assert.NoError(t, trial.Err)
+		assert.True(t, trial.Stopped)
+		assert.Equal(t, 3, trial.Epochs)
+		assert.Equal(t, 0, trial.BestEpoch)
+	}
+
+	// the same seed samples the same hyperparameters
+	again, err := tuner.RandomSearch(8, 1)
+	assert.NoError(t, err)
+	params := func(trials []Trial) map[int]map[string]float64 {
+		m := make(map[int]map[string]float64)
+		for _, trial := range trials {
+			m[trial.ID] = trial.Params
+		}
+		return m
+	}
+	assert.Equal(t, params(trials), params(again))
+
+	tuner.Space[0].Min = 0
+	_, err = tuner.RandomSearch(8, 1)
+	assert.Error(t, err)
+}
+
+func TestTrialTrainingError(t *testing.T) {
+	// the inputs are not valid ids of the embedding, so training fails
+	tuner := &Tuner{
+		Space: SearchSpace{{Name: "eta", Values: []float64{0.1}}},
+		NewNetwork: func(params map[string]float64) (*Network, error) {
+			n := &Network{}
+			n.AddLayer(2, nil, nil)
+			n.Add(NewEmbedding(4, 2))
+			n.AddLayer(2, Sigmoid, SigmoidPrime)
+			n.InitNetworkMethods(OutputErrorXEntropy, ValidateClassification)
+			return n, nil
+		},
+		Training:   tunerData(8),
+		Validation: tunerData(4),
+		Epochs:     2,
+		BatchSize:  4,
+	}
+	trials, err := tuner.GridSearch()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(trials))
+	assert.Error(t, trials[0].Err)
+	assert.Contains(t, trials[0].Err.Error(), "embedding: invalid id")
+}
+
+func TestSuccessiveHalving(t *testing.T) {
+	sh := &SuccessiveHalving{MinEpochs: 1, Reduction: 2}
+	assert.False(t, sh.Prune(0, 0, 0.5))
+	assert.True(t, sh.Prune(1, 0, 0.4))
+	assert.False(t, sh.Prune(2, 0, 0.9))
+	assert.False(t, sh.Prune(3, 0, 0.6))
+	assert.True(t, sh.Prune(4, 0, 0.45))
+	assert.True(t, sh.Prune(5, 0, math.NaN()))
+
+	// rungs are placed after 1, 2, 4, ... epochs
+	assert.False(t, sh.Prune(0, 1, 0.5))
+	assert.False(t, sh.Prune(1, 2, 0))
+	assert.True(t, sh.Prune(1, 1, 0.1))
+	assert.False(t, sh.Prune(2, 3, 0.1))
+
+	hb := &Hyperband{MinEpochs: 1, MaxEpochs: 9, Reduction: 3}
+	hb.Prune(0, 0, 0)
+	assert.Equal(t, 3, len(hb.brackets))
+	assert.Equal(t, []int{1, 3, 9}, []int{hb.brackets[0].MinEpochs, hb.brackets[1].MinEpochs, hb.brackets[2].MinEpochs})
+	assert.True(t, hb.Prune(3, 0, -1))
+	assert.False(t, hb.Prune(1, 0, -1))
+	assert.False(t, hb.Prune(1, 2, 1))
+	assert.True(t, hb.Prune(4, 2, 0))
+}
+
+func TestTPE(t *testing.T) {
+	space := SearchSpace{
+		{Name: "x", Min: 0, Max: 1},
+		{Name: "lr", Min: 1e-4, Max: 1, Log: true},
+		{Name: "units", Values: []float64{8, 16, 32}},
+	}
+	objective := func(params map[string]float64) float64 {
+		score := -math.Pow(params["x"]-0.7, 2) - math.Pow(math.Log10(params["lr"])+2, 2)
+		if params["units"] == 16 {
+			score += 1
+		}
+		return score
+	}
+
+	r := rand.New(rand.NewSource(1))
+	var trials []Trial
+	for idx := 0; idx < 40; idx++ {
+		params := RandomSampler{}.Sample(space, trials, r)
+		trials = append(trials, Trial{ID: idx, Params: params, Score: objective(params)})
+	}
+
+	var tpeScore, randomScore float64
+	tpe := TPE{Startup: 10}
+	for idx := 0; idx < 50; idx++ {
+		params := tpe.Sample(space, trials, r)
+		assert.True(t, params["x"] >= 0 && params["x"] <= 1)
+		assert.True(t, params["lr"] >= 1e-4 && params["lr"] <= 1)
+		tpeScore += objective(params)
+		randomScore += objective(space.sample(r))
+	}
+	assert.True(t, tpeScore > randomScore, "TPE %g, random %g", tpeScore, randomScore)
+}
+
+func TestSearchState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuner")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	networks := 0
+	tuner := &Tuner{
+		Space: SearchSpace{
+			{Name: "eta", Min: 0.01, Max: 5, Log: true},
+			{Name: "hidden", Min: 2, Max: 8, Int: true},
+		},
+		NewNetwork: func(params map[string]float64) (*Network, error) {
+			mu.Lock()
+			networks++
+			mu.Unlock()
+			return newTunerNetwork(params)
+		},
+		Training:    tunerData(40),
+		Validation:  tunerData(20),
+		Epochs:      9,
+		BatchSize:   4,
+		Pruner:      &Hyperband{MinEpochs: 1, MaxEpochs: 9},
+		Concurrency: 2,
+		StatePath:   filepath.Join(dir, "tuner.json"),
+	}
+	trials, err := tuner.Search(6, TPE{Startup: 3}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(trials))
+	assert.Equal(t, 6, networks)
+	for _, trial := range trials {
+		assert.NoError(t, trial.Err)
+		assert.Equal(t, trial.Epochs, len(trial.Scores))
+		assert.True(t, trial.Pruned || trial.Epochs == 9)
+	}
+
+	// a new search with the same state file trains the remaining trials only
+	tuner.Pruner = &Hyperband{MinEpochs: 1, MaxEpochs: 9}
+	resumed, err := tuner.Search(8, TPE{Startup: 3}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(resumed))
+	assert.Equal(t, 8, networks)
+
+	byID := make(map[int]Trial)
+	for _, trial := range resumed {
+		byID[trial.ID] = trial
+	}
+	for _, trial := range trials {
+		assert.Equal(t, trial.Params, byID[trial.ID].Params)
+		assert.Equal(t, trial.Scores, byID[trial.ID].Scores)
+		assert.Equal(t, trial.Pruned, byID[trial.ID].Pruned)
+	}
+}
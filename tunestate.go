@@ -0,0 +1,126 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+// tunerState is the file of the finished trials of a search
+type tunerState struct {
+	Trials []trialState `json:"trials"`
+}
+
+// trialState is a finished trial in a tuner state file
+type trialState struct {
+	ID        int                `json:"id"`
+	Params    map[string]float64 `json:"params"`
+	Score     jsonFloat          `json:"score"`
+	Scores    []jsonFloat        `json:"scores"`
+	BestEpoch int                `json:"bestEpoch"`
+	Epochs    int                `json:"epochs"`
+	Stopped   bool               `json:"stopped,omitempty"`
+	Pruned    bool               `json:"pruned,omitempty"`
+	Duration  time.Duration      `json:"duration"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// jsonFloat is a float64 written as null in JSON if it is NaN or Inf, and read as NaN from null
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *jsonFloat) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = jsonFloat(math.NaN())
+		return nil
+	}
+	return json.Unmarshal(data, (*float64)(f))
+}
+
+// saveState writes the trials to StatePath, if set. The file is replaced
+// by a rename, so that an interrupted search leaves the previous state
+func (t *Tuner) saveState(trials []Trial) error {
+	if t.StatePath == "" {
+		return nil
+	}
+
+	var state tunerState
+	for _, trial := range trials {
+		ts := trialState{
+			ID:        trial.ID,
+			Params:    trial.Params,
+			Score:     jsonFloat(trial.Score),
+			BestEpoch: trial.BestEpoch,
+			Epochs:    trial.Epochs,
+			Stopped:   trial.Stopped,
+			Pruned:    trial.Pruned,
+			Duration:  trial.Duration,
+		}
+		for _, score := range trial.Scores {
+			ts.Scores = append(ts.Scores, jsonFloat(score))
+		}
+		if trial.Err != nil {
+			ts.Error = trial.Err.Error()
+		}
+		state.Trials = append(state.Trials, ts)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(t.StatePath+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(t.StatePath+".tmp", t.StatePath)
+}
+
+// loadState returns the trials saved at StatePath, or no trials
+// if StatePath is not set or the file does not exist
+func (t *Tuner) loadState() ([]Trial, error) {
+	if t.StatePath == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(t.StatePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state tunerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	trials := make([]Trial, len(state.Trials))
+	for i, ts := range state.Trials {
+		trials[i] = Trial{
+			ID:        ts.ID,
+			Params:    ts.Params,
+			Score:     float64(ts.Score),
+			BestEpoch: ts.BestEpoch,
+			Epochs:    ts.Epochs,
+			Stopped:   ts.Stopped,
+			Pruned:    ts.Pruned,
+			Duration:  ts.Duration,
+		}
+		for _, score := range ts.Scores {
+			trials[i].Scores = append(trials[i].Scores, float64(score))
+		}
+		if ts.Error != "" {
+			trials[i].Err = errors.New(ts.Error)
+		}
+	}
+	return trials, nil
+}
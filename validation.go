@@ -2,7 +2,10 @@ package network
 
 import (
 	"fmt"
+	"github.com/gmkvaal/parGoNN/metrics"
 	"github.com/gonum/matrix/mat64"
+	"math"
+	"runtime"
 )
 
 // argMax returns the index corresponding
@@ -36,24 +39,138 @@ func checkIfEqual(yNetwork []float64, y []float64) int {
 	}
 }
 
-func ValidateArgMaxSlice(n *Network, inputData, outputData []*mat64.Vector) bool {
+// Metric computes a score of the network on a set of input and output data
+type Metric func(n *Network, inputData, outputData []*mat64.Vector) float64
 
-	var yes, no int
+// HitRate returns the fraction of the input data where the arg max of the
+// network output matches the arg max of the output data
+func HitRate(n *Network, inputData, outputData []*mat64.Vector) float64 {
+	var yes int
 
 	for i := range inputData {
-		if checkIfEqual(n.forwardFeed(inputData[i], 0).RawVector().Data, outputData[i].RawVector().Data) == 1 {
-			yes += 1
-		} else {
-			no += 1
-		}
+		yes += checkIfEqual(n.forwardFeed(inputData[i], nil, inference).RawVector().Data, outputData[i].RawVector().Data)
 	}
 
-	fmt.Println("Hitrate:", 100*float64(yes)/float64(yes+no), "%")
+	return float64(yes) / float64(len(inputData))
+}
+
+func ValidateArgMaxSlice(n *Network, inputData, outputData []*mat64.Vector) bool {
+
+	hitRate := HitRate(n, inputData, outputData)
+
+	if !n.quiet {
+		fmt.Println("Hitrate:", 100*hitRate, "%")
+	}
 
-	if yes > 0 {
+	if hitRate > 0 {
 		return true
 	}
 
 	return false
 }
 
+// feedAll returns the network outputs for the input data along with the output data as slices
+func (n *Network) feedAll(inputData, outputData []*mat64.Vector) (predictions, targets [][]float64) {
+	predictions = make([][]float64, len(inputData))
+	targets = make([][]float64, len(outputData))
+	for i := range inputData {
+		predictions[i] = n.forwardFeed(inputData[i], nil, inference).RawVector().Data
+		targets[i] = outputData[i].RawVector().Data
+	}
+	return predictions, targets
+}
+
+// ValidateClassification computes the classification report of the network on the validation
+// data, and appends it to the validation history. Returns true if any sample was classified correctly
+func ValidateClassification(n *Network, inputData, outputData []*mat64.Vector) bool {
+	report := metrics.Classification(n.feedAll(inputData, outputData))
+	n.validationHistory = append(n.validationHistory, report)
+
+	return report.Accuracy > 0
+}
+
+// ValidationHistory returns the results recorded by the validation method at every epoch
+func (n *Network) ValidationHistory() []metrics.Result {
+	return n.validationHistory
+}
+
+// Evaluate returns the classification report of the network on the (unprocessed) input data,
+// including the top-k accuracy for every k in topK. The evaluation methods predict the
+// input data in parallel on GOMAXPROCS cores
+func (n *Network) Evaluate(inputData, outputData [][]float64, topK ...int) metrics.ClassificationReport {
+	predictions := n.PredictBatch(inputData, runtime.GOMAXPROCS(0))
+
+	return metrics.Classification(predictions, outputData, topK...)
+}
+
+// ValidateRegression computes the regression report of the network on the validation
+// data, and appends it to the validation history. Returns true if the mean squared error is finite
+func ValidateRegression(n *Network, inputData, outputData []*mat64.Vector) bool {
+	report := metrics.Regression(n.feedAll(inputData, outputData))
+	n.validationHistory = append(n.validationHistory, report)
+
+	return !math.IsNaN(report.MeanMSE) && !math.IsInf(report.MeanMSE, 0)
+}
+
+// EvaluateRegression returns the regression report of the network on the (unprocessed) input data
+func (n *Network) EvaluateRegression(inputData, outputData [][]float64) metrics.RegressionReport {
+	predictions := n.PredictBatch(inputData, runtime.GOMAXPROCS(0))
+
+	return metrics.Regression(predictions, outputData)
+}
+
+// SetThresholds sets the decision thresholds used for multi-label outputs, either one
+// global threshold or one per label. The default is a global threshold of 0.5, set
+// again by no thresholds
+func (n *Network) SetThresholds(thresholds ...float64) error {
+	if err := n.checkThresholds(thresholds); err != nil {
+		return err
+	}
+	n.thresholds = thresholds
+	return nil
+}
+
+// checkThresholds checks that there are no thresholds, one global threshold or one per label
+func (n *Network) checkThresholds(thresholds []float64) error {
+	if len(thresholds) <= 1 {
+		return nil
+	}
+	if len(n.Sizes) < 2 {
+		return fmt.Errorf("network has no layers to set thresholds for")
+	}
+	if labels := n.Sizes[len(n.Sizes)-1]; len(thresholds) != labels {
+		return fmt.Errorf("%d thresholds given for %d labels, expected 1 or %d", len(thresholds), labels, labels)
+	}
+	return nil
+}
+
+// PredictLabels returns the active labels of the network output for the (unprocessed) input x
+func (n *Network) PredictLabels(x []float64) []bool {
+	return metrics.ApplyThresholds(n.Predict(x), n.thresholds)
+}
+
+// TuneThresholds sets the per label thresholds maximizing the F1 score of every label
+// on the (unprocessed) input data, and returns them
+func (n *Network) TuneThresholds(inputData, outputData [][]float64) []float64 {
+	predictions := n.PredictBatch(inputData, runtime.GOMAXPROCS(0))
+
+	n.thresholds = metrics.TuneThresholds(predictions, outputData)
+	return n.thresholds
+}
+
+// ValidateMultiLabel computes the multi-label report of the network on the validation data,
+// and appends it to the validation history. Returns true if any label was predicted correctly
+func ValidateMultiLabel(n *Network, inputData, outputData []*mat64.Vector) bool {
+	predictions, targets := n.feedAll(inputData, outputData)
+	report := metrics.MultiLabel(predictions, targets, n.thresholds)
+	n.validationHistory = append(n.validationHistory, report)
+
+	return report.HammingLoss < 1
+}
+
+// EvaluateMultiLabel returns the multi-label report of the network on the (unprocessed) input data
+func (n *Network) EvaluateMultiLabel(inputData, outputData [][]float64) metrics.MultiLabelReport {
+	predictions := n.PredictBatch(inputData, runtime.GOMAXPROCS(0))
+
+	return metrics.MultiLabel(predictions, outputData, n.thresholds)
+}
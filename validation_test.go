@@ -3,6 +3,8 @@ package network
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"math"
+	"github.com/gmkvaal/parGoNN/metrics"
 	"github.com/gonum/matrix/mat64"
 )
 
@@ -21,22 +23,101 @@ func TestCheckIfEqual(t *testing.T) {
 	assert.Equal(t, checkIfEqual(slice1, slice2), 0)
 }
 
+// identityNetwork returns a network with linear activations
+// and identity weights, such that the output equals the input
+func identityNetwork(size int) *Network {
+	n := &Network{}
+	n.AddLayer(size, Identity, IdentityPrime)
+	n.AddLayer(size, Identity, IdentityPrime)
+	params := n.layers[0].Params()
+	params[0].Value.Apply(func(i, j int, v float64) float64 {
+		if i == j {
+			return 1
+		}
+		return 0
+	}, params[0].Value)
+	params[1].Value.Scale(0, params[1].Value)
+	return n
+}
+
 func TestValidateArgMaxSlice(t *testing.T) {
-	n := Network{}
+	n := identityNetwork(3)
+
+	dense1 := mat64.NewVector(3, []float64{1.0, 2.0, 3.0})
+	dense2 := mat64.NewVector(3, []float64{2.0, 2.0, 3.0})
+	dense3 := mat64.NewVector(3, []float64{3.0, 2.0, 1.0})
+
+	inputData := []*mat64.Vector{dense1, dense2, dense3}
+	outputData := []*mat64.Vector{dense1, dense2, dense3}
 
-	dense1 := mat64.NewDense(3,1, []float64{1.0, 2.0, 3.0})
-	dense2 := mat64.NewDense(3,1, []float64{2.0, 2.0, 3.0})
-	dense3 := mat64.NewDense(3,1, []float64{3.0, 2.0, 3.0})
+	assert.Equal(t, ValidateArgMaxSlice(n, inputData, outputData), true)
 
-	inputData := []*mat64.Dense{dense1, dense2, dense3}
-	outputData := []*mat64.Dense{dense1, dense2, dense3}
+	inputData = []*mat64.Vector{dense3, dense3, dense3}
+	outputData = []*mat64.Vector{dense1, dense2, dense1}
+
+	assert.Equal(t, ValidateArgMaxSlice(n, inputData, outputData), false)
+
+}
 
-	assert.Equal(t, n.ValidateArgMaxSlice(inputData, outputData), true)
+func TestValidateRegression(t *testing.T) {
+	// the identity network predicts the input, one off the targets of the first output
+	n := identityNetwork(2)
+	input := [][]float64{{1, 2}, {3, 4}, {5, 6}}
+	output := [][]float64{{2, 2}, {4, 4}, {6, 6}}
+	n.LoadValidationData(input, output)
 
-	inputData = []*mat64.Dense{dense1, dense3, dense3}
-	outputData = []*mat64.Dense{dense1, dense2, dense3}
+	assert.True(t, ValidateRegression(n, n.validationInput, n.validationOutput))
+	history := n.ValidationHistory()
+	assert.Equal(t, 1, len(history))
+	report := history[0].(metrics.RegressionReport)
+	assert.Equal(t, 3, report.Samples)
+	assert.Equal(t, 2, report.Outputs)
+	assert.Equal(t, []float64{1, 0}, report.MSE)
+	assert.Equal(t, []float64{1, 0}, report.MaxError)
+	assert.Equal(t, 0.5, report.MeanMSE)
+	assert.Equal(t, -0.5, report.Score())
 
-	assert.Equal(t, n.ValidateArgMaxSlice(inputData, outputData), false)
+	assert.Equal(t, report, n.EvaluateRegression(input, output))
 
+	// a network with non-finite weights fails the validation
+	n.layers[0].Params()[1].Value.Set(0, 0, math.Inf(1))
+	assert.False(t, ValidateRegression(n, n.validationInput, n.validationOutput))
+	assert.Equal(t, 2, len(n.ValidationHistory()))
 }
 
+func TestMultiLabel(t *testing.T) {
+	// the identity network predicts the input as label scores
+	n := identityNetwork(3)
+	input := [][]float64{{0.9, 0.2, 0.6}, {0.1, 0.7, 0.4}, {0.8, 0.3, 0.3}}
+	output := [][]float64{{1, 0, 1}, {0, 1, 0}, {1, 0, 0}}
+	n.LoadValidationData(input, output)
+
+	assert.Equal(t, []bool{true, false, true}, n.PredictLabels(input[0]))
+	assert.True(t, ValidateMultiLabel(n, n.validationInput, n.validationOutput))
+	report := n.ValidationHistory()[0].(metrics.MultiLabelReport)
+	assert.Equal(t, 1.0, report.SubsetAccuracy)
+	assert.Equal(t, []float64{0.5, 0.5, 0.5}, report.Thresholds)
+
+	assert.NoError(t, n.SetThresholds(0.65))
+	assert.Equal(t, []bool{true, false, false}, n.PredictLabels(input[0]))
+	report = n.EvaluateMultiLabel(input, output)
+	assert.InDelta(t, 2.0/3, report.SubsetAccuracy, 1e-12)
+	assert.InDelta(t, 1.0/9, report.HammingLoss, 1e-12)
+
+	assert.NoError(t, n.SetThresholds(0.5, 0.5, 0.35))
+	assert.Equal(t, []bool{false, true, true}, n.PredictLabels(input[1]))
+	assert.InDelta(t, 2.0/3, n.EvaluateMultiLabel(input, output).SubsetAccuracy, 1e-12)
+
+	// thresholds of another length than 1 or the number of labels are rejected
+	assert.Error(t, n.SetThresholds(0.5, 0.5))
+	assert.Error(t, (&Network{}).SetThresholds(0.5, 0.5))
+	assert.Equal(t, []float64{0.5, 0.5, 0.35}, n.thresholds)
+
+	thresholds := n.TuneThresholds(input, output)
+	assert.Equal(t, 3, len(thresholds))
+	assert.Equal(t, thresholds, n.thresholds)
+	assert.Equal(t, 1.0, n.EvaluateMultiLabel(input, output).SubsetAccuracy)
+
+	assert.NoError(t, n.SetThresholds())
+	assert.Equal(t, []float64{0.5, 0.5, 0.5}, n.EvaluateMultiLabel(input, output).Thresholds)
+}